@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/server"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// runCheckConfig validates the config, then loads everything serving needs
+// from it, and reports all the problems found instead of stopping at the
+// first one.
+func runCheckConfig(args []string) int {
+	if len(args) != 0 {
+		return commandUsage("check-config")
+	}
+
+	var problems config.Problems
+	if configErr != nil {
+		if configProblems, ok := configErr.(config.Problems); ok {
+			problems = append(problems, configProblems...)
+		} else {
+			problems = append(problems, configErr.Error())
+		}
+	}
+
+	if err := services.InitSigningKeys(); err != nil {
+		problems = append(problems, "jwt: "+err.Error())
+	}
+
+	tlsConfig := config.Config.HttpServer.Tls
+	if tlsConfig.CertFile != "" && tlsConfig.KeyFile != "" {
+		_, err := server.NewTLSReloader(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ClientCaFile, tlsConfig.ClientAuth)
+		if err != nil {
+			problems = append(problems, "httpServer.tls: "+err.Error())
+		}
+	}
+
+	if config.Config.Database.Url != "" {
+		db, err := database.Connect(config.Config.Database.Url)
+		if err != nil {
+			problems = append(problems, "database.url: Failed to connect to the database, error: "+err.Error())
+		} else {
+			pending, err := database.GetPendingMigrations(db)
+			if err != nil {
+				problems = append(problems, "database: Failed to check the schema, error: "+err.Error())
+			} else if len(pending) > 0 {
+				problems = append(problems, "database: Schema is behind by "+strconv.Itoa(len(pending))+" migration(s)")
+			}
+			db.Close()
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println("Config is valid")
+	return 0
+}
+
+// runPrintConfig prints the config the layers add up to, secrets redacted.
+// Config problems are reported after it.
+func runPrintConfig(args []string) int {
+	if len(args) != 0 {
+		return commandUsage("print-config")
+	}
+
+	if err := config.Dump(os.Stdout); err != nil {
+		return fail("Failed to marshal the config to JSON")
+	}
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, configErr.Error())
+		return 1
+	}
+	return 0
+}
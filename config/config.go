@@ -1,44 +1,145 @@
 package config
 
 import (
-	"encoding/json"
 	"os"
-
-	"github.com/jafarlihi/addressbook/logger"
+	"strings"
 )
 
+// jwtKeyConfig describes an asymmetric key access tokens are signed or
+// verified with. Keys without a private key file can only verify.
+type jwtKeyConfig struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"algorithm"`
+	PrivateKeyFile string `json:"privateKeyFile"`
+	PublicKeyFile  string `json:"publicKeyFile"`
+}
+
 type jwtConfig struct {
-	SigningSecret string `json:"signingSecret"`
+	SigningSecret        string         `json:"signingSecret" secret:"true"`
+	SigningKey           string         `json:"signingKey"`
+	Keys                 []jwtKeyConfig `json:"keys"`
+	AccessTokenLifetime  string         `json:"accessTokenLifetime"`
+	RefreshTokenLifetime string         `json:"refreshTokenLifetime"`
 }
 
 type databaseConfig struct {
-	Url string `json:"url"`
+	Url string `json:"url" secret:"url"`
+}
+
+// tlsConfig turns on TLS when a certificate and key are given. With a client
+// CA clients have to present a certificate signed by it, or only if they
+// present one when clientAuth is "optional".
+type tlsConfig struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	ClientCaFile string `json:"clientCaFile"`
+	ClientAuth   string `json:"clientAuth"`
 }
 
+// httpServerConfig holds the timeouts as Go durations, and the size limits
+// in bytes, zero meaning no limit. The streamed contact exports extend the
+// write timeout before writing each contact, so for them it bounds how long
+// a client may stall rather than the whole response. TrustedProxies are the
+// IP addresses and CIDR ranges of the proxies whose X-Forwarded-For and
+// X-Real-IP headers are believed, by default none.
 type httpServerConfig struct {
-	Port string `json:"port"`
+	Port              string    `json:"port"`
+	ReadTimeout       string    `json:"readTimeout"`
+	ReadHeaderTimeout string    `json:"readHeaderTimeout"`
+	WriteTimeout      string    `json:"writeTimeout"`
+	IdleTimeout       string    `json:"idleTimeout"`
+	ShutdownTimeout   string    `json:"shutdownTimeout"`
+	MaxHeaderBytes    int       `json:"maxHeaderBytes"`
+	MaxBodyBytes      int64     `json:"maxBodyBytes"`
+	TrustedProxies    []string  `json:"trustedProxies"`
+	Tls               tlsConfig `json:"tls"`
+}
+
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password" secret:"true"`
+}
+
+// mailConfig selects how mail is sent, driver is one of smtp, file, or log.
+// The URLs are optional links put in the emails, {token} in them is replaced
+// with the token.
+type mailConfig struct {
+	Driver               string     `json:"driver"`
+	From                 string     `json:"from"`
+	Directory            string     `json:"directory"`
+	Smtp                 smtpConfig `json:"smtp"`
+	PasswordResetUrl     string     `json:"passwordResetUrl"`
+	EmailVerificationUrl string     `json:"emailVerificationUrl"`
 }
 
 type configuration struct {
 	Jwt        jwtConfig        `json:"jwt"`
 	Database   databaseConfig   `json:"database"`
 	HttpServer httpServerConfig `json:"httpServer"`
+	Mail       mailConfig       `json:"mail"`
 }
 
 var Config configuration
 
-func InitConfig() {
-	configFile, err := os.Open("./config.json")
-	if err != nil {
-		logger.Log.Error("Failed to open the config file, error: " + err.Error())
-		os.Exit(1)
+// Problems lists everything wrong with the configuration, so that all of it
+// can be fixed in one go.
+type Problems []string
+
+func (problems Problems) Error() string {
+	return strings.Join(problems, "\n")
+}
+
+func defaults() configuration {
+	return configuration{
+		Jwt: jwtConfig{
+			AccessTokenLifetime:  "15m",
+			RefreshTokenLifetime: "720h",
+		},
+		HttpServer: httpServerConfig{
+			Port:              "8081",
+			ReadTimeout:       "30s",
+			ReadHeaderTimeout: "10s",
+			WriteTimeout:      "60s",
+			IdleTimeout:       "120s",
+			ShutdownTimeout:   "30s",
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      16 << 20,
+		},
+		Mail: mailConfig{Driver: "log", From: "addressbook@localhost"},
 	}
-	defer configFile.Close()
+}
+
+// InitConfig loads the configuration in layers: the defaults, then the
+// config file, then the ADDRESSBOOK_* environment variables, then the flags
+// registered with RegisterFlags. The config file is the one given with
+// -config or ADDRESSBOOK_CONFIG, or ./config.json if it exists. Config is
+// loaded even if there are problems, which are returned as Problems.
+func InitConfig() error {
+	loaded := defaults()
+	var problems Problems
+
+	path := configPath
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			path = defaultConfigPath
+		}
+	}
+	if path != "" {
+		problems = append(problems, loadFile(&loaded, path)...)
+	}
+
+	problems = append(problems, loadEnvironment(&loaded)...)
+	problems = append(problems, loadFlags(&loaded)...)
+	problems = append(problems, loaded.validate()...)
 
-	jsonParser := json.NewDecoder(configFile)
-	err = jsonParser.Decode(&Config)
-	if err != nil {
-		logger.Log.Error("Failed to decode the config file, error: " + err.Error())
-		os.Exit(1)
+	Config = loaded
+	if len(problems) > 0 {
+		return problems
 	}
+	return nil
 }
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+)
+
+const redacted = "REDACTED"
+
+var dsnPasswordRegexp = regexp.MustCompile(`password=('[^']*'|\S+)`)
+
+// Dump writes the configuration as JSON with the secrets redacted.
+func Dump(w io.Writer) error {
+	dumped := Config
+	value := reflect.ValueOf(&dumped).Elem()
+	for _, s := range settings {
+		field := value.FieldByIndex(s.index)
+		if s.secret == "" || field.String() == "" {
+			continue
+		}
+		switch s.secret {
+		case "true":
+			field.SetString(redacted)
+		case "url":
+			field.SetString(redactURL(field.String()))
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(dumped)
+}
+
+// redactURL hides the password of a database URL, which is either a URL, with
+// the password in the user info or a password query parameter, or a
+// key=value connection string.
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err == nil && parsed.Scheme != "" {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+		}
+		if query := parsed.Query(); query["password"] != nil {
+			query.Set("password", redacted)
+			parsed.RawQuery = query.Encode()
+		}
+		return parsed.String()
+	}
+	return dsnPasswordRegexp.ReplaceAllString(value, "password="+redacted)
+}
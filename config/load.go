@@ -0,0 +1,215 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix         = "ADDRESSBOOK_"
+	defaultConfigPath = "./config.json"
+)
+
+// setting is a single configurable value, named by its path of JSON keys.
+type setting struct {
+	path   string
+	env    string
+	index  []int
+	secret string
+}
+
+var settings = collectSettings(reflect.TypeOf(configuration{}), "", nil)
+
+// configPath and flagValues are set by the flags registered with
+// RegisterFlags, flagValues in the order the flags were given.
+var (
+	configPath string
+	flagValues []flagValue
+)
+
+type flagValue struct {
+	setting *setting
+	value   string
+}
+
+func collectSettings(t reflect.Type, prefix string, index []int) []*setting {
+	var collected []*setting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := prefix + field.Tag.Get("json")
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Type.Kind() == reflect.Struct {
+			collected = append(collected, collectSettings(field.Type, path+".", fieldIndex)...)
+			continue
+		}
+		collected = append(collected, &setting{
+			path:   path,
+			env:    envPrefix + envName(path),
+			index:  fieldIndex,
+			secret: field.Tag.Get("secret"),
+		})
+	}
+	return collected
+}
+
+// envName turns a setting path like httpServer.port into HTTP_SERVER_PORT.
+func envName(path string) string {
+	var name strings.Builder
+	for i, r := range path {
+		switch {
+		case r == '.':
+			name.WriteRune('_')
+		case unicode.IsUpper(r) && i > 0 && path[i-1] != '.':
+			name.WriteRune('_')
+			name.WriteRune(r)
+		default:
+			name.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return name.String()
+}
+
+// RegisterFlags adds -config and a flag for every setting, named by its
+// path, to the flag set.
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&configPath, "config", "", "config file, JSON, YAML, or TOML (env "+envPrefix+"CONFIG)")
+	for _, s := range settings {
+		s := s
+		flags.Func(s.path, "overrides "+s.path+" (env "+s.env+")", func(value string) error {
+			flagValues = append(flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+}
+
+// set parses the value given as text onto the setting. Strings are taken as
+// they are, other values are parsed as JSON.
+func (s *setting) set(c *configuration, value string) error {
+	field := reflect.ValueOf(c).Elem().FieldByIndex(s.index)
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+func loadFile(c *configuration, path string) Problems {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Problems{"Failed to read the config file, error: " + err.Error()}
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return Problems{"Config file " + path + " has to have a .json, .yaml, .yml, or .toml extension"}
+	}
+	if err != nil {
+		return Problems{"Failed to decode the config file, error: " + err.Error()}
+	}
+
+	return decodeSection(reflect.ValueOf(c).Elem(), values, "")
+}
+
+// decodeSection sets the fields of the struct from the values of a config
+// file section, which come in the types the file format decodes to.
+func decodeSection(section reflect.Value, values map[string]interface{}, prefix string) Problems {
+	var problems Problems
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < section.NumField(); i++ {
+		fields[section.Type().Field(i).Tag.Get("json")] = section.Field(i)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		path := prefix + key
+		field, ok := fields[key]
+		if !ok {
+			problems = append(problems, path+": Unknown setting")
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Struct:
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				problems = append(problems, path+": Has to be a section")
+				continue
+			}
+			problems = append(problems, decodeSection(field, nested, path+".")...)
+		case reflect.String:
+			switch value.(type) {
+			case string, int, int64, float64, bool:
+				field.SetString(fmt.Sprint(value))
+			default:
+				problems = append(problems, path+": Has to be a string")
+			}
+		default:
+			encoded, err := json.Marshal(value)
+			if err == nil {
+				err = json.Unmarshal(encoded, field.Addr().Interface())
+			}
+			if err != nil {
+				problems = append(problems, path+": "+err.Error())
+			}
+		}
+	}
+	return problems
+}
+
+// loadEnvironment applies the ADDRESSBOOK_* variables. A variable suffixed
+// with _FILE names a file to read the value from, for mounted secrets.
+func loadEnvironment(c *configuration) Problems {
+	var problems Problems
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if file, fileOK := os.LookupEnv(s.env + "_FILE"); fileOK {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				problems = append(problems, s.env+"_FILE: Failed to read the file, error: "+err.Error())
+				continue
+			}
+			value, ok = strings.TrimRight(string(content), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			problems = append(problems, s.env+": "+err.Error())
+		}
+	}
+	return problems
+}
+
+func loadFlags(c *configuration) Problems {
+	var problems Problems
+	for _, flagValue := range flagValues {
+		if err := flagValue.setting.set(c, flagValue.value); err != nil {
+			problems = append(problems, "-"+flagValue.setting.path+": "+err.Error())
+		}
+	}
+	return problems
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+var jwtKeyAlgorithms = map[string]bool{"RS256": true, "ES256": true, "EdDSA": true}
+
+var tlsClientAuths = map[string]bool{"require": true, "optional": true, "": true}
+
+var mailDrivers = map[string]bool{"smtp": true, "file": true, "log": true, "": true}
+
+// validate checks the values that can be checked without loading files or
+// connecting anywhere.
+func (c *configuration) validate() Problems {
+	var problems Problems
+
+	if c.Jwt.SigningSecret == "" && len(c.Jwt.Keys) == 0 {
+		problems = append(problems, "jwt: Signing secret or signing keys have to be configured")
+	}
+	kids := make(map[string]bool)
+	for i, key := range c.Jwt.Keys {
+		path := "jwt.keys[" + strconv.Itoa(i) + "]"
+		if key.ID == "" {
+			problems = append(problems, path+".kid: Key ID is missing")
+		} else if kids[key.ID] {
+			problems = append(problems, path+".kid: Key ID "+key.ID+" is used by another key")
+		}
+		kids[key.ID] = true
+		if !jwtKeyAlgorithms[key.Algorithm] {
+			problems = append(problems, path+".algorithm: Algorithm has to be one of RS256, ES256, or EdDSA")
+		}
+		if key.PrivateKeyFile == "" && key.PublicKeyFile == "" {
+			problems = append(problems, path+": Private or public key file has to be configured")
+		}
+	}
+	if c.Jwt.SigningKey != "" && !kids[c.Jwt.SigningKey] {
+		problems = append(problems, "jwt.signingKey: No key has the kid "+c.Jwt.SigningKey)
+	}
+	problems = append(problems, validateDuration("jwt.accessTokenLifetime", c.Jwt.AccessTokenLifetime)...)
+	problems = append(problems, validateDuration("jwt.refreshTokenLifetime", c.Jwt.RefreshTokenLifetime)...)
+
+	if c.Database.Url == "" {
+		problems = append(problems, "database.url: Database URL has to be configured")
+	}
+
+	problems = append(problems, validatePort("httpServer.port", c.HttpServer.Port)...)
+	problems = append(problems, validateDuration("httpServer.readTimeout", c.HttpServer.ReadTimeout)...)
+	problems = append(problems, validateDuration("httpServer.readHeaderTimeout", c.HttpServer.ReadHeaderTimeout)...)
+	problems = append(problems, validateDuration("httpServer.writeTimeout", c.HttpServer.WriteTimeout)...)
+	problems = append(problems, validateDuration("httpServer.idleTimeout", c.HttpServer.IdleTimeout)...)
+	problems = append(problems, validateDuration("httpServer.shutdownTimeout", c.HttpServer.ShutdownTimeout)...)
+	if c.HttpServer.MaxHeaderBytes < 0 {
+		problems = append(problems, "httpServer.maxHeaderBytes: Can't be negative")
+	}
+	if c.HttpServer.MaxBodyBytes < 0 {
+		problems = append(problems, "httpServer.maxBodyBytes: Can't be negative")
+	}
+	for i, proxy := range c.HttpServer.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, "httpServer.trustedProxies["+strconv.Itoa(i)+"]: "+proxy+" isn't an IP address or CIDR range")
+		}
+	}
+	problems = append(problems, c.HttpServer.Tls.validate()...)
+
+	if !mailDrivers[c.Mail.Driver] {
+		problems = append(problems, "mail.driver: Unknown mail driver "+c.Mail.Driver+", has to be one of smtp, file, or log")
+	}
+	if c.Mail.Driver == "smtp" {
+		if c.Mail.Smtp.Host == "" {
+			problems = append(problems, "mail.smtp.host: Host has to be configured for the smtp driver")
+		}
+		problems = append(problems, validatePort("mail.smtp.port", c.Mail.Smtp.Port)...)
+	}
+	if c.Mail.Driver == "file" && c.Mail.Directory == "" {
+		problems = append(problems, "mail.directory: Directory has to be configured for the file driver")
+	}
+	return problems
+}
+
+func (c *tlsConfig) validate() Problems {
+	var problems Problems
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		problems = append(problems, "httpServer.tls: Certificate and key files have to be configured together")
+	}
+	if c.ClientCaFile != "" && c.CertFile == "" {
+		problems = append(problems, "httpServer.tls.clientCaFile: Client CA needs TLS to be configured")
+	}
+	if !tlsClientAuths[c.ClientAuth] {
+		problems = append(problems, "httpServer.tls.clientAuth: Client auth has to be either require or optional")
+	} else if c.ClientAuth != "" && c.ClientCaFile == "" {
+		problems = append(problems, "httpServer.tls.clientAuth: Client auth needs a client CA file")
+	}
+	return problems
+}
+
+func validateDuration(path string, value string) Problems {
+	if value == "" {
+		return nil
+	}
+	if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+		return Problems{path + ": " + value + " isn't a positive duration like 15m or 720h"}
+	}
+	return nil
+}
+
+func validatePort(path string, value string) Problems {
+	if port, err := strconv.ParseUint(value, 10, 16); err != nil || port == 0 {
+		return Problems{path + ": " + value + " isn't a port number"}
+	}
+	return nil
+}
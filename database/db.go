@@ -2,7 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"io/ioutil"
 	"os"
 
 	"github.com/jafarlihi/addressbook/config"
@@ -14,25 +13,24 @@ var Database *sql.DB
 
 func InitDatabase() {
 	var err error
-	Database, err = sql.Open("postgres", config.Config.Database.Url)
+	Database, err = Connect(config.Config.Database.Url)
 	if err != nil {
 		logger.Log.Error("Failed to connect to the database, error: " + err.Error())
 		os.Exit(1)
 	}
+}
 
-	err = Database.Ping()
+// Connect opens the database and checks that it can be reached.
+func Connect(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
 	if err != nil {
-		logger.Log.Error("Failed to connect to the database, error: " + err.Error())
-		os.Exit(1)
+		return nil, err
 	}
 
-	schemaBytes, err := ioutil.ReadFile("schema.sql")
-	if err != nil {
-		logger.Log.Warningf("Failed to read the schema.sql for database schema initialization. Skipping procedure. Error: " + err.Error())
-		return
-	}
-	_, err = Database.Exec(string(schemaBytes))
+	err = db.Ping()
 	if err != nil {
-		logger.Log.Warningf("Failed to (re-)initialize the schema, error: " + err.Error())
+		db.Close()
+		return nil, err
 	}
+	return db, nil
 }
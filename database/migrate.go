@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jafarlihi/addressbook/logger"
+)
+
+// migrationLockID is the key of the advisory lock held while migrating, so
+// that replicas starting together don't apply the same migration twice.
+const migrationLockID = 4417001
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change, Down is empty if it can't be
+// reverted.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied. Migrations
+// found in the database but not in the binary are Unknown.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// Migrations are the migrations embedded from the migrations directory,
+// sorted by version. Tests can replace them.
+var Migrations = mustLoadMigrations(migrationFiles)
+
+func mustLoadMigrations(files fs.FS) []Migration {
+	migrations, err := LoadMigrations(files)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// LoadMigrations reads the <version>_<name>.up.sql and .down.sql files of
+// the migrations directory.
+func LoadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.New("Migration file " + entry.Name() + " isn't named <version>_<name>.up.sql or <version>_<name>.down.sql")
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(files, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, errors.New("Migration " + match[1] + " is named both " + migration.Name + " and " + match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, errors.New("Migration " + strconv.FormatInt(migration.Version, 10) + " has no up file")
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations in order, each in its own
+// transaction, and returns the ones it applied.
+func MigrateUp(db *sql.DB) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(db, func(conn *sql.Conn) error {
+		appliedAt, err := getAppliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range Migrations {
+			if _, ok := appliedAt[migration.Version]; ok {
+				continue
+			}
+			sql := "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+			err = runMigration(conn, migration, migration.Up, sql, migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the given number of the most recently applied
+// migrations and returns the ones it reverted.
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withMigrationLock(db, func(conn *sql.Conn) error {
+		appliedAt, err := getAppliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := Migrations[i]
+			if _, ok := appliedAt[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return errors.New("Migration " + migration.Label() + " can't be reverted")
+			}
+			sql := "DELETE FROM schema_migrations WHERE version = $1"
+			err = runMigration(conn, migration, migration.Down, sql, migration.Version)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// GetMigrationStatus returns the status of the known migrations followed by
+// the applied ones the binary doesn't know about.
+func GetMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrationLock(db, func(conn *sql.Conn) error {
+		appliedAt, err := getAppliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range Migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if at, ok := appliedAt[migration.Version]; ok {
+				status.AppliedAt = &at
+				delete(appliedAt, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		var unknown []MigrationStatus
+		for version, at := range appliedAt {
+			at := at
+			unknown = append(unknown, MigrationStatus{Version: version, AppliedAt: &at, Unknown: true})
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+		statuses = append(statuses, unknown...)
+		return nil
+	})
+	return statuses, err
+}
+
+// GetPendingMigrations returns the migrations that haven't been applied yet.
+func GetPendingMigrations(db *sql.DB) ([]Migration, error) {
+	statuses, err := GetMigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for i, status := range statuses {
+		if !status.Unknown && status.AppliedAt == nil {
+			pending = append(pending, Migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// withMigrationLock runs f holding the migration advisory lock. Advisory
+// locks belong to a session, so everything runs on a single connection.
+func withMigrationLock(db *sql.DB, f func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		logger.Log.Error("Failed to get a database connection for migrating, error: " + err.Error())
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		logger.Log.Error("Failed to acquire the migration lock, error: " + err.Error())
+		return err
+	}
+	defer func() {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+		if err != nil {
+			logger.Log.Error("Failed to release the migration lock, error: " + err.Error())
+		}
+	}()
+
+	return f(conn)
+}
+
+func getAppliedMigrations(conn *sql.Conn) (map[int64]time.Time, error) {
+	ctx := context.Background()
+	sql := `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint NOT NULL,
+    name character varying NOT NULL,
+    applied_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (version)
+)`
+	_, err := conn.ExecContext(ctx, sql)
+	if err != nil {
+		logger.Log.Error("Failed to create the schema_migrations table, error: " + err.Error())
+		return nil, err
+	}
+
+	sql = "SELECT version, applied_at FROM schema_migrations"
+	rows, err := conn.QueryContext(ctx, sql)
+	if err != nil {
+		logger.Log.Error("Failed to get the applied migrations, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			logger.Log.Error("Failed to scan the applied migrations, error: " + err.Error())
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration runs the migration script and the statement recording it in
+// one transaction, so a failing migration leaves nothing behind.
+func runMigration(conn *sql.Conn, migration Migration, script string, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Log.Error("Failed to begin the transaction of migration " + migration.Label() + ", error: " + err.Error())
+		return err
+	}
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		tx.Rollback()
+		logger.Log.Error("Failed to run migration " + migration.Label() + ", error: " + err.Error())
+		return err
+	}
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		tx.Rollback()
+		logger.Log.Error("Failed to record migration " + migration.Label() + ", error: " + err.Error())
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit migration " + migration.Label() + ", error: " + err.Error())
+	}
+	return err
+}
+
+// Label is the version and name of the migration as in its file names.
+func (migration Migration) Label() string {
+	return fmt.Sprintf("%04d_%s", migration.Version, migration.Name)
+}
@@ -0,0 +1,274 @@
+package database_test
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/database"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	if len(database.Migrations) == 0 {
+		t.Fatal("No migrations are embedded")
+	}
+	for i, migration := range database.Migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("Migration %s breaks the version sequence", migration.Label())
+		}
+		if migration.Down == "" {
+			t.Errorf("Migration %s has no down file", migration.Label())
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0002_add_tags.up.sql":         {Data: []byte("CREATE TABLE tags ();")},
+		"migrations/0001_initial_schema.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+		"migrations/0001_initial_schema.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	migrations, err := database.LoadMigrations(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Label() != "0001_initial_schema" || migrations[0].Down != "DROP TABLE users;" {
+		t.Errorf("Unexpected first migration %+v", migrations[0])
+	}
+	if migrations[1].Label() != "0002_add_tags" || migrations[1].Down != "" {
+		t.Errorf("Unexpected second migration %+v", migrations[1])
+	}
+
+	files["migrations/0003_add_notes.down.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE contacts DROP COLUMN notes;")}
+	if _, err = database.LoadMigrations(files); err == nil {
+		t.Error("Expected a migration without up file to fail")
+	}
+	delete(files, "migrations/0003_add_notes.down.sql")
+
+	files["migrations/notes.sql"] = &fstest.MapFile{Data: []byte("")}
+	if _, err = database.LoadMigrations(files); err == nil {
+		t.Error("Expected a badly named migration file to fail")
+	}
+}
+
+func useMigrations(t *testing.T, migrations []database.Migration) {
+	embedded := database.Migrations
+	database.Migrations = migrations
+	t.Cleanup(func() { database.Migrations = embedded })
+}
+
+func expectAppliedMigrations(mock sqlmock.Sqlmock, versions ...int64) {
+	mock.ExpectExec("^SELECT pg_advisory_lock").WithArgs(4417001).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, time.Now())
+	}
+	mock.ExpectQuery("^SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+func TestMigrateUp(t *testing.T) {
+	useMigrations(t, []database.Migration{
+		{Version: 1, Name: "initial_schema", Up: "CREATE TABLE users ()"},
+		{Version: 2, Name: "add_tags", Up: "CREATE TABLE tags ()"},
+	})
+	db, mock, _ := sqlmock.New()
+
+	expectAppliedMigrations(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec("^CREATE TABLE tags").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO schema_migrations").WithArgs(2, "add_tags").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WithArgs(4417001).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := database.MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("Expected only migration 2 to be applied, got %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrateUpRollsBackFailedMigration(t *testing.T) {
+	useMigrations(t, []database.Migration{
+		{Version: 1, Name: "initial_schema", Up: "CREATE TABLE users ()"},
+	})
+	db, mock, _ := sqlmock.New()
+
+	expectAppliedMigrations(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("^CREATE TABLE users").WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := database.MigrateUp(db)
+	if err == nil || len(applied) != 0 {
+		t.Errorf("Expected the migration to fail, got %+v, %v", applied, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	useMigrations(t, []database.Migration{
+		{Version: 1, Name: "initial_schema", Up: "CREATE TABLE users ()", Down: "DROP TABLE users"},
+		{Version: 2, Name: "add_tags", Up: "CREATE TABLE tags ()", Down: "DROP TABLE tags"},
+		{Version: 3, Name: "add_notes", Up: "ALTER TABLE contacts ADD notes varchar"},
+	})
+	db, mock, _ := sqlmock.New()
+
+	expectAppliedMigrations(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("^DROP TABLE tags").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := database.MigrateDown(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Errorf("Expected only migration 2 to be reverted, got %+v", reverted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPendingMigrations(t *testing.T) {
+	useMigrations(t, []database.Migration{
+		{Version: 1, Name: "initial_schema", Up: "CREATE TABLE users ()"},
+		{Version: 2, Name: "add_tags", Up: "CREATE TABLE tags ()"},
+	})
+	db, mock, _ := sqlmock.New()
+
+	expectAppliedMigrations(mock, 1, 5)
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	pending, err := database.GetPendingMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("Expected migration 2 to be pending, got %+v", pending)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+// normalizeSchema drops comments, IF NOT EXISTS, and formatting, so that
+// schemas differing only in those compare equal.
+func normalizeSchema(schema string) string {
+	var statements []string
+	for _, line := range strings.Split(schema, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		statements = append(statements, strings.Replace(line, " IF NOT EXISTS", "", 1))
+	}
+	return strings.TrimSuffix(strings.Join(statements, " "), ";")
+}
+
+func TestInitialMigrationIsBaselineSchema(t *testing.T) {
+	baseline, err := ioutil.ReadFile("testdata/baseline_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalizeSchema(database.Migrations[0].Up) != normalizeSchema(string(baseline)) {
+		t.Errorf("Migration %s differs from the baseline schema.sql, schema changes belong in later migrations", database.Migrations[0].Label())
+	}
+}
+
+func TestMigrateUpFromBaselineSchema(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+
+	expectAppliedMigrations(mock)
+	for _, migration := range database.Migrations {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(migration.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("^INSERT INTO schema_migrations").WithArgs(migration.Version, migration.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec("^SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := database.MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(database.Migrations) {
+		t.Errorf("Expected all %d migrations to be applied, got %d", len(database.Migrations), len(applied))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+// TestMigrateBaselineDatabase upgrades a database created from the baseline
+// schema.sql, then reverts and reapplies every migration. It needs a
+// PostgreSQL database given with ADDRESSBOOK_TEST_DATABASE_URL, whose public
+// schema it wipes.
+func TestMigrateBaselineDatabase(t *testing.T) {
+	url := os.Getenv("ADDRESSBOOK_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ADDRESSBOOK_TEST_DATABASE_URL isn't set")
+	}
+	db, err := database.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	baseline, err := ioutil.ReadFile("testdata/baseline_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"DROP SCHEMA public CASCADE",
+		"CREATE SCHEMA public",
+		string(baseline),
+		"INSERT INTO users (username, email, password) VALUES ('ada', 'ada@mail.com', 'hash')",
+		"INSERT INTO contacts (user_id, name, surname, email) VALUES (1, 'Ada', 'Lovelace', 'ada@example.com')",
+	} {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatalf("Failed to set up the baseline database, error: %s", err)
+		}
+	}
+
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatalf("Failed to migrate the baseline database, error: %s", err)
+	}
+
+	var primaryEmail string
+	err = db.QueryRow("SELECT address FROM contact_emails WHERE contact = 1 AND is_primary").Scan(&primaryEmail)
+	if err != nil || primaryEmail != "ada@example.com" {
+		t.Errorf("Email of the existing contact wasn't made its primary email, got %q, %v", primaryEmail, err)
+	}
+	var found int
+	err = db.QueryRow("SELECT count(*) FROM contacts WHERE search_vector @@ websearch_to_tsquery('simple', 'lovelace')").Scan(&found)
+	if err != nil || found != 1 {
+		t.Errorf("Existing contact isn't searchable, found %d, %v", found, err)
+	}
+
+	if _, err := database.MigrateDown(db, len(database.Migrations)); err != nil {
+		t.Fatalf("Failed to revert the migrations, error: %s", err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatalf("Failed to reapply the migrations, error: %s", err)
+	}
+}
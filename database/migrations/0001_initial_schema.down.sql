@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS contact_list_entries;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS contact_lists;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users (
+    id serial NOT NULL,
+    username character varying NOT NULL UNIQUE,
+    email character varying NOT NULL UNIQUE,
+    password character varying NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS contact_lists (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    name character varying NOT NULL,
+    PRIMARY KEY(id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS contacts (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    name character varying NOT NULL,
+    surname character varying NOT NULL,
+    email character varying NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS contact_list_entries (
+    contact_list integer NOT NULL,
+    contact integer NOT NULL,
+    UNIQUE (contact_list, contact),
+    FOREIGN KEY (contact_list) REFERENCES contact_lists (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
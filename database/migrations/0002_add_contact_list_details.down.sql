@@ -0,0 +1,3 @@
+ALTER TABLE contact_lists DROP COLUMN IF EXISTS archived;
+ALTER TABLE contact_lists DROP COLUMN IF EXISTS color;
+ALTER TABLE contact_lists DROP COLUMN IF EXISTS description;
@@ -0,0 +1,3 @@
+ALTER TABLE contact_lists ADD COLUMN IF NOT EXISTS description character varying NOT NULL DEFAULT '';
+ALTER TABLE contact_lists ADD COLUMN IF NOT EXISTS color character varying NOT NULL DEFAULT '';
+ALTER TABLE contact_lists ADD COLUMN IF NOT EXISTS archived boolean NOT NULL DEFAULT false;
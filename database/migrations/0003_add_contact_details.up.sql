@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS contact_phone_numbers (
+    id serial NOT NULL,
+    contact integer NOT NULL,
+    label character varying NOT NULL,
+    number character varying NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS contact_emails (
+    id serial NOT NULL,
+    contact integer NOT NULL,
+    label character varying NOT NULL DEFAULT '',
+    address character varying NOT NULL,
+    is_primary boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id),
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contact_emails_primary_idx ON contact_emails (contact) WHERE is_primary;
+
+CREATE TABLE IF NOT EXISTS contact_addresses (
+    id serial NOT NULL,
+    contact integer NOT NULL,
+    label character varying NOT NULL DEFAULT '',
+    street character varying NOT NULL DEFAULT '',
+    city character varying NOT NULL DEFAULT '',
+    region character varying NOT NULL DEFAULT '',
+    postcode character varying NOT NULL DEFAULT '',
+    country character varying NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS contact_phone_numbers_contact_idx ON contact_phone_numbers (contact);
+CREATE INDEX IF NOT EXISTS contact_emails_contact_idx ON contact_emails (contact);
+CREATE INDEX IF NOT EXISTS contact_addresses_contact_idx ON contact_addresses (contact);
+
+-- Contacts from before the detail tables get their email as primary email,
+-- like NormalizeContactEmails gives new contacts.
+INSERT INTO contact_emails (contact, address, is_primary)
+    SELECT c.id, c.email, true FROM contacts c
+    WHERE c.email <> '' AND NOT EXISTS (SELECT 1 FROM contact_emails e WHERE e.contact = c.id);
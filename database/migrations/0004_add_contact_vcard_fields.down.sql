@@ -0,0 +1,3 @@
+ALTER TABLE contacts DROP COLUMN IF EXISTS vcard_extra;
+ALTER TABLE contacts DROP COLUMN IF EXISTS birthday;
+ALTER TABLE contacts DROP COLUMN IF EXISTS notes;
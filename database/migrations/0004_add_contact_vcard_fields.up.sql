@@ -0,0 +1,3 @@
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS notes character varying NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS birthday character varying NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS vcard_extra character varying NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS contact_lists_name_prefix_idx;
+DROP INDEX IF EXISTS contact_lists_user_id_name_idx;
+DROP INDEX IF EXISTS contacts_name_prefix_idx;
+DROP INDEX IF EXISTS contacts_email_domain_idx;
+DROP INDEX IF EXISTS contacts_user_id_email_idx;
+DROP INDEX IF EXISTS contacts_user_id_surname_idx;
+DROP INDEX IF EXISTS contacts_user_id_name_idx;
+DROP INDEX IF EXISTS contacts_user_id_idx;
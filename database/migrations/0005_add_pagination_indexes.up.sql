@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS contacts_user_id_idx ON contacts (user_id, id);
+CREATE INDEX IF NOT EXISTS contacts_user_id_name_idx ON contacts (user_id, name, id);
+CREATE INDEX IF NOT EXISTS contacts_user_id_surname_idx ON contacts (user_id, surname, id);
+CREATE INDEX IF NOT EXISTS contacts_user_id_email_idx ON contacts (user_id, email, id);
+CREATE INDEX IF NOT EXISTS contacts_email_domain_idx ON contacts (user_id, lower(split_part(email, '@', 2)));
+CREATE INDEX IF NOT EXISTS contacts_name_prefix_idx ON contacts (user_id, lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS contact_lists_user_id_name_idx ON contact_lists (user_id, name, id);
+CREATE INDEX IF NOT EXISTS contact_lists_name_prefix_idx ON contact_lists (user_id, lower(name) text_pattern_ops);
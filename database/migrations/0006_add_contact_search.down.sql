@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS contacts_search_text_trgm_idx;
+DROP INDEX IF EXISTS contacts_search_vector_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE contacts DROP COLUMN IF EXISTS search_text;
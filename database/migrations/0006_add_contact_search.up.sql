@@ -0,0 +1,18 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS search_text character varying NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', search_text)) STORED;
+
+-- Fills in the search text of the existing contacts the way
+-- contactSearchText does for new ones.
+UPDATE contacts c SET search_text = concat_ws(' ',
+    NULLIF(btrim(c.name), ''),
+    NULLIF(btrim(c.surname), ''),
+    NULLIF(btrim(c.email), ''),
+    (SELECT string_agg(NULLIF(btrim(e.address), ''), ' ' ORDER BY e.id) FROM contact_emails e WHERE e.contact = c.id AND e.address <> c.email),
+    (SELECT string_agg(NULLIF(btrim(p.number), ''), ' ' ORDER BY p.id) FROM contact_phone_numbers p WHERE p.contact = c.id),
+    NULLIF(btrim(c.notes), ''))
+WHERE c.search_text = '';
+
+CREATE INDEX IF NOT EXISTS contacts_search_vector_idx ON contacts USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS contacts_search_text_trgm_idx ON contacts USING gin (search_text gin_trgm_ops);
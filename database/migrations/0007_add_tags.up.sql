@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    name character varying NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS contact_tags (
+    contact integer NOT NULL,
+    tag integer NOT NULL,
+    UNIQUE (contact, tag),
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (tag) REFERENCES tags (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS contact_tags_tag_idx ON contact_tags (tag, contact);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    name character varying NOT NULL,
+    type character varying NOT NULL,
+    required boolean NOT NULL DEFAULT false,
+    options character varying[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (id),
+    UNIQUE (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS contact_custom_values (
+    contact integer NOT NULL,
+    field integer NOT NULL,
+    value character varying NOT NULL,
+    UNIQUE (contact, field),
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (field) REFERENCES custom_fields (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS contact_custom_values_field_idx ON contact_custom_values (field, value);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    family character varying NOT NULL,
+    token_hash character varying NOT NULL UNIQUE,
+    expires_at timestamp with time zone NOT NULL,
+    used boolean NOT NULL DEFAULT false,
+    revoked boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family);
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti character varying NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (jti)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    name character varying NOT NULL,
+    prefix character varying NOT NULL,
+    key_hash character varying NOT NULL UNIQUE,
+    expires_at timestamp with time zone,
+    last_used_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS scopes;
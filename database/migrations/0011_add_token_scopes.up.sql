@@ -0,0 +1,7 @@
+-- Tokens and keys from before scopes had full access, so they get all scopes.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scopes character varying[] NOT NULL
+    DEFAULT '{contacts:read,contacts:write,lists:read,lists:write,account}';
+ALTER TABLE refresh_tokens ALTER COLUMN scopes DROP DEFAULT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes character varying[] NOT NULL
+    DEFAULT '{contacts:read,contacts:write,lists:read,lists:write,account}';
+ALTER TABLE api_keys ALTER COLUMN scopes DROP DEFAULT;
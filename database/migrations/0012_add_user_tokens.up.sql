@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    purpose character varying NOT NULL,
+    token_hash character varying NOT NULL UNIQUE,
+    expires_at timestamp with time zone NOT NULL,
+    used boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_tokens_user_idx ON user_tokens (user_id, purpose);
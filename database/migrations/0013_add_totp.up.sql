@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id integer NOT NULL,
+    secret character varying NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    code_hash character varying NOT NULL,
+    used boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (id),
+    UNIQUE (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
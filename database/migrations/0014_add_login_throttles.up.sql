@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key character varying NOT NULL,
+    failures integer NOT NULL,
+    last_failure_at timestamp with time zone NOT NULL,
+    blocked_until timestamp with time zone,
+    PRIMARY KEY (key)
+);
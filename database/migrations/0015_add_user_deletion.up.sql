@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at timestamp with time zone;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    status character varying NOT NULL DEFAULT 'pending',
+    progress integer NOT NULL DEFAULT 0,
+    error character varying NOT NULL DEFAULT '',
+    archive bytea,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    completed_at timestamp with time zone,
+    expires_at timestamp with time zone,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS export_jobs_unfinished_idx ON export_jobs (user_id) WHERE status IN ('pending', 'running');
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS contact_list_shares (
+    contact_list integer NOT NULL,
+    user_id integer NOT NULL,
+    role character varying NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (contact_list, user_id),
+    FOREIGN KEY (contact_list) REFERENCES contact_lists (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS contact_list_shares_user_idx ON contact_list_shares (user_id);
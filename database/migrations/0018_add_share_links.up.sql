@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS share_links (
+    id serial NOT NULL,
+    user_id integer NOT NULL,
+    contact_list integer,
+    contact integer,
+    token_hash character varying NOT NULL UNIQUE,
+    password_hash character varying NOT NULL DEFAULT '',
+    fields character varying[] NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    max_views integer NOT NULL DEFAULT 0,
+    views integer NOT NULL DEFAULT 0,
+    revoked boolean NOT NULL DEFAULT false,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    CHECK ((contact_list IS NULL) <> (contact IS NULL)),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (contact_list) REFERENCES contact_lists (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (contact) REFERENCES contacts (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS share_links_user_idx ON share_links (user_id);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id serial NOT NULL,
+    share_link integer NOT NULL,
+    accessed_at timestamp with time zone NOT NULL DEFAULT now(),
+    ip character varying NOT NULL,
+    user_agent character varying NOT NULL,
+    result character varying NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (share_link) REFERENCES share_links (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS share_link_accesses_share_link_idx ON share_link_accesses (share_link);
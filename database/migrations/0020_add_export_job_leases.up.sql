@@ -0,0 +1 @@
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS lease_expires_at timestamp with time zone;
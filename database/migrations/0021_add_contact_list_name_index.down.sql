@@ -0,0 +1 @@
+DROP INDEX IF EXISTS contact_lists_user_id_name_idx;
@@ -0,0 +1,4 @@
+UPDATE contact_lists l SET name = l.name || ' (' || l.id || ')'
+    WHERE EXISTS (SELECT 1 FROM contact_lists o WHERE o.user_id = l.user_id AND o.name = l.name AND o.id < l.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contact_lists_user_id_name_idx ON contact_lists (user_id, name);
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/jobs"
+)
+
+// runExport writes the same archive as the data export of the API does.
+func runExport(args []string) int {
+	flags := newFlagSet("export")
+	userRef := flags.String("user", "", "user to export the data of")
+	output := flags.String("o", "", "file to write the ZIP archive to, standard output by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 || *userRef == "" {
+		return commandUsage("export")
+	}
+
+	database.InitDatabase()
+
+	user, err := findUser(*userRef)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fail("Failed to create the output file, error: " + err.Error())
+		}
+		defer file.Close()
+		w = file
+	}
+
+	err = jobs.BuildExport(database.Database, user.ID, w, func(int) {})
+	if err != nil {
+		if *output != "" {
+			os.Remove(*output)
+		}
+		return fail("Failed to build the export, error: " + err.Error())
+	}
+	return 0
+}
@@ -1,13 +1,16 @@
 module github.com/jafarlihi/addressbook
 
-go 1.14
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/DATA-DOG/go-sqlmock v1.4.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
 	github.com/lib/pq v1.4.0
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
+	gopkg.in/yaml.v3 v3.0.1
 )
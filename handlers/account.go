@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sendUserToken emails the user a new single-use token for the purpose.
+func sendUserToken(user *models.User, purpose string) error {
+	token, userToken, err := services.NewUserToken(user.ID, purpose)
+	if err != nil {
+		return err
+	}
+	err = repositories.CreateUserToken(database.Database, userToken)
+	if err != nil {
+		return err
+	}
+	return mailer.Default.Send(services.UserTokenMessage(user.Email, purpose, token))
+}
+
+// setPassword replaces the password of the user and revokes the refresh
+// tokens and password reset tokens issued with the old one.
+func setPassword(w http.ResponseWriter, userID uint32, password string) bool {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to hash the password"}`)
+		return false
+	}
+
+	err = repositories.UpdateUserPassword(database.Database, userID, string(passwordHash))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the password"}`)
+		return false
+	}
+
+	err = repositories.RevokeRefreshTokensOfUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to revoke the refresh tokens"}`)
+		return false
+	}
+
+	err = repositories.InvalidateUserTokens(database.Database, userID, models.UserTokenPasswordReset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to invalidate the password reset tokens"}`)
+		return false
+	}
+	return true
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Password == "" || body.NewPassword == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Password or newPassword field(s) is/are missing"}`)
+		return
+	}
+
+	if err := services.ValidatePassword(body.NewPassword); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if !checkPassword(w, r, user, body.Password) {
+		return
+	}
+
+	if !setPassword(w, userID, body.NewPassword) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request, body Request) {
+	if body.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Email field is missing"}`)
+		return
+	}
+
+	user, err := repositories.GetUserByEmail(database.Database, body.Email)
+	// Unknown emails get the same response so that the endpoint can't be
+	// used to find out who has an account.
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	err = sendUserToken(user, models.UserTokenPasswordReset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to send the password reset email"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request, body Request) {
+	if body.Token == "" || body.NewPassword == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Token or newPassword field(s) is/are missing"}`)
+		return
+	}
+
+	if err := services.ValidatePassword(body.NewPassword); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	token, err := repositories.UseUserToken(database.Database, models.UserTokenPasswordReset, services.HashUserToken(body.Token))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Password reset token is invalid or has expired"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to use the password reset token"}`)
+		return
+	}
+
+	if !setPassword(w, token.UserID, body.NewPassword) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request, body Request) {
+	if body.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Token field is missing"}`)
+		return
+	}
+
+	token, err := repositories.UseUserToken(database.Database, models.UserTokenEmailVerification, services.HashUserToken(body.Token))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Verification token is invalid or has expired"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to use the verification token"}`)
+		return
+	}
+
+	err = repositories.SetUserEmailVerified(database.Database, token.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to verify the email address"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request, userID uint32) {
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if user.EmailVerified {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Email address is already verified"}`)
+		return
+	}
+
+	err = sendUserToken(user, models.UserTokenEmailVerification)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to send the verification email"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
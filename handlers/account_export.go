@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/jobs"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+type exportJobResponse struct {
+	*models.ExportJob
+	DownloadURL          string     `json:"downloadUrl,omitempty"`
+	DownloadURLExpiresAt *time.Time `json:"downloadUrlExpiresAt,omitempty"`
+}
+
+func writeExportJob(w http.ResponseWriter, status int, job *models.ExportJob) {
+	response := &exportJobResponse{ExportJob: job}
+	if job.Status == models.ExportJobCompleted && job.ExpiresAt != nil && job.ExpiresAt.After(time.Now()) {
+		token, expiresAt, err := services.CreateExportDownloadToken(job.UserID, job.ID, *job.ExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to create the download link"}`)
+			return
+		}
+		response.DownloadURL = fmt.Sprintf("/api/user/export/%d/download?token=%s", job.ID, token)
+		response.DownloadURLExpiresAt = &expiresAt
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func CreateExport(w http.ResponseWriter, r *http.Request, userID uint32) {
+	job, err := repositories.CreateExportJob(database.Database, userID, jobs.ExportJobLease)
+	if err == repositories.ErrExportInProgress {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create the export"}`)
+		return
+	}
+
+	jobs.StartExport(job)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/user/export/%d", job.ID))
+	writeExportJob(w, http.StatusAccepted, job)
+}
+
+func GetExport(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	job, err := repositories.GetExportJob(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested export does not exist"}`)
+		return
+	}
+
+	if job.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't fetch export belonging to another user"}`)
+		return
+	}
+
+	writeExportJob(w, http.StatusOK, job)
+}
+
+// DownloadExport is authorized by the token of the download link instead of
+// the Authorization header, so that the link can be opened in a browser.
+func DownloadExport(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	jobID, err := services.ParseExportDownloadToken(r.URL.Query().Get("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Download link is invalid or has expired"}`)
+		return
+	}
+	if jobID != uint32(id) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Download link is invalid or has expired"}`)
+		return
+	}
+
+	archive, err := repositories.GetExportArchive(database.Database, jobID)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested export does not exist or has expired"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the export"}`)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="addressbook-export-%d.zip"`, jobID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
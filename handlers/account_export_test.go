@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/jobs"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"github.com/lib/pq"
+)
+
+var exportJobColumns = []string{"id", "user_id", "status", "progress", "error", "created_at", "completed_at", "expires_at"}
+
+func TestCreateExport(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	started := make([]*models.ExportJob, 0)
+	previous := jobs.StartExport
+	jobs.StartExport = func(job *models.ExportJob) { started = append(started, job) }
+	defer func() { jobs.StartExport = previous }()
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows(exportJobColumns).AddRow(5, 1, models.ExportJobPending, 0, "", time.Now(), nil, nil)
+	mock.ExpectQuery("^INSERT INTO export_jobs").WithArgs(1, jobs.ExportJobLease.Seconds()).WillReturnRows(rows)
+	mock.ExpectQuery("^INSERT INTO export_jobs").WithArgs(1, jobs.ExportJobLease.Seconds()).WillReturnError(&pq.Error{Code: "23505", Constraint: "export_jobs_unfinished_idx"})
+
+	for _, expectedStatus := range []int{http.StatusAccepted, http.StatusConflict} {
+		req, err := http.NewRequest("POST", "/api/user/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(started) != 1 || started[0].ID != 5 {
+		t.Errorf("Handler started unexpected jobs: %v", started)
+	}
+}
+
+func TestGetAndDownloadExport(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	now := time.Now()
+	rows := sqlmock.NewRows(exportJobColumns).AddRow(5, 1, models.ExportJobCompleted, 100, "", now, now, now.Add(time.Hour))
+	mock.ExpectQuery("^SELECT (.+) FROM export_jobs WHERE id = \\$1").WithArgs(5).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT archive FROM export_jobs").WithArgs(5, models.ExportJobCompleted).
+		WillReturnRows(sqlmock.NewRows([]string{"archive"}).AddRow([]byte("PK")))
+
+	req, err := http.NewRequest("GET", "/api/user/export/5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response struct {
+		Status      string `json:"status"`
+		DownloadURL string `json:"downloadUrl"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Status != models.ExportJobCompleted || response.DownloadURL == "" {
+		t.Fatalf("Handler returned unexpected body: got %v", rr.Body.String())
+	}
+
+	for _, test := range []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/api/user/export/5/download?token=invalid", http.StatusUnauthorized},
+		{"/api/user/export/6/download?" + response.DownloadURL[len("/api/user/export/5/download?"):], http.StatusUnauthorized},
+		{response.DownloadURL, http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code for %s: got %v want %v", test.url, status, test.expectedStatus)
+		}
+		if test.expectedStatus == http.StatusOK && (rr.Header().Get("Content-Type") != "application/zip" || rr.Body.String() != "PK") {
+			t.Errorf("Handler returned unexpected archive: %v", rr.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
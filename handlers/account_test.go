@@ -0,0 +1,164 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type recordingMailer struct {
+	messages []*mailer.Message
+}
+
+func (m *recordingMailer) Send(message *mailer.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func useRecordingMailer(t *testing.T) *recordingMailer {
+	recorder := &recordingMailer{}
+	previous := mailer.Default
+	mailer.Default = recorder
+	t.Cleanup(func() { mailer.Default = previous })
+	return recorder
+}
+
+func TestForgotPassword(t *testing.T) {
+	recorder := useRecordingMailer(t)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE email = \\$1").WithArgs("valid@mail.com").WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO user_tokens").WithArgs(1, models.UserTokenPasswordReset, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE email = \\$1").WithArgs("unknown@mail.com").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	for _, email := range []string{"valid@mail.com", "unknown@mail.com"} {
+		req, err := http.NewRequest("POST", "/api/user/password/forgot", strings.NewReader(`{"email": "`+email+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(recorder.messages) != 1 || recorder.messages[0].To != "valid@mail.com" {
+		t.Fatalf("Handler sent unexpected emails: %v", recorder.messages)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	tokenHash := services.HashUserToken("reset-token")
+	rows := sqlmock.NewRows([]string{"id", "user_id", "purpose", "token_hash", "expires_at", "used"}).
+		AddRow(1, 1, models.UserTokenPasswordReset, tokenHash, time.Now().Add(time.Hour), true)
+	mock.ExpectQuery("^UPDATE user_tokens SET used = true").WithArgs(tokenHash, models.UserTokenPasswordReset).WillReturnRows(rows)
+	mock.ExpectExec("^UPDATE users SET password = \\$2").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE refresh_tokens SET revoked = true WHERE user_id = \\$1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE user_tokens SET used = true WHERE user_id = \\$1").WithArgs(1, models.UserTokenPasswordReset).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^UPDATE user_tokens SET used = true").WithArgs(tokenHash, models.UserTokenPasswordReset).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "purpose", "token_hash", "expires_at", "used"}))
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusBadRequest} {
+		req, err := http.NewRequest("POST", "/api/user/password/reset", strings.NewReader(`{"token": "reset-token", "newPassword": "new-password"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestChangePasswordWithWrongPassword(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", string(passwordHash), true, nil, false)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"account:1","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("account:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("ip:", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	req, err := http.NewRequest("POST", "/api/user/password", strings.NewReader(`{"password": "wrong-password", "newPassword": "new-password"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Wrong password"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
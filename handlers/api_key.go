@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+const maxAPIKeyNameLength = 64
+
+type apiKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+func CreateAPIKey(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	name := strings.TrimSpace(body.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Name field can't be empty or longer than `+strconv.Itoa(maxAPIKeyNameLength)+` characters"}`)
+		return
+	}
+
+	if len(body.Scopes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Scopes field is missing"}`)
+		return
+	}
+	scopes, err := services.NormalizeScopes(body.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "ExpiresAt has to be in the future"}`)
+		return
+	}
+
+	key, prefix, hash, err := services.NewAPIKey()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to generate the API key"}`)
+		return
+	}
+
+	apiKey := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: body.ExpiresAt,
+	}
+	err = repositories.CreateAPIKey(database.Database, apiKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create the API key"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(&apiKeyResponse{APIKey: apiKey, Key: key})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func GetAPIKeys(w http.ResponseWriter, r *http.Request, userID uint32) {
+	apiKeys, err := repositories.GetAPIKeysByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the API keys"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(apiKeys)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func DeleteAPIKey(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	apiKey, err := repositories.GetAPIKey(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested API key does not exist"}`)
+		return
+	}
+
+	if apiKey.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't delete API key belonging to another user"}`)
+		return
+	}
+
+	err = repositories.DeleteAPIKey(database.Database, apiKey.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to delete the API key"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
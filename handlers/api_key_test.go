@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^INSERT INTO api_keys").
+		WithArgs(1, "cron", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"contacts:read"}`, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+	req, err := http.NewRequest("POST", "/api/user/api-keys", strings.NewReader(`{"name": "cron", "scopes": ["contacts:read"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal("Response couldn't be parsed as JSON")
+	}
+	key, _ := response["key"].(string)
+	if !strings.HasPrefix(key, response["prefix"].(string)) || len(key) <= len(response["prefix"].(string)) {
+		t.Errorf("Handler returned unexpected key %v with prefix %v", response["key"], response["prefix"])
+	}
+	if _, ok := response["KeyHash"]; ok {
+		t.Error("Handler returned the hash of the key")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateAPIKeyWithPastExpiry(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("POST", "/api/user/api-keys", strings.NewReader(`{"name": "cron", "scopes": ["contacts:read"], "expiresAt": "2000-01-01T00:00:00Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "ExpiresAt has to be in the future"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestAuthenticateWithAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	columns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "created_at"}
+	mock.ExpectQuery("^UPDATE api_keys SET last_used_at = now\\(\\)").
+		WithArgs(services.HashAPIKey("abk_valid")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 1, "cron", "abk_vali", "hash", "{account}", nil, time.Now(), time.Now()))
+	mock.ExpectQuery("^SELECT (.+) FROM api_keys WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery("^UPDATE api_keys SET last_used_at = now\\(\\)").
+		WithArgs(services.HashAPIKey("abk_expired")).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	for _, test := range []struct {
+		key            string
+		expectedStatus int
+	}{{"abk_valid", http.StatusOK}, {"abk_expired", http.StatusUnauthorized}} {
+		req, err := http.NewRequest("GET", "/api/user/api-keys", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "ApiKey "+test.key)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, test.expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuthenticateWithMissingScope(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", []string{services.ScopeContactsRead})
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("DELETE", "/api/contact/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	expected := `{"error": "Missing scope contacts:write"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
@@ -4,28 +4,51 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"regexp"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
 	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
 )
 
 func CreateContact(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
-	if body.Name == "" || body.Surname == "" || body.Email == "" {
+	contact := &models.Contact{
+		UserID:       userID,
+		Name:         body.Name,
+		Surname:      body.Surname,
+		Email:        body.Email,
+		PhoneNumbers: body.PhoneNumbers,
+		Emails:       body.Emails,
+		Addresses:    body.Addresses,
+		Notes:        body.Notes,
+		Birthday:     body.Birthday,
+		CustomFields: body.CustomFields,
+	}
+
+	err := services.ValidateContact(contact)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Name, surname, and/or email field(s) is/are missing"}`)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
 		return
 	}
 
-	if !regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`).MatchString(body.Email) {
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	err = services.ValidateCustomFieldValues(contact, customFields)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Provided email address is malformed"}`)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
 		return
 	}
 
-	id, err := repositories.CreateContact(database.Database, userID, body.Name, body.Surname, body.Email)
+	id, err := repositories.CreateContact(database.Database, contact)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to create the contact"}`)
@@ -71,14 +94,27 @@ func DeleteContact(w http.ResponseWriter, r *http.Request, userID uint32) {
 }
 
 func GetContacts(w http.ResponseWriter, r *http.Request, userID uint32) {
-	contacts, err := repositories.GetContactsByUserID(database.Database, userID)
+	options, err := parseListOptions(r, repositories.ContactSortColumns, repositories.ContactFilters)
+	if err == nil {
+		err = parseTagFilter(r, options)
+	}
+	if err == nil {
+		err = parseCustomFieldFilter(r, userID, options)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	page, err := repositories.ListContactsByUserID(database.Database, userID, options)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to get the contacts"}`)
 		return
 	}
 
-	jsonResponse, err := json.Marshal(contacts)
+	jsonResponse, err := json.Marshal(page)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
@@ -112,6 +148,13 @@ func GetContact(w http.ResponseWriter, r *http.Request, userID uint32) {
 		return
 	}
 
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{contact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
 	jsonResponse, err := json.Marshal(contact)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -122,3 +165,215 @@ func GetContact(w http.ResponseWriter, r *http.Request, userID uint32) {
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(jsonResponse))
 }
+
+func UpdateContact(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contact := &models.Contact{
+		ID:           uint32(id),
+		UserID:       userID,
+		Name:         body.Name,
+		Surname:      body.Surname,
+		Email:        body.Email,
+		PhoneNumbers: body.PhoneNumbers,
+		Emails:       body.Emails,
+		Addresses:    body.Addresses,
+		Notes:        body.Notes,
+		Birthday:     body.Birthday,
+		CustomFields: body.CustomFields,
+	}
+
+	err = services.ValidateContact(contact)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	err = services.ValidateCustomFieldValues(contact, customFields)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	existingContact, err := repositories.GetContact(database.Database, contact.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
+		return
+	}
+
+	if existingContact.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't update contact belonging to another user"}`)
+		return
+	}
+	contact.VCardExtra = existingContact.VCardExtra
+
+	err = repositories.UpdateContact(database.Database, contact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the contact"}`)
+		return
+	}
+
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{contact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(contact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func PatchContact(w http.ResponseWriter, r *http.Request, userID uint32, patch []byte) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contact, err := repositories.GetContact(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
+		return
+	}
+
+	if contact.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't update contact belonging to another user"}`)
+		return
+	}
+
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{contact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
+	document, err := json.Marshal(contact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the contact to JSON"}`)
+		return
+	}
+
+	patched, err := services.MergePatch(document, patch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Failed to apply the merge patch"}`)
+		return
+	}
+
+	// Fields explicitly set to null are dropped by the merge patch, so they
+	// come back as zero values here and fail the validation below.
+	var patchedContact models.Contact
+	err = json.Unmarshal(patched, &patchedContact)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Patched contact has fields of wrong type"}`)
+		return
+	}
+	patchedContact.ID = contact.ID
+	patchedContact.UserID = contact.UserID
+	patchedContact.VCardExtra = contact.VCardExtra
+
+	// Patching only the email field replaces the primary email rather than
+	// being overwritten by the unchanged list of emails.
+	var patchFields map[string]json.RawMessage
+	json.Unmarshal(patch, &patchFields)
+	if _, emailsPatched := patchFields["emails"]; !emailsPatched && patchedContact.Email != contact.Email {
+		for _, email := range patchedContact.Emails {
+			if email != nil && email.Primary {
+				email.Address = patchedContact.Email
+			}
+		}
+	}
+
+	err = services.NormalizeContactEmails(&patchedContact)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if patchedContact.Name == "" || patchedContact.Surname == "" || patchedContact.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Name, surname, and/or email field(s) can't be null or empty"}`)
+		return
+	}
+
+	err = services.ValidateContactDetails(&patchedContact)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	err = services.ValidateCustomFieldValues(&patchedContact, customFields)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	err = repositories.UpdateContact(database.Database, &patchedContact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the contact"}`)
+		return
+	}
+
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{&patchedContact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(patchedContact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
 	"github.com/jafarlihi/addressbook/repositories"
 	"github.com/jafarlihi/addressbook/services"
 )
@@ -20,6 +21,11 @@ func CreateContactList(w http.ResponseWriter, r *http.Request, userID uint32, bo
 	}
 
 	id, err := repositories.CreateContactList(database.Database, userID, body.Name)
+	if err == repositories.ErrContactListNameTaken {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to create the contact-list"}`)
@@ -41,20 +47,12 @@ func DeleteContactList(w http.ResponseWriter, r *http.Request, userID uint32) {
 		return
 	}
 
-	contactList, err := repositories.GetContactList(database.Database, uint32(id))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionManage, "delete")
+	if !ok {
 		return
 	}
 
-	if contactList.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't delete contact-list belonging to another user"}`)
-		return
-	}
-
-	err = repositories.DeleteContactList(database.Database, uint32(id))
+	err = repositories.DeleteContactList(database.Database, contactList.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to delete the contact-list"}`)
@@ -65,21 +63,37 @@ func DeleteContactList(w http.ResponseWriter, r *http.Request, userID uint32) {
 }
 
 func GetContactLists(w http.ResponseWriter, r *http.Request, userID uint32) {
-	userID, err := services.ParseAuthorizationHeader(r.Header.Get("Authorization"))
+	options, err := parseListOptions(r, repositories.ContactListSortColumns, repositories.ContactListFilters)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
 		return
 	}
 
-	contactLists, err := repositories.GetContactListsByUserID(database.Database, userID)
+	page, err := repositories.ListContactListsByUserID(database.Database, userID, options)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to get the contact-lists"}`)
 		return
 	}
 
-	jsonResponse, err := json.Marshal(contactLists)
+	sharedWithMe, err := repositories.GetContactListsSharedWithUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the shared contact-lists"}`)
+		return
+	}
+
+	// The page only holds the user's own lists, lists shared with them are
+	// few enough to be returned in full alongside every page.
+	response := struct {
+		*models.Page
+		SharedWithMe []*models.SharedContactList `json:"sharedWithMe"`
+	}{
+		page,
+		sharedWithMe,
+	}
+	jsonResponse, err := json.Marshal(response)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
@@ -99,16 +113,8 @@ func GetContactList(w http.ResponseWriter, r *http.Request, userID uint32) {
 		return
 	}
 
-	contactList, err := repositories.GetContactList(database.Database, uint32(id))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
-		return
-	}
-
-	if contactList.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't fetch contact-list belonging to another user"}`)
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionRead, "fetch")
+	if !ok {
 		return
 	}
 
@@ -151,27 +157,32 @@ func GetContactsOfContactList(w http.ResponseWriter, r *http.Request, userID uin
 		return
 	}
 
-	contactList, err := repositories.GetContactList(database.Database, uint32(id))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionRead, "fetch")
+	if !ok {
 		return
 	}
 
-	if contactList.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't fetch contact-list belonging to another user"}`)
+	options, err := parseListOptions(r, repositories.ContactSortColumns, repositories.ContactFilters)
+	if err == nil {
+		err = parseTagFilter(r, options)
+	}
+	if err == nil {
+		err = parseCustomFieldFilter(r, contactList.UserID, options)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
 		return
 	}
 
-	contacts, err := repositories.GetContactsOfContactList(database.Database, contactList.ID)
+	page, err := repositories.ListContactsOfContactList(database.Database, contactList.ID, options)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to fetch contacts"}`)
 		return
 	}
 
-	jsonResponse, err := json.Marshal(contacts)
+	jsonResponse, err := json.Marshal(page)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
@@ -197,16 +208,8 @@ func AddToContactList(w http.ResponseWriter, r *http.Request, userID uint32, bod
 		return
 	}
 
-	contactList, err := repositories.GetContactList(database.Database, uint32(id))
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
-		return
-	}
-
-	if contactList.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't fetch contact-list belonging to another user"}`)
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionEdit, "update")
+	if !ok {
 		return
 	}
 
@@ -216,9 +219,11 @@ func AddToContactList(w http.ResponseWriter, r *http.Request, userID uint32, bod
 		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
 		return
 	}
+	// Editors add their own contacts, never the owner's, which they could
+	// otherwise read through the list by guessing their IDs.
 	if contact.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't fetch contact belonging to another user"}`)
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error": "Can only add your own contacts to a contact-list"}`)
 		return
 	}
 
@@ -248,25 +253,90 @@ func RemoveFromContactList(w http.ResponseWriter, r *http.Request, userID uint32
 		return
 	}
 
-	contactList, err := repositories.GetContactList(database.Database, uint32(id))
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionEdit, "update")
+	if !ok {
+		return
+	}
+
+	err = repositories.DeleteContactFromContactList(database.Database, contactList.ID, body.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to add contact to contact-list"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func PatchContactList(w http.ResponseWriter, r *http.Request, userID uint32, patch []byte) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionManage, "update")
+	if !ok {
+		return
+	}
+
+	document, err := json.Marshal(contactList)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the contact-list to JSON"}`)
+		return
+	}
+
+	patched, err := services.MergePatch(document, patch)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
+		io.WriteString(w, `{"error": "Failed to apply the merge patch"}`)
 		return
 	}
 
-	if contactList.UserID != userID {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "Can't fetch contact-list belonging to another user"}`)
+	var patchedContactList models.ContactList
+	err = json.Unmarshal(patched, &patchedContactList)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Patched contact-list has fields of wrong type"}`)
 		return
 	}
+	patchedContactList.ID = contactList.ID
+	patchedContactList.UserID = contactList.UserID
 
-	err = repositories.DeleteContactFromContactList(database.Database, contactList.ID, body.ID)
+	if patchedContactList.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Name field can't be null or empty"}`)
+		return
+	}
+
+	if !services.IsColorValid(patchedContactList.Color) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Color has to be in #rrggbb format"}`)
+		return
+	}
+
+	err = repositories.UpdateContactList(database.Database, patchedContactList.ID, patchedContactList.Name, patchedContactList.Description, patchedContactList.Color, patchedContactList.Archived)
+	if err == repositories.ErrContactListNameTaken {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		io.WriteString(w, `{"error": "Failed to add contact to contact-list"}`)
+		io.WriteString(w, `{"error": "Failed to update the contact-list"}`)
 		return
 	}
 
+	jsonResponse, err := json.Marshal(patchedContactList)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
 }
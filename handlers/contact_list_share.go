@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func ShareContactList(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Username == "" && body.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Username and email fields are missing, at least one is required"}`)
+		return
+	}
+
+	if !services.IsShareableRole(body.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Role has to be one of viewer or editor"}`)
+		return
+	}
+
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionManage, "share")
+	if !ok {
+		return
+	}
+
+	var user *models.User
+	if body.Username != "" {
+		user, err = repositories.GetUserByUsername(database.Database, body.Username)
+	} else {
+		user, err = repositories.GetUserByEmail(database.Database, body.Email)
+	}
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested user does not exist"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if user.ID == contactList.UserID {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Can't share contact-list with its owner"}`)
+		return
+	}
+
+	err = repositories.ShareContactList(database.Database, contactList.ID, user.ID, body.Role)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to share the contact-list"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(&models.ContactListShare{
+		ContactListID: contactList.ID,
+		UserID:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Role:          body.Role,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func GetContactListShares(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionManage, "fetch shares of")
+	if !ok {
+		return
+	}
+
+	shares, err := repositories.GetContactListShares(database.Database, contactList.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact-list shares"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(shares)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+// UnshareContactList revokes the access of a user to the contact-list. The
+// owner can revoke anyone's, the others can only give up their own.
+func UnshareContactList(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	id, err := strconv.ParseUint(params["id"], 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+	sharedUserID, err := strconv.ParseUint(params["userID"], 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided user ID can't be parsed as an integer"}`)
+		return
+	}
+
+	permission := services.PermissionManage
+	if uint32(sharedUserID) == userID {
+		permission = services.PermissionRead
+	}
+	contactList, ok := authorizeContactList(w, uint32(id), userID, permission, "revoke shares of")
+	if !ok {
+		return
+	}
+
+	deleted, err := repositories.DeleteContactListShare(database.Database, contactList.ID, uint32(sharedUserID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to revoke the contact-list share"}`)
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Contact-list isn't shared with the requested user"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,196 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+var contactListColumns = []string{"id", "user_id", "name", "description", "color", "archived"}
+
+func TestSharedContactListPermissions(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(2, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	tests := []struct {
+		method         string
+		url            string
+		body           string
+		sharedRole     string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"GET", "/api/contact-list/1", "", services.ContactListViewer, http.StatusOK, ""},
+		{"POST", "/api/contact-list/1/contact", `{"id": 5}`, services.ContactListViewer, http.StatusForbidden, `{"error": "Can't update contact-list shared with you as viewer"}`},
+		{"POST", "/api/contact-list/1/contact", `{"id": 5}`, services.ContactListEditor, http.StatusForbidden, `{"error": "Can only add your own contacts to a contact-list"}`},
+		{"DELETE", "/api/contact-list/1/contact", `{"id": 5}`, services.ContactListEditor, http.StatusOK, ""},
+		{"DELETE", "/api/contact-list/1", "", services.ContactListEditor, http.StatusForbidden, `{"error": "Can't delete contact-list shared with you as editor"}`},
+		{"GET", "/api/contact-list/1", "", "", http.StatusUnauthorized, `{"error": "Can't fetch contact-list belonging to another user"}`},
+	}
+	for _, test := range tests {
+		rows := sqlmock.NewRows(contactListColumns).AddRow(1, 1, "Friends", "", "", false)
+		mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+		if test.sharedRole == "" {
+			mock.ExpectQuery("^SELECT role FROM contact_list_shares").WithArgs(1, 2).WillReturnError(sql.ErrNoRows)
+		} else {
+			mock.ExpectQuery("^SELECT role FROM contact_list_shares").WithArgs(1, 2).WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(test.sharedRole))
+		}
+		if test.sharedRole == services.ContactListEditor && test.method == "POST" {
+			mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE id = \\$1").WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(5, 1, "John", "Doe", "", "", "", ""))
+		}
+		if test.expectedStatus == http.StatusOK && test.method == "DELETE" {
+			mock.ExpectQuery("^DELETE FROM contact_list_entries").WithArgs(1, 5).WillReturnRows(sqlmock.NewRows([]string{}))
+		}
+
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code for %s %s: got %v want %v", test.method, test.url, status, test.expectedStatus)
+		}
+		if test.expectedBody != "" && rr.Body.String() != test.expectedBody {
+			t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), test.expectedBody)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestShareContactList(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(contactListColumns).AddRow(1, 1, "Friends", "", "", false))
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE email = \\$1").WithArgs("friend@mail.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(2, "friend", "friend@mail.com", "hash", true, nil, false))
+	mock.ExpectExec("^INSERT INTO contact_list_shares").WithArgs(1, 2, services.ContactListEditor).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, err := http.NewRequest("POST", "/api/contact-list/1/shares", strings.NewReader(`{"email": "friend@mail.com", "role": "editor"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	var share struct {
+		UserID   uint32 `json:"userID"`
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &share)
+	if share.UserID != 2 || share.Username != "friend" || share.Role != services.ContactListEditor {
+		t.Errorf("Handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestUnshareContactListAsSharedUser(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(2, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	for _, sharedUserID := range []uint32{2, 3} {
+		mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE id = \\$1").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(contactListColumns).AddRow(1, 1, "Friends", "", "", false))
+		mock.ExpectQuery("^SELECT role FROM contact_list_shares").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(services.ContactListViewer))
+		if sharedUserID == 2 {
+			mock.ExpectBegin()
+			mock.ExpectExec("^DELETE FROM contact_list_shares").WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("^DELETE FROM contact_list_entries WHERE contact_list = \\$1 AND contact IN \\(SELECT id FROM contacts WHERE user_id = \\$2\\)").
+				WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectCommit()
+		}
+	}
+
+	for _, test := range []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/api/contact-list/1/shares/2", http.StatusOK},
+		{"/api/contact-list/1/shares/3", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("DELETE", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code for %s: got %v want %v", test.url, status, test.expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -6,12 +6,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jafarlihi/addressbook/config"
 	"github.com/jafarlihi/addressbook/database"
 	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"github.com/lib/pq"
 )
 
 func TestCreateContactListNoBody(t *testing.T) {
@@ -23,6 +26,9 @@ func TestCreateContactListNoBody(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -59,6 +65,9 @@ func TestCreateContactListWithNoNameField(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -118,6 +127,9 @@ func TestCreateContactList(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -160,6 +172,50 @@ func TestCreateContactList(t *testing.T) {
 	}
 }
 
+func TestCreateContactListWithDuplicateName(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^INSERT INTO contact_lists").WithArgs(1, "name").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "contact_lists_user_id_name_idx"})
+
+	req, err := http.NewRequest("POST", "/api/contact-list", strings.NewReader(`{"name": "name"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	expected := `{"error": "Another contact-list with this name already exists"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
 func TestDeleteContactListWithNoToken(t *testing.T) {
 	req, err := http.NewRequest("DELETE", "/api/contact-list/1", strings.NewReader(""))
 	if err != nil {
@@ -192,6 +248,9 @@ func TestDeleteContactList(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -206,7 +265,7 @@ func TestDeleteContactList(t *testing.T) {
 
 	database.Database = db
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(contactListID, userID, name)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "description", "color", "archived"}).AddRow(contactListID, userID, name, "", "", false)
 	mock.ExpectQuery("^SELECT (.*) FROM contact_lists").WithArgs(contactListID).WillReturnRows(rows)
 	mock.ExpectQuery("^DELETE FROM contact_lists").WithArgs(contactListID).WillReturnRows(rows)
 
@@ -234,3 +293,123 @@ func TestDeleteContactList(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestPatchContactList(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactListID uint32
+	contactListID = 2
+	name := "name"
+	newName := "newName"
+	color := "#00ff00"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "description", "color", "archived"}).AddRow(contactListID, userID, name, "description", "", false)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_lists WHERE id").WithArgs(contactListID).WillReturnRows(rows)
+	mock.ExpectExec("^UPDATE contact_lists").WithArgs(contactListID, newName, "", color, true).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req, err := http.NewRequest("PATCH", "/api/contact-list/"+fmt.Sprint(contactListID), strings.NewReader(`{"name": "`+newName+`", "description": null, "color": "`+color+`", "archived": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"id":` + fmt.Sprint(contactListID) + `,"userID":` + fmt.Sprint(userID) + `,"name":"` + newName + `","description":"","color":"` + color + `","archived":true}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchContactListWithDuplicateName(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactListID uint32
+	contactListID = 2
+	name := "name"
+	otherName := "otherName"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "description", "color", "archived"}).AddRow(contactListID, userID, name, "", "", false)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_lists WHERE id").WithArgs(contactListID).WillReturnRows(rows)
+	mock.ExpectExec("^UPDATE contact_lists").WithArgs(contactListID, otherName, "", "", false).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "contact_lists_user_id_name_idx"})
+
+	req, err := http.NewRequest("PATCH", "/api/contact-list/"+fmt.Sprint(contactListID), strings.NewReader(`{"name": "`+otherName+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	expected := `{"error": "Another contact-list with this name already exists"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/repositories"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func SearchContacts(w http.ResponseWriter, r *http.Request, userID uint32) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Query parameter q is missing"}`)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": "Limit has to be an integer between 1 and `+strconv.Itoa(maxSearchLimit)+`"}`)
+			return
+		}
+	}
+
+	results, err := repositories.SearchContacts(database.Database, userID, query, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to search the contacts"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(results)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -6,12 +6,14 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jafarlihi/addressbook/config"
 	"github.com/jafarlihi/addressbook/database"
 	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
 )
 
 func TestCreateContactNoBody(t *testing.T) {
@@ -23,6 +25,9 @@ func TestCreateContactNoBody(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -59,6 +64,9 @@ func TestCreateContactWithMissingField(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -86,6 +94,45 @@ func TestCreateContactWithMissingField(t *testing.T) {
 	}
 }
 
+func TestCreateContactWithTwoPrimaryEmails(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("POST", "/api/contact", strings.NewReader(`{"name": "name", "surname": "surname", "emails": [{"address": "first@mail.com", "primary": true}, {"address": "second@mail.com", "primary": true}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Only one email can be marked as primary"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
 func TestCreateContactWithNoAuthorizationHeader(t *testing.T) {
 	req, err := http.NewRequest("POST", "/api/contact", strings.NewReader(`{"name": "name", "surname": "surname", "email": "email@mail.com"}`))
 	if err != nil {
@@ -120,6 +167,9 @@ func TestCreateContact(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -135,7 +185,11 @@ func TestCreateContact(t *testing.T) {
 	database.Database = db
 
 	rows := sqlmock.NewRows([]string{"id"}).AddRow(contactID)
-	mock.ExpectQuery("^INSERT INTO contacts").WithArgs(userID, name, surname, email).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM custom_fields").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "required", "options"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO contacts").WithArgs(userID, name, surname, email, "", "", "", name+" "+surname+" "+email).WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(contactID, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	req, err := http.NewRequest("POST", "/api/contact", strings.NewReader(`{"name": "`+name+`", "surname": "`+surname+`", "email": "`+email+`"}`))
 	if err != nil {
@@ -176,6 +230,9 @@ func TestDeleteContact(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -190,7 +247,7 @@ func TestDeleteContact(t *testing.T) {
 
 	database.Database = db
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email"}).AddRow(contactID, userID, name, surname, email)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, name, surname, email, "", "", "")
 	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
 	mock.ExpectQuery("^DELETE FROM contacts").WithArgs(contactID).WillReturnRows(rows)
 
@@ -235,6 +292,9 @@ func TestDeleteContactBelongingToAnotherUser(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -249,7 +309,7 @@ func TestDeleteContactBelongingToAnotherUser(t *testing.T) {
 
 	database.Database = db
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email"}).AddRow(contactID, userID2, name, surname, email)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID2, name, surname, email, "", "", "")
 	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
 
 	req, err := http.NewRequest("DELETE", "/api/contact/"+fmt.Sprint(contactID), strings.NewReader(""))
@@ -276,3 +336,426 @@ func TestDeleteContactBelongingToAnotherUser(t *testing.T) {
 		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestUpdateContact(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+	name := "name"
+	surname := "surname"
+	email := "valid@mail.com"
+	newSurname := "newSurname"
+	phoneNumber := "+1 555 0100"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, name, surname, email, "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM custom_fields").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "required", "options"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE contacts").WithArgs(contactID, name, newSurname, email, "", "", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_phone_numbers").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_emails").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_addresses").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_custom_values").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO contact_phone_numbers").WithArgs(contactID, "mobile", phoneNumber).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(contactID, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}).AddRow(3, contactID, "mobile", phoneNumber))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(4, contactID, "", email, true))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("PUT", "/api/contact/"+fmt.Sprint(contactID), strings.NewReader(`{"name": "`+name+`", "surname": "`+newSurname+`", "email": "`+email+`", "phoneNumbers": [{"label": "mobile", "number": "`+phoneNumber+`"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"id":` + fmt.Sprint(contactID) + `,"userID":` + fmt.Sprint(userID) + `,"name":"` + name + `","surname":"` + newSurname + `","email":"` + email + `","phoneNumbers":[{"id":3,"label":"mobile","number":"` + phoneNumber + `"}],"emails":[{"id":4,"label":"","address":"` + email + `","primary":true}],"addresses":[],"notes":"","birthday":"","tags":[],"customFields":{}}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchContact(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+	name := "name"
+	surname := "surname"
+	email := "valid@mail.com"
+	newSurname := "newSurname"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, name, surname, email, "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(3, contactID, "", email, true))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+	mock.ExpectQuery("^SELECT (.*) FROM custom_fields").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "required", "options"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE contacts").WithArgs(contactID, name, newSurname, email, "", "", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_phone_numbers").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_emails").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_addresses").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_custom_values").WithArgs(contactID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(contactID, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(4, contactID, "", email, true))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("PATCH", "/api/contact/"+fmt.Sprint(contactID), strings.NewReader(`{"surname": "`+newSurname+`", "id": 99}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"id":` + fmt.Sprint(contactID) + `,"userID":` + fmt.Sprint(userID) + `,"name":"` + name + `","surname":"` + newSurname + `","email":"` + email + `","phoneNumbers":[],"emails":[{"id":4,"label":"","address":"` + email + `","primary":true}],"addresses":[],"notes":"","birthday":"","tags":[],"customFields":{}}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchContactWithNullField(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+	name := "name"
+	surname := "surname"
+	email := "valid@mail.com"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, name, surname, email, "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(3, contactID, "", email, true))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("PATCH", "/api/contact/"+fmt.Sprint(contactID), strings.NewReader(`{"surname": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Name, surname, and/or email field(s) can't be null or empty"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestGetContactsPage(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT COUNT\\(\\*\\) FROM contacts WHERE user_id").WithArgs(userID, "j").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(2, userID, "John", "Doe", "john@mail.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts WHERE (.*) ORDER BY name DESC, id LIMIT 11$").WithArgs(userID, "j").WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("GET", "/api/contact?limit=10&sort=-name&name_prefix=j", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"items":[{"id":2,"userID":1,"name":"John","surname":"Doe","email":"john@mail.com","phoneNumbers":[],"emails":[],"addresses":[],"notes":"","birthday":"","tags":[],"customFields":{}}],"next":null,"total":1}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestGetContactsWithUnknownSortColumn(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("GET", "/api/contact?sort=password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Can't sort by password"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestSearchContactsWithNoQuery(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("GET", "/api/contact/search?q=", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Query parameter q is missing"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestAddContactTags(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, "John", "Doe", "john@mail.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO tags").WithArgs(userID, "family").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec("^INSERT INTO contact_tags").WithArgs(contactID, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}).AddRow(contactID, "family"))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("POST", "/api/contact/"+fmt.Sprint(contactID)+"/tags", strings.NewReader(`{"tags": [" family ", "family"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"id":2,"userID":1,"name":"John","surname":"Doe","email":"john@mail.com","phoneNumbers":[],"emails":[],"addresses":[],"notes":"","birthday":"","tags":["family"],"customFields":{}}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
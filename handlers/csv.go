@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func ImportCSV(w http.ResponseWriter, r *http.Request, userID uint32) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Request body couldn't be parsed as multipart form"}`)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "File field is missing"}`)
+		return
+	}
+	defer file.Close()
+
+	mapping := make(services.CSVMapping)
+	preset := r.FormValue("preset")
+	if preset != "" {
+		presetMapping, ok := services.CSVPresets[preset]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": "Unknown preset, it has to be either google or outlook"}`)
+			return
+		}
+		for header, field := range presetMapping {
+			mapping[header] = field
+		}
+	}
+
+	if customMapping := r.FormValue("mapping"); customMapping != "" {
+		err = json.Unmarshal([]byte(customMapping), &mapping)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": "Mapping field couldn't be parsed as a JSON object"}`)
+			return
+		}
+	}
+
+	if len(mapping) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Preset and mapping fields are missing, at least one is required"}`)
+		return
+	}
+
+	err = mapping.Validate()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	dryRun := r.FormValue("dryRun") == "true"
+
+	var contactListID uint32
+	if contactListIDString := r.FormValue("contactListID"); contactListIDString != "" {
+		id, err := strconv.ParseUint(contactListIDString, 10, 32)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": "Provided contact-list ID can't be parsed as an integer"}`)
+			return
+		}
+
+		contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionEdit, "import into")
+		if !ok {
+			return
+		}
+		contactListID = contactList.ID
+	}
+
+	rows, err := services.ParseCSVContacts(file, mapping)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	valid := 0
+	imported := make([]int64, 0)
+	errors := make([]*importError, 0)
+	for _, row := range rows {
+		if row.Err != nil {
+			errors = append(errors, &importError{Row: row.Row, Error: row.Err.Error()})
+			continue
+		}
+
+		row.Contact.UserID = userID
+		err := services.ValidateContact(row.Contact)
+		if err == nil {
+			err = services.ValidateCustomFieldValues(row.Contact, customFields)
+		}
+		if err != nil {
+			errors = append(errors, &importError{Row: row.Row, Error: err.Error()})
+			continue
+		}
+		valid++
+		if dryRun {
+			continue
+		}
+
+		id, err := repositories.CreateContact(database.Database, row.Contact)
+		if err != nil {
+			errors = append(errors, &importError{Row: row.Row, Error: "Failed to create the contact"})
+			continue
+		}
+		imported = append(imported, id)
+
+		if contactListID != 0 {
+			err = repositories.AddContactToContactList(database.Database, contactListID, uint32(id))
+			if err != nil {
+				errors = append(errors, &importError{Row: row.Row, Error: "Failed to add contact to contact-list"})
+			}
+		}
+	}
+
+	response := struct {
+		DryRun   bool           `json:"dryRun"`
+		Valid    int            `json:"valid"`
+		Imported []int64        `json:"imported"`
+		Errors   []*importError `json:"errors"`
+	}{
+		dryRun,
+		valid,
+		imported,
+		errors,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestImportCSVDryRun(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT (.*) FROM custom_fields").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "required", "options"}))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("preset", "outlook")
+	writer.WriteField("mapping", `{"Company Email": "email.2.address"}`)
+	writer.WriteField("dryRun", "true")
+	file, err := writer.CreateFormFile("file", "contacts.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("First Name,Last Name,E-mail Address,Company Email\nJohn,Doe,john@mail.com,john@company.com\nJane,Roe,invalid,\n"))
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/api/contact/import/csv", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"dryRun":true,"valid":1,"imported":[],"errors":[{"row":3,"error":"Provided email address is malformed"}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+const maxCustomFieldNameLength = 64
+
+var customFieldTypes = []string{models.CustomFieldString, models.CustomFieldNumber, models.CustomFieldDate, models.CustomFieldBool, models.CustomFieldEnum}
+
+func validateCustomField(field *models.CustomField) error {
+	field.Name = strings.TrimSpace(field.Name)
+	if field.Name == "" || len(field.Name) > maxCustomFieldNameLength {
+		return errors.New("Name field can't be empty or longer than " + strconv.Itoa(maxCustomFieldNameLength) + " characters")
+	}
+	if !containsString(customFieldTypes, field.Type) {
+		return errors.New("Type has to be one of string, number, date, bool, or enum")
+	}
+	if field.Options == nil {
+		field.Options = make([]string, 0)
+	}
+	if field.Type == models.CustomFieldEnum && len(field.Options) == 0 {
+		return errors.New("Enum custom fields need at least one option")
+	}
+	if field.Type != models.CustomFieldEnum && len(field.Options) != 0 {
+		return errors.New("Only enum custom fields can have options")
+	}
+	for _, option := range field.Options {
+		if option == "" {
+			return errors.New("Options can't be empty")
+		}
+	}
+	return nil
+}
+
+// parseCustomFieldFilter reads "custom.<name>" query parameters, which filter
+// contacts by the value of one of the user's custom fields.
+func parseCustomFieldFilter(r *http.Request, userID uint32, options *repositories.ListOptions) error {
+	filters := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if strings.HasPrefix(key, "custom.") {
+			filters[strings.TrimPrefix(key, "custom.")] = values[0]
+		}
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		return errors.New("Failed to get the custom fields")
+	}
+	definitions := make(map[string]*models.CustomField, len(customFields))
+	for _, field := range customFields {
+		definitions[field.Name] = field
+	}
+
+	options.CustomFields = make(map[string]interface{}, len(filters))
+	for name, text := range filters {
+		field, ok := definitions[name]
+		if !ok {
+			return errors.New("Unknown custom field " + name)
+		}
+		var value interface{} = text
+		switch field.Type {
+		case models.CustomFieldNumber:
+			value, err = strconv.ParseFloat(text, 64)
+		case models.CustomFieldBool:
+			value, err = strconv.ParseBool(text)
+		}
+		if err == nil {
+			err = services.ValidateCustomFieldValue(field, value)
+		}
+		if err != nil {
+			return errors.New("Custom field " + name + " can't be filtered by " + text)
+		}
+		options.CustomFields[name] = value
+	}
+	return nil
+}
+
+func CreateCustomField(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	field := &models.CustomField{
+		UserID:   userID,
+		Name:     body.Name,
+		Type:     body.Type,
+		Required: body.Required,
+		Options:  body.Options,
+	}
+
+	err := validateCustomField(field)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	_, err = repositories.GetCustomFieldByName(database.Database, userID, field.Name)
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "Another custom field with this name already exists"}`)
+		return
+	}
+	if err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to check for custom fields with the same name"}`)
+		return
+	}
+
+	id, err := repositories.CreateCustomField(database.Database, field)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create the custom field"}`)
+		return
+	}
+
+	jsonResponse, _ := json.Marshal(map[string]int64{"id": id})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func GetCustomFields(w http.ResponseWriter, r *http.Request, userID uint32) {
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(customFields)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func PatchCustomField(w http.ResponseWriter, r *http.Request, userID uint32, patch []byte) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	field, err := repositories.GetCustomField(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested custom field does not exist"}`)
+		return
+	}
+
+	if field.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't update custom field belonging to another user"}`)
+		return
+	}
+
+	document, err := json.Marshal(field)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the custom field to JSON"}`)
+		return
+	}
+
+	patched, err := services.MergePatch(document, patch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Failed to apply the merge patch"}`)
+		return
+	}
+
+	var patchedField models.CustomField
+	err = json.Unmarshal(patched, &patchedField)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Patched custom field has fields of wrong type"}`)
+		return
+	}
+	patchedField.ID = field.ID
+	patchedField.UserID = field.UserID
+
+	if patchedField.Type != field.Type {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Type of a custom field can't be changed"}`)
+		return
+	}
+
+	err = validateCustomField(&patchedField)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if patchedField.Name != field.Name {
+		existing, err := repositories.GetCustomFieldByName(database.Database, userID, patchedField.Name)
+		if err == nil && existing.ID != field.ID {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error": "Another custom field with this name already exists"}`)
+			return
+		}
+		if err != nil && err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to check for custom fields with the same name"}`)
+			return
+		}
+	}
+
+	err = repositories.UpdateCustomField(database.Database, &patchedField)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the custom field"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(patchedField)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func DeleteCustomField(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	field, err := repositories.GetCustomField(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested custom field does not exist"}`)
+		return
+	}
+
+	if field.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't delete custom field belonging to another user"}`)
+		return
+	}
+
+	err = repositories.DeleteCustomField(database.Database, field.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to delete the custom field"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,18 +1,63 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/repositories"
 	"github.com/jafarlihi/addressbook/services"
 )
 
-func Authenticated(w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request, uint32)) {
-	userID, err := services.ParseAuthorizationHeader(r.Header.Get("Authorization"))
+// authenticate returns the user a request is made by and the scopes granted
+// to it, authenticated either with a bearer access token or with an API key.
+func authenticate(r *http.Request) (uint32, []string, error) {
+	header := r.Header.Get("Authorization")
+	key, ok := services.ParseAPIKeyHeader(header)
+	if !ok {
+		token, err := services.ParseAccessToken(header)
+		if err != nil {
+			return 0, nil, err
+		}
+		return token.UserID, token.Scopes, nil
+	}
+
+	apiKey, err := repositories.UseAPIKey(database.Database, services.HashAPIKey(key))
+	if err == sql.ErrNoRows {
+		return 0, nil, errors.New("API key is invalid or has expired")
+	}
+	if err != nil {
+		return 0, nil, errors.New("Failed to check the API key")
+	}
+	return apiKey.UserID, apiKey.Scopes, nil
+}
+
+// authorize authenticates the request and checks that it has been granted
+// the scopes, writing the error response if not.
+func authorize(w http.ResponseWriter, r *http.Request, scopes []string) (uint32, bool) {
+	userID, granted, err := authenticate(r)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return 0, false
+	}
+
+	if missing := services.MissingScope(granted, scopes); missing != "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+missing+`"`)
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error": "Missing scope `+missing+`"}`)
+		return 0, false
+	}
+	return userID, true
+}
+
+func Authenticated(w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request, uint32), scopes ...string) {
+	userID, ok := authorize(w, r, scopes)
+	if !ok {
 		return
 	}
 
@@ -31,7 +76,7 @@ func WithRequestBody(w http.ResponseWriter, r *http.Request, f func(http.Respons
 	f(w, r, body)
 }
 
-func AuthenticatedWithRequestBody(w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request, uint32, Request)) {
+func AuthenticatedWithRequestBody(w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request, uint32, Request), scopes ...string) {
 	var body Request
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
@@ -40,10 +85,24 @@ func AuthenticatedWithRequestBody(w http.ResponseWriter, r *http.Request, f func
 		return
 	}
 
-	userID, err := services.ParseAuthorizationHeader(r.Header.Get("Authorization"))
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+	userID, ok := authorize(w, r, scopes)
+	if !ok {
+		return
+	}
+
+	f(w, r, userID, body)
+}
+
+func AuthenticatedWithRawRequestBody(w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request, uint32, []byte), scopes ...string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Request body couldn't be parsed as JSON"}`)
+		return
+	}
+
+	userID, ok := authorize(w, r, scopes)
+	if !ok {
 		return
 	}
 
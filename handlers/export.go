@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+var defaultExportColumns = []string{"id", "name", "surname", "email", "phone.mobile", "phone.work", "phone.home", "emails", "addresses", "notes", "birthday", "tags"}
+
+// Multi-valued columns are joined the same way Google Contacts does it, so
+// exported files can be imported back with a matching mapping.
+const exportValueSeparator = " ::: "
+
+var exportColumns = map[string]func(*models.Contact) string{
+	"id":      func(c *models.Contact) string { return fmt.Sprint(c.ID) },
+	"name":    func(c *models.Contact) string { return c.Name },
+	"surname": func(c *models.Contact) string { return c.Surname },
+	"email":   func(c *models.Contact) string { return c.Email },
+	"phone.mobile": func(c *models.Contact) string {
+		return joinPhoneNumbers(c, "mobile")
+	},
+	"phone.work": func(c *models.Contact) string {
+		return joinPhoneNumbers(c, "work")
+	},
+	"phone.home": func(c *models.Contact) string {
+		return joinPhoneNumbers(c, "home")
+	},
+	"emails": func(c *models.Contact) string {
+		emails := make([]string, 0, len(c.Emails))
+		for _, email := range c.Emails {
+			emails = append(emails, email.Address)
+		}
+		return strings.Join(emails, exportValueSeparator)
+	},
+	"addresses": func(c *models.Contact) string {
+		addresses := make([]string, 0, len(c.Addresses))
+		for _, address := range c.Addresses {
+			parts := make([]string, 0, 5)
+			for _, part := range []string{address.Street, address.City, address.Region, address.Postcode, address.Country} {
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			addresses = append(addresses, strings.Join(parts, ", "))
+		}
+		return strings.Join(addresses, exportValueSeparator)
+	},
+	"notes":    func(c *models.Contact) string { return c.Notes },
+	"birthday": func(c *models.Contact) string { return c.Birthday },
+	"tags":     func(c *models.Contact) string { return strings.Join(c.Tags, exportValueSeparator) },
+}
+
+func joinPhoneNumbers(contact *models.Contact, label string) string {
+	numbers := make([]string, 0)
+	for _, phoneNumber := range contact.PhoneNumbers {
+		if phoneNumber.Label == label {
+			numbers = append(numbers, phoneNumber.Number)
+		}
+	}
+	return strings.Join(numbers, exportValueSeparator)
+}
+
+// exportWriter writes contacts one at a time as CSV or NDJSON, depending on
+// the Accept header, and flushes every 100 contacts so the response streams.
+// Every write extends the write deadline, as large exports can take longer
+// than the server's write timeout.
+type exportWriter struct {
+	w       http.ResponseWriter
+	csv     *csv.Writer
+	json    *json.Encoder
+	columns []string
+	count   int
+}
+
+func newExportWriter(w http.ResponseWriter, r *http.Request) (*exportWriter, error) {
+	if !strings.Contains(r.Header.Get("Accept"), "csv") {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return &exportWriter{w: w, json: json.NewEncoder(w)}, nil
+	}
+
+	columns := defaultExportColumns
+	if columnsParam := r.URL.Query().Get("columns"); columnsParam != "" {
+		columns = strings.Split(columnsParam, ",")
+		for _, column := range columns {
+			if _, ok := exportColumns[column]; !ok {
+				return nil, fmt.Errorf("Unknown column %s", column)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	return &exportWriter{w: w, csv: csv.NewWriter(w), columns: columns}, nil
+}
+
+func (e *exportWriter) start() error {
+	extendWriteDeadline(e.w)
+	e.w.WriteHeader(http.StatusOK)
+	if e.csv != nil {
+		return e.csv.Write(e.columns)
+	}
+	return nil
+}
+
+func (e *exportWriter) write(contact *models.Contact) error {
+	extendWriteDeadline(e.w)
+	var err error
+	if e.csv != nil {
+		record := make([]string, len(e.columns))
+		for i, column := range e.columns {
+			record[i] = exportColumns[column](contact)
+		}
+		err = e.csv.Write(record)
+	} else {
+		err = e.json.Encode(contact)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%100 == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	extendWriteDeadline(e.w)
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func ExportContacts(w http.ResponseWriter, r *http.Request, userID uint32) {
+	writer, err := newExportWriter(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if err := writer.start(); err != nil {
+		return
+	}
+	err = repositories.StreamContactsByUserID(database.Database, userID, writer.write)
+	if err != nil {
+		logger.Log.Error("Failed to stream the contacts export, error: " + err.Error())
+	}
+	writer.flush()
+}
+
+func ExportContactsOfContactList(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionRead, "fetch")
+	if !ok {
+		return
+	}
+
+	writer, err := newExportWriter(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if err := writer.start(); err != nil {
+		return
+	}
+	err = repositories.StreamContactsOfContactList(database.Database, contactList.ID, writer.write)
+	if err != nil {
+		logger.Log.Error("Failed to stream the contact-list export, error: " + err.Error())
+	}
+	writer.flush()
+}
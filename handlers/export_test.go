@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestExportContactsCSV(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(2, userID, "John", "Doe", "john@mail.com", "", "", "").
+		AddRow(3, userID, "Jane", "Roe, Jr.", "jane@mail.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts WHERE user_id").WithArgs(userID, 0).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}).AddRow(1, 2, "work", "555 0100").AddRow(2, 2, "work", "555 0101"))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("GET", "/api/contact?columns=name,surname,phone.work", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+	req.Header.Add("Accept", "text/csv")
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := "name,surname,phone.work\nJohn,Doe,555 0100 ::: 555 0101\nJane,\"Roe, Jr.\",\n"
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExportContactsWithUnknownColumn(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	req, err := http.NewRequest("GET", "/api/contact?columns=name,password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+	req.Header.Add("Accept", "text/csv")
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	expected := `{"error": "Unknown column password"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExportContactsOutlastsWriteTimeout(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+	config.Config.HttpServer.WriteTimeout = "200ms"
+	defer func() { config.Config.HttpServer.WriteTimeout = "" }()
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	// The contacts take longer to fetch than the write timeout allows.
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(2, 1, "John", "Doe", "john@mail.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts WHERE user_id").WithArgs(1, 0).WillDelayFor(300 * time.Millisecond).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	testServer := httptest.NewUnstartedServer(router.ConstructRouter())
+	testServer.Config.WriteTimeout = 200 * time.Millisecond
+	testServer.Start()
+	defer testServer.Close()
+
+	req, err := http.NewRequest("GET", testServer.URL+"/api/contact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+	req.Header.Add("Accept", "application/x-ndjson")
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Export was cut off: %s", err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil || !strings.Contains(string(body), `"name":"John"`) {
+		t.Errorf("Export was cut off: %q, %v", body, err)
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// GetJWKS publishes the public keys access tokens can be verified with, so
+// other services don't need to share a secret with the API.
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(services.GetJSONWebKeySet())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
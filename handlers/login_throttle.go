@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// clientIP is the address of the peer, or if the peer is a trusted proxy the
+// client address it forwarded. X-Forwarded-For is read from the right,
+// skipping the trusted proxies, so that addresses the client put in the
+// header itself are never taken.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !trustedProxy(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !trustedProxy(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// trustedProxy tells if the address is one of httpServer.trustedProxies,
+// which are IP addresses or CIDR ranges.
+func trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range config.Config.HttpServer.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLoginThrottle writes a 429 response if logging in is blocked for any
+// of the throttle keys.
+func checkLoginThrottle(w http.ResponseWriter, keys []string) bool {
+	blockedUntil, err := repositories.GetLoginBlockedUntil(database.Database, keys)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to check the failed login attempts"}`)
+		return false
+	}
+
+	if wait := time.Until(blockedUntil); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error": "Too many failed login attempts, try again later"}`)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt for each of the throttle keys,
+// blocking logging in for the ones that have failed too often. Failing to
+// record is only logged by the repository, the attempt has failed anyway.
+func recordLoginFailure(keys []string) {
+	for _, key := range keys {
+		failures, err := repositories.RecordLoginFailure(database.Database, key, services.LoginFailureWindow)
+		if err != nil {
+			continue
+		}
+		if duration := services.LoginBlockDuration(key, failures); duration > 0 {
+			repositories.BlockLogin(database.Database, key, time.Now().Add(duration))
+		}
+	}
+}
+
+// checkPassword compares the password a logged in user confirms an action
+// with, counting wrong ones like failed logins so that tokens can't be used
+// to guess it. It writes the error response if the password is wrong or
+// checking is blocked.
+func checkPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	accountKey := services.AccountThrottleKey(user.ID)
+	throttleKeys := []string{accountKey, services.IPThrottleKey(clientIP(r))}
+	if !checkLoginThrottle(w, throttleKeys) {
+		return false
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		recordLoginFailure(throttleKeys)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Wrong password"}`)
+		return false
+	}
+	repositories.DeleteLoginThrottle(database.Database, accountKey)
+	return true
+}
+
+func writeInvalidCredentials(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnauthorized)
+	io.WriteString(w, `{"error": "Invalid credentials"}`)
+}
@@ -0,0 +1,143 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+)
+
+func TestCreateTokenWithUnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs("Unknown").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"login:unknown","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("login:unknown", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("ip:", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	req, err := http.NewRequest("POST", "/api/user/token", strings.NewReader(`{"username": "Unknown", "password": "password"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	expected := `{"error": "Invalid credentials"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestCreateTokenWhileBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false))
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"account:1","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(90 * time.Second)))
+
+	req, err := http.NewRequest("POST", "/api/user/token", strings.NewReader(`{"username": "user", "password": "password"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusTooManyRequests {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "90" {
+		t.Errorf("Handler returned unexpected Retry-After: %v", retryAfter)
+	}
+}
+
+func TestCreateTokenThrottlesForwardedClients(t *testing.T) {
+	config.Config.HttpServer.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	defer func() { config.Config.HttpServer.TrustedProxies = nil }()
+
+	tests := []struct {
+		remoteAddr string
+		headers    map[string]string
+		ip         string
+	}{
+		{"203.0.113.9:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.9"},
+		{"10.0.0.2:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.5, 192.0.2.1"}, "203.0.113.5"},
+		{"10.0.0.2:4000", map[string]string{"X-Forwarded-For": "not-an-ip, 10.0.0.3"}, "10.0.0.3"},
+		{"192.0.2.1:4000", map[string]string{"X-Real-IP": "203.0.113.7"}, "203.0.113.7"},
+		{"10.0.0.2:4000", nil, "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+		}
+
+		database.Database = db
+
+		mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs("user").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false))
+		mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"account:1","ip:` + test.ip + `"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(time.Minute)))
+
+		req, err := http.NewRequest("POST", "/api/user/token", strings.NewReader(`{"username": "user", "password": "password"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = test.remoteAddr
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations for %s %v: %s", test.remoteAddr, test.headers, err)
+		}
+
+		if status := rr.Code; status != http.StatusTooManyRequests {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+		}
+		db.Close()
+	}
+}
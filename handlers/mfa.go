@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+	"github.com/skip2/go-qrcode"
+)
+
+const totpQRCodeSize = 256
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func verifySecondFactor(credential *models.TOTPCredential, code string) (bool, error) {
+	if step, ok := services.VerifyTOTP(credential.Secret, code, time.Now()); ok {
+		return repositories.UseTOTPStep(database.Database, credential.UserID, step)
+	}
+	return repositories.UseRecoveryCode(database.Database, credential.UserID, services.HashRecoveryCode(code))
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	jsonResponse, err := json.Marshal(map[string][]string{"recoveryCodes": codes})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+// respondWithMFAChallenge is sent instead of tokens to users with TOTP
+// enabled, the challenge token is exchanged at ExchangeMFAToken.
+func respondWithMFAChallenge(w http.ResponseWriter, userID uint32, scopes []string) {
+	mfaToken, err := services.CreateMFAToken(userID, scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create token"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(&mfaChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int64(services.MFATokenLifetime / time.Second),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the response to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func ExchangeMFAToken(w http.ResponseWriter, r *http.Request, body Request) {
+	if body.MFAToken == "" || body.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "MFAToken or code field(s) is/are missing"}`)
+		return
+	}
+
+	token, err := services.ParseMFAToken(body.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	mfaKey := services.MFAThrottleKey(token.UserID)
+	throttleKeys := []string{mfaKey, services.IPThrottleKey(clientIP(r))}
+	if !checkLoginThrottle(w, throttleKeys) {
+		return
+	}
+
+	credential, err := repositories.GetTOTPCredential(database.Database, token.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the TOTP credential"}`)
+		return
+	}
+	if err == sql.ErrNoRows || !credential.Enabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Two-factor authentication isn't enabled"}`)
+		return
+	}
+
+	valid, err := verifySecondFactor(credential, body.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to verify the code"}`)
+		return
+	}
+	if !valid {
+		recordLoginFailure(throttleKeys)
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Wrong code"}`)
+		return
+	}
+	repositories.DeleteLoginThrottle(database.Database, mfaKey)
+
+	user, err := repositories.GetUser(database.Database, token.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if !checkUserEnabled(w, user) {
+		return
+	}
+
+	respondWithTokens(w, user, token.Scopes)
+}
+
+func EnrollTOTP(w http.ResponseWriter, r *http.Request, userID uint32) {
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	secret, err := services.NewTOTPSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to generate the TOTP secret"}`)
+		return
+	}
+
+	err = repositories.SetPendingTOTPCredential(database.Database, userID, secret)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "Two-factor authentication is already enabled"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to store the TOTP secret"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(map[string]string{"secret": secret, "uri": services.TOTPURI(user.Username, secret)})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+// getPendingTOTPCredential returns the TOTP credential of the user that's
+// yet to be confirmed, writing the error response if there is none.
+func getPendingTOTPCredential(w http.ResponseWriter, userID uint32) (*models.TOTPCredential, bool) {
+	credential, err := repositories.GetTOTPCredential(database.Database, userID)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Two-factor authentication hasn't been set up"}`)
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the TOTP credential"}`)
+		return nil, false
+	}
+	if credential.Enabled {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "Two-factor authentication is already enabled"}`)
+		return nil, false
+	}
+	return credential, true
+}
+
+func GetTOTPQRCode(w http.ResponseWriter, r *http.Request, userID uint32) {
+	credential, ok := getPendingTOTPCredential(w, userID)
+	if !ok {
+		return
+	}
+
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	png, err := qrcode.Encode(services.TOTPURI(user.Username, credential.Secret), qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to encode the QR code"}`)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Code field is missing"}`)
+		return
+	}
+
+	credential, ok := getPendingTOTPCredential(w, userID)
+	if !ok {
+		return
+	}
+
+	mfaKey := services.MFAThrottleKey(userID)
+	throttleKeys := []string{mfaKey, services.IPThrottleKey(clientIP(r))}
+	if !checkLoginThrottle(w, throttleKeys) {
+		return
+	}
+
+	step, valid := services.VerifyTOTP(credential.Secret, body.Code, time.Now())
+	if valid {
+		var err error
+		valid, err = repositories.UseTOTPStep(database.Database, userID, step)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to verify the code"}`)
+			return
+		}
+	}
+	if !valid {
+		recordLoginFailure(throttleKeys)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Wrong code"}`)
+		return
+	}
+	repositories.DeleteLoginThrottle(database.Database, mfaKey)
+
+	codes, hashes, err := services.NewRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to generate the recovery codes"}`)
+		return
+	}
+
+	err = repositories.EnableTOTPCredential(database.Database, userID, hashes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to enable two-factor authentication"}`)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+// getEnabledTOTPCredential returns the TOTP credential of the user if it has
+// been enabled and the code is valid, writing the error response if not.
+// Wrong codes are throttled like those entered when logging in.
+func getEnabledTOTPCredential(w http.ResponseWriter, r *http.Request, userID uint32, code string) (*models.TOTPCredential, bool) {
+	credential, err := repositories.GetTOTPCredential(database.Database, userID)
+	if err != nil && err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the TOTP credential"}`)
+		return nil, false
+	}
+	if err == sql.ErrNoRows || !credential.Enabled {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Two-factor authentication isn't enabled"}`)
+		return nil, false
+	}
+
+	mfaKey := services.MFAThrottleKey(userID)
+	throttleKeys := []string{mfaKey, services.IPThrottleKey(clientIP(r))}
+	if !checkLoginThrottle(w, throttleKeys) {
+		return nil, false
+	}
+
+	valid, err := verifySecondFactor(credential, code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to verify the code"}`)
+		return nil, false
+	}
+	if !valid {
+		recordLoginFailure(throttleKeys)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Wrong code"}`)
+		return nil, false
+	}
+	repositories.DeleteLoginThrottle(database.Database, mfaKey)
+	return credential, true
+}
+
+func DisableTOTP(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Password == "" || body.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Password or code field(s) is/are missing"}`)
+		return
+	}
+
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if !checkPassword(w, r, user, body.Password) {
+		return
+	}
+
+	if _, ok := getEnabledTOTPCredential(w, r, userID, body.Code); !ok {
+		return
+	}
+
+	err = repositories.DeleteTOTPCredential(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to disable two-factor authentication"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Code field is missing"}`)
+		return
+	}
+
+	if _, ok := getEnabledTOTPCredential(w, r, userID, body.Code); !ok {
+		return
+	}
+
+	codes, hashes, err := services.NewRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to generate the recovery codes"}`)
+		return
+	}
+
+	err = repositories.ReplaceRecoveryCodes(database.Database, userID, hashes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to replace the recovery codes"}`)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
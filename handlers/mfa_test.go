@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const totpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCreateTokenWithTOTP(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE username = \\$1").WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", string(passwordHash), true, nil, false))
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("^DELETE FROM login_throttles").WithArgs("account:1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM totp_credentials").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step"}).AddRow(1, totpSecret, true, 0))
+
+	req, err := http.NewRequest("POST", "/api/user/token", strings.NewReader(`{"username": "user", "password": "password", "scopes": ["contacts:read"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	var response struct {
+		MFARequired bool   `json:"mfaRequired"`
+		MFAToken    string `json:"mfaToken"`
+		Token       string `json:"token"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if rr.Code != http.StatusOK || !response.MFARequired || response.Token != "" {
+		t.Fatalf("Handler didn't return an MFA challenge: %v", rr.Body.String())
+	}
+	token, err := services.ParseMFAToken(response.MFAToken)
+	if err != nil || token.UserID != 1 || len(token.Scopes) != 1 {
+		t.Errorf("Handler returned an unusable MFA token: %v", err)
+	}
+}
+
+func TestExchangeMFAToken(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	mfaToken, err := services.CreateMFAToken(1, []string{services.ScopeContactsRead})
+	if err != nil {
+		t.Fatal("Failed to create MFA token")
+	}
+	step := services.TOTPStep(time.Now())
+	code, _ := services.TOTPCode(totpSecret, step)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	credentialColumns := []string{"user_id", "secret", "enabled", "last_used_step"}
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"mfa:1","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^SELECT (.+) FROM totp_credentials").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(credentialColumns).AddRow(1, totpSecret, true, 0))
+	mock.ExpectExec("^UPDATE totp_credentials SET last_used_step").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM login_throttles").WithArgs("mfa:1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false))
+	mock.ExpectExec("^INSERT INTO refresh_tokens").WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"contacts:read"}`, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^SELECT (.+) FROM totp_credentials").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(credentialColumns).AddRow(1, totpSecret, true, step))
+	mock.ExpectExec("^UPDATE totp_credentials SET last_used_step").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("mfa:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("ip:", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusUnauthorized} {
+		req, err := http.NewRequest("POST", "/api/user/token/mfa", strings.NewReader(`{"mfaToken": "`+mfaToken+`", "code": "`+code+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v, body: %v", status, expectedStatus, rr.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegenerateRecoveryCodesWhileBlocked(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^SELECT (.+) FROM totp_credentials").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step"}).AddRow(1, totpSecret, true, 0))
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"mfa:1","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(time.Minute)))
+
+	req, err := http.NewRequest("POST", "/api/user/mfa/recovery-codes", strings.NewReader(`{"code": "123456"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusTooManyRequests {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jafarlihi/addressbook/repositories"
+)
+
+// parseListOptions reads the limit, after, and sort query parameters of a
+// list endpoint together with the filters it supports.
+func parseListOptions(r *http.Request, sortColumns []string, filters []string) (*repositories.ListOptions, error) {
+	query := r.URL.Query()
+	options := &repositories.ListOptions{Limit: repositories.DefaultListLimit, Filters: make(map[string]string)}
+
+	if limitString := query.Get("limit"); limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > repositories.MaxListLimit {
+			return nil, errors.New("Limit has to be an integer between 1 and " + strconv.Itoa(repositories.MaxListLimit))
+		}
+		options.Limit = limit
+	}
+
+	sort, err := repositories.ParseSort(query.Get("sort"), sortColumns)
+	if err != nil {
+		return nil, err
+	}
+	options.Sort = sort
+
+	if after := query.Get("after"); after != "" {
+		options.After, err = repositories.DecodeCursor(after, sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filter := range filters {
+		if value := query.Get(filter); value != "" {
+			options.Filters[filter] = value
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// authorizeContactList fetches the contact-list and checks that the user's
+// role on it allows the permission, writing the error response if not. The
+// action is what the error response says the user can't do.
+func authorizeContactList(w http.ResponseWriter, id uint32, userID uint32, permission services.Permission, action string) (*models.ContactList, bool) {
+	contactList, err := repositories.GetContactList(database.Database, id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact-list does not exist"}`)
+		return nil, false
+	}
+
+	sharedRole := ""
+	if contactList.UserID != userID {
+		sharedRole, err = repositories.GetContactListShareRole(database.Database, contactList.ID, userID)
+		if err != nil && err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to get the contact-list share"}`)
+			return nil, false
+		}
+	}
+
+	role := services.ContactListRole(contactList, userID, sharedRole)
+	if role == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't `+action+` contact-list belonging to another user"}`)
+		return nil, false
+	}
+	if !services.HasPermission(role, permission) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error": "Can't `+action+` contact-list shared with you as `+role+`"}`)
+		return nil, false
+	}
+	return contactList, true
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// profile holds the fields of a user that can be changed by patching it.
+type profile struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func writeUser(w http.ResponseWriter, user *models.User) {
+	user.Password = ""
+	jsonResponse, err := json.Marshal(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request, userID uint32) {
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	writeUser(w, user)
+}
+
+func PatchProfile(w http.ResponseWriter, r *http.Request, userID uint32, patch []byte) {
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	document, err := json.Marshal(&profile{Username: user.Username, Email: user.Email})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the user to JSON"}`)
+		return
+	}
+
+	patched, err := services.MergePatch(document, patch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Failed to apply the merge patch"}`)
+		return
+	}
+
+	var patchedProfile profile
+	err = json.Unmarshal(patched, &patchedProfile)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Patched user has fields of wrong type"}`)
+		return
+	}
+	patchedProfile.Username = strings.TrimSpace(patchedProfile.Username)
+	patchedProfile.Email = strings.TrimSpace(patchedProfile.Email)
+
+	if patchedProfile.Username == "" || patchedProfile.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Username and email can't be empty"}`)
+		return
+	}
+
+	if !services.IsEmailValid(patchedProfile.Email) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided email address is malformed"}`)
+		return
+	}
+
+	// A new email address has to be verified again.
+	emailChanged := patchedProfile.Email != user.Email
+	emailVerified := user.EmailVerified && !emailChanged
+
+	err = repositories.UpdateUserProfile(database.Database, userID, patchedProfile.Username, patchedProfile.Email, emailVerified)
+	if err == repositories.ErrUsernameTaken || err == repositories.ErrEmailTaken {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the user"}`)
+		return
+	}
+	user.Username = patchedProfile.Username
+	user.Email = patchedProfile.Email
+	user.EmailVerified = emailVerified
+
+	if emailChanged {
+		// Tokens sent to the old address mustn't verify the new one, and
+		// failing to send the new one is only logged as it can be resent.
+		err = repositories.InvalidateUserTokens(database.Database, userID, models.UserTokenEmailVerification)
+		if err == nil {
+			err = sendUserToken(user, models.UserTokenEmailVerification)
+		}
+		if err != nil {
+			logger.Log.Error("Failed to send the verification email, error: " + err.Error())
+		}
+	}
+
+	writeUser(w, user)
+}
+
+// DeleteAccount schedules the user to be deleted once the grace period has
+// passed, until then the account keeps working and can be restored.
+func DeleteAccount(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	if body.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Password field is missing"}`)
+		return
+	}
+
+	user, err := repositories.GetUser(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	if !checkPassword(w, r, user, body.Password) {
+		return
+	}
+
+	deleteAt := time.Now().Add(services.AccountDeletionGracePeriod)
+	scheduled, err := repositories.ScheduleUserDeletion(database.Database, userID, deleteAt)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to schedule the deletion of the user"}`)
+		return
+	}
+	if !scheduled {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "Deletion of the user is already scheduled"}`)
+		return
+	}
+
+	err = mailer.Default.Send(services.AccountDeletionMessage(user.Email, deleteAt))
+	if err != nil {
+		logger.Log.Error("Failed to send the account deletion email, error: " + err.Error())
+	}
+
+	jsonResponse, err := json.Marshal(map[string]time.Time{"deletionScheduledAt": deleteAt})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func RestoreAccount(w http.ResponseWriter, r *http.Request, userID uint32) {
+	cancelled, err := repositories.CancelUserDeletion(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to cancel the deletion of the user"}`)
+		return
+	}
+	if !cancelled {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Deletion of the user isn't scheduled"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,263 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestGetProfile(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+
+	req, err := http.NewRequest("GET", "/api/user/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	var user models.User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	if user.Username != "user" || user.Email != "valid@mail.com" || user.Password != "" {
+		t.Errorf("Handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestPatchProfileWithNewEmail(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+	recorder := useRecordingMailer(t)
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+	mock.ExpectExec("^UPDATE users SET username = \\$2, email = \\$3, email_verified = \\$4").WithArgs(1, "user", "new@mail.com", false).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE user_tokens SET used = true WHERE user_id = \\$1").WithArgs(1, models.UserTokenEmailVerification).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO user_tokens").WithArgs(1, models.UserTokenEmailVerification, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req, err := http.NewRequest("PATCH", "/api/user/me", strings.NewReader(`{"email": "new@mail.com", "password": "ignored"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	var user models.User
+	json.Unmarshal(rr.Body.Bytes(), &user)
+	if user.Email != "new@mail.com" || user.EmailVerified {
+		t.Errorf("Handler returned unexpected body: got %v", rr.Body.String())
+	}
+
+	if len(recorder.messages) != 1 || recorder.messages[0].To != "new@mail.com" {
+		t.Fatalf("Handler sent unexpected emails: %v", recorder.messages)
+	}
+}
+
+func TestPatchProfileWithTakenUsername(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false)
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+	mock.ExpectExec("^UPDATE users SET username = \\$2").WithArgs(1, "taken", "valid@mail.com", true).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_username_key"})
+
+	req, err := http.NewRequest("PATCH", "/api/user/me", strings.NewReader(`{"username": "taken"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	expected := `{"error": "Another user with this username already exists"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+	recorder := useRecordingMailer(t)
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	for _, affected := range []int64{-1, 1, 0} {
+		rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", string(passwordHash), true, nil, false)
+		mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).WillReturnRows(rows)
+		mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"account:1","ip:"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+		if affected < 0 {
+			mock.ExpectQuery("^INSERT INTO login_throttles").WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+			mock.ExpectQuery("^INSERT INTO login_throttles").WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+		} else {
+			mock.ExpectExec("^DELETE FROM login_throttles").WithArgs("account:1").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("^UPDATE users SET deletion_scheduled_at = \\$2").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, affected))
+		}
+	}
+
+	for _, test := range []struct {
+		password       string
+		expectedStatus int
+	}{
+		{"wrong-password", http.StatusBadRequest},
+		{"password", http.StatusOK},
+		{"password", http.StatusConflict},
+	} {
+		req, err := http.NewRequest("DELETE", "/api/user/me", strings.NewReader(`{"password": "`+test.password+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, test.expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(recorder.messages) != 1 || recorder.messages[0].To != "valid@mail.com" {
+		t.Fatalf("Handler sent unexpected emails: %v", recorder.messages)
+	}
+}
+
+func TestRestoreAccount(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectExec("^UPDATE users SET deletion_scheduled_at = NULL").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE users SET deletion_scheduled_at = NULL").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusBadRequest} {
+		req, err := http.NewRequest("POST", "/api/user/me/restore", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
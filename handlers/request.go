@@ -1,11 +1,37 @@
 package handlers
 
+import (
+	"time"
+
+	"github.com/jafarlihi/addressbook/models"
+)
+
 type Request struct {
-	Name     string `json:"name"`
-	Surname  string `json:"surname"`
-	Email    string `json:"email"`
-	Term     string `json:"term"`
-	ID       uint32 `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Name         string                  `json:"name"`
+	Surname      string                  `json:"surname"`
+	Email        string                  `json:"email"`
+	Term         string                  `json:"term"`
+	ID           uint32                  `json:"id"`
+	Username     string                  `json:"username"`
+	Password     string                  `json:"password"`
+	NewPassword  string                  `json:"newPassword"`
+	Token        string                  `json:"token"`
+	Code         string                  `json:"code"`
+	MFAToken     string                  `json:"mfaToken"`
+	RefreshToken string                  `json:"refreshToken"`
+	PhoneNumbers []*models.PhoneNumber   `json:"phoneNumbers"`
+	Emails       []*models.EmailAddress  `json:"emails"`
+	Addresses    []*models.PostalAddress `json:"addresses"`
+	Notes        string                  `json:"notes"`
+	Birthday     string                  `json:"birthday"`
+	Tags         []string                `json:"tags"`
+	Type         string                  `json:"type"`
+	Required     bool                    `json:"required"`
+	Options      []string                `json:"options"`
+	CustomFields map[string]interface{}  `json:"customFields"`
+	ExpiresAt    *time.Time              `json:"expiresAt"`
+	Scopes       []string                `json:"scopes"`
+	Role         string                  `json:"role"`
+	Fields       []string                `json:"fields"`
+	MaxViews     int                     `json:"maxViews"`
 }
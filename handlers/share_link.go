@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type shareLinkResponse struct {
+	*models.ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// createShareLink creates a share link of either the contact-list or the
+// contact, responding with its token, which is only shown this once.
+func createShareLink(w http.ResponseWriter, userID uint32, contactListID *uint32, contactID *uint32, body Request) {
+	fields, err := services.NormalizeShareLinkFields(body.Fields)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	expiresAt := time.Now().Add(services.DefaultShareLinkLifetime)
+	if body.ExpiresAt != nil {
+		expiresAt = *body.ExpiresAt
+	}
+	if !expiresAt.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "ExpiresAt has to be in the future"}`)
+		return
+	}
+	if expiresAt.After(time.Now().Add(services.MaxShareLinkLifetime)) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "ExpiresAt can't be more than 90 days in the future"}`)
+		return
+	}
+
+	if body.MaxViews < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "MaxViews can't be negative"}`)
+		return
+	}
+
+	passwordHash := ""
+	if body.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to hash the password"}`)
+			return
+		}
+		passwordHash = string(hash)
+	}
+
+	token, tokenHash, err := services.NewShareLinkToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to generate the share link"}`)
+		return
+	}
+
+	link := &models.ShareLink{
+		UserID:        userID,
+		ContactListID: contactListID,
+		ContactID:     contactID,
+		TokenHash:     tokenHash,
+		PasswordHash:  passwordHash,
+		Fields:        fields,
+		ExpiresAt:     expiresAt,
+		MaxViews:      body.MaxViews,
+	}
+	err = repositories.CreateShareLink(database.Database, link)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create the share link"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(&shareLinkResponse{link, token, "/public/share/" + token})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func CreateContactListShareLink(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionManage, "share")
+	if !ok {
+		return
+	}
+
+	createShareLink(w, userID, &contactList.ID, nil, body)
+}
+
+func CreateContactShareLink(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contact, err := repositories.GetContact(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
+		return
+	}
+
+	if contact.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't share contact belonging to another user"}`)
+		return
+	}
+
+	createShareLink(w, userID, nil, &contact.ID, body)
+}
+
+func GetShareLinks(w http.ResponseWriter, r *http.Request, userID uint32) {
+	links, err := repositories.GetShareLinksByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the share links"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(links)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+// getOwnShareLink fetches the share link of the id route variable, writing
+// the error response if it doesn't exist or belongs to another user.
+func getOwnShareLink(w http.ResponseWriter, r *http.Request, userID uint32, action string) (*models.ShareLink, bool) {
+	params := mux.Vars(r)
+	id, err := strconv.ParseUint(params["id"], 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return nil, false
+	}
+
+	link, err := repositories.GetShareLink(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested share link does not exist"}`)
+		return nil, false
+	}
+
+	if link.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't `+action+` share link belonging to another user"}`)
+		return nil, false
+	}
+	return link, true
+}
+
+func RevokeShareLink(w http.ResponseWriter, r *http.Request, userID uint32) {
+	link, ok := getOwnShareLink(w, r, userID, "revoke")
+	if !ok {
+		return
+	}
+
+	err := repositories.RevokeShareLink(database.Database, link.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to revoke the share link"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func GetShareLinkAccesses(w http.ResponseWriter, r *http.Request, userID uint32) {
+	link, ok := getOwnShareLink(w, r, userID, "fetch")
+	if !ok {
+		return
+	}
+
+	accesses, err := repositories.GetShareLinkAccesses(database.Database, link.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the share link accesses"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(accesses)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+// ViewShareLink serves a share link to anyone who has it, the password of
+// protected links is sent in the X-Share-Password header.
+func ViewShareLink(w http.ResponseWriter, r *http.Request) {
+	viewShareLink(w, r, r.Header.Get("X-Share-Password"))
+}
+
+// ViewShareLinkWithPassword serves a protected share link whose password is
+// POSTed as "password", for clients that can't set headers.
+func ViewShareLinkWithPassword(w http.ResponseWriter, r *http.Request, body Request) {
+	viewShareLink(w, r, body.Password)
+}
+
+func logShareLinkAccess(r *http.Request, link *models.ShareLink, result string) {
+	repositories.CreateShareLinkAccess(database.Database, &models.ShareLinkAccess{
+		ShareLinkID: link.ID,
+		IP:          clientIP(r),
+		UserAgent:   r.UserAgent(),
+		Result:      result,
+	})
+}
+
+func writeInvalidShareLink(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	io.WriteString(w, `{"error": "Share link is invalid or has expired"}`)
+}
+
+func viewShareLink(w http.ResponseWriter, r *http.Request, password string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	tokenHash := services.HashShareLinkToken(mux.Vars(r)["token"])
+	link, err := repositories.GetShareLinkByTokenHash(database.Database, tokenHash)
+	if err == sql.ErrNoRows {
+		writeInvalidShareLink(w)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the share link"}`)
+		return
+	}
+
+	if link.Revoked {
+		logShareLinkAccess(r, link, models.ShareLinkAccessRevoked)
+		writeInvalidShareLink(w)
+		return
+	}
+	if !link.ExpiresAt.After(time.Now()) {
+		logShareLinkAccess(r, link, models.ShareLinkAccessExpired)
+		writeInvalidShareLink(w)
+		return
+	}
+	// Disabling an account or scheduling its deletion stops publishing its
+	// data, the links work again if that is undone.
+	if link.OwnerInactive {
+		logShareLinkAccess(r, link, models.ShareLinkAccessOwnerInactive)
+		writeInvalidShareLink(w)
+		return
+	}
+
+	if link.HasPassword {
+		// Wrong passwords are only counted against the link, so that guessing
+		// them doesn't lock the IP address out of logging in.
+		shareKey := services.ShareLinkThrottleKey(tokenHash)
+		throttleKeys := []string{shareKey}
+		if !checkLoginThrottle(w, throttleKeys) {
+			return
+		}
+		if password == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": "Share link is protected by a password"}`)
+			return
+		}
+		err = bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password))
+		if err != nil {
+			recordLoginFailure(throttleKeys)
+			logShareLinkAccess(r, link, models.ShareLinkAccessWrongPassword)
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": "Wrong password"}`)
+			return
+		}
+		repositories.DeleteLoginThrottle(database.Database, shareKey)
+	}
+
+	// Counting the view also checks the limit, so that concurrent requests
+	// can't go over it.
+	counted, err := repositories.UseShareLinkView(database.Database, link.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to count the view"}`)
+		return
+	}
+	if !counted {
+		logShareLinkAccess(r, link, models.ShareLinkAccessViewsExceeded)
+		writeInvalidShareLink(w)
+		return
+	}
+	logShareLinkAccess(r, link, models.ShareLinkAccessGranted)
+
+	name := ""
+	var contacts []*models.Contact
+	if link.ContactListID != nil {
+		contactList, err := repositories.GetContactList(database.Database, *link.ContactListID)
+		if err == nil {
+			name = contactList.Name
+			contacts, err = repositories.GetContactsOfContactList(database.Database, contactList.ID)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to fetch contacts"}`)
+			return
+		}
+	} else {
+		contact, err := repositories.GetContact(database.Database, *link.ContactID)
+		if err == nil {
+			contacts = []*models.Contact{contact}
+			err = repositories.LoadContactDetails(database.Database, contacts)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to fetch contacts"}`)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("format") == "vcf" || strings.Contains(r.Header.Get("Accept"), "text/vcard") {
+		redacted := make([]*models.Contact, 0, len(contacts))
+		for _, contact := range contacts {
+			redacted = append(redacted, services.RedactContact(contact, link.Fields))
+		}
+		writeVCards(w, r, redacted, "shared-contacts.vcf")
+		return
+	}
+
+	public := make([]map[string]interface{}, 0, len(contacts))
+	for _, contact := range contacts {
+		public = append(public, services.PublicContact(contact, link.Fields))
+	}
+	jsonResponse, err := json.Marshal(map[string]interface{}{
+		"name":      name,
+		"contacts":  public,
+		"expiresAt": link.ExpiresAt,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -0,0 +1,216 @@
+package handlers_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var shareLinkColumns = []string{"id", "user_id", "contact_list", "contact", "token_hash", "password_hash", "fields", "expires_at", "max_views", "views", "revoked", "created_at"}
+
+func TestCreateContactListShareLink(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	tests := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{`{"fields": ["password"]}`, http.StatusBadRequest},
+		{`{"expiresAt": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"maxViews": -1}`, http.StatusBadRequest},
+		{`{"fields": ["name", "email"], "maxViews": 3}`, http.StatusOK},
+	}
+	mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(contactListColumns).AddRow(1, 1, "Friends", "", "", false))
+	for range tests[:len(tests)-1] {
+		mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE id = \\$1").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(contactListColumns).AddRow(1, 1, "Friends", "", "", false))
+	}
+	mock.ExpectQuery("^INSERT INTO share_links").WithArgs(1, 1, nil, sqlmock.AnyArg(), "", `{"name","email"}`, sqlmock.AnyArg(), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+
+	var response struct {
+		ID    uint32 `json:"id"`
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/api/contact-list/1/share-links", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code for %s: got %v want %v", test.body, status, test.expectedStatus)
+		}
+		if status := rr.Code; status == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &response)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if response.ID != 7 || response.Token == "" || response.URL != "/public/share/"+response.Token {
+		t.Errorf("Handler returned unexpected share link: %+v", response)
+	}
+}
+
+func TestViewShareLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	tokenHash := services.HashShareLinkToken("share-token")
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	shareLinkRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(append(shareLinkColumns, "owner_inactive")).
+			AddRow(7, 1, nil, 2, tokenHash, string(passwordHash), "{name,email}", time.Now().Add(time.Hour), 1, 0, false, time.Now(), false)
+	}
+
+	// Wrong password.
+	mock.ExpectQuery("^SELECT (.+) FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = \\$1").WithArgs(tokenHash).WillReturnRows(shareLinkRows())
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"share:` + tokenHash + `"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("share:"+tokenHash, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectExec("^INSERT INTO share_link_accesses").WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), models.ShareLinkAccessWrongPassword).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Right password.
+	mock.ExpectQuery("^SELECT (.+) FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = \\$1").WithArgs(tokenHash).WillReturnRows(shareLinkRows())
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("^DELETE FROM login_throttles").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE share_links SET views = views \\+ 1").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO share_link_accesses").WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), models.ShareLinkAccessGranted).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE id = \\$1").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(2, 1, "John", "Doe", "john@mail.com", "private", "", ""))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	// Out of views.
+	mock.ExpectQuery("^SELECT (.+) FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = \\$1").WithArgs(tokenHash).WillReturnRows(shareLinkRows())
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("^DELETE FROM login_throttles").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE share_links SET views = views \\+ 1").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO share_link_accesses").WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), models.ShareLinkAccessViewsExceeded).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Unknown token.
+	mock.ExpectQuery("^SELECT (.+) FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = \\$1").WithArgs(services.HashShareLinkToken("unknown")).WillReturnError(sql.ErrNoRows)
+
+	tests := []struct {
+		token          string
+		password       string
+		expectedStatus int
+	}{
+		{"share-token", "wrong-password", http.StatusUnauthorized},
+		{"share-token", "password", http.StatusOK},
+		{"share-token", "password", http.StatusBadRequest},
+		{"unknown", "", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/public/share/"+test.token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("X-Share-Password", test.password)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, test.expectedStatus)
+		}
+		if rr.Code == http.StatusOK {
+			var response struct {
+				Contacts []map[string]interface{} `json:"contacts"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if len(response.Contacts) != 1 || len(response.Contacts[0]) != 2 || response.Contacts[0]["name"] != "John" || response.Contacts[0]["email"] != "john@mail.com" {
+				t.Errorf("Handler returned unexpected body: got %v", rr.Body.String())
+			}
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestViewShareLinkOfInactiveOwner(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	tokenHash := services.HashShareLinkToken("share-token")
+	for _, owner := range []string{"disabled", "scheduled for deletion"} {
+		// The owner's state is joined in by the lookup, which only tells
+		// whether either is set.
+		mock.ExpectQuery("^SELECT (.+), u.disabled OR u.deletion_scheduled_at IS NOT NULL FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = \\$1").WithArgs(tokenHash).
+			WillReturnRows(sqlmock.NewRows(append(shareLinkColumns, "owner_inactive")).
+				AddRow(7, 1, nil, 2, tokenHash, "", "{name}", time.Now().Add(time.Hour), 0, 0, false, time.Now(), true))
+		mock.ExpectExec("^INSERT INTO share_link_accesses").WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), models.ShareLinkAccessOwnerInactive).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		req, err := http.NewRequest("GET", "/public/share/share-token", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Handler returned wrong status code for an owner %s: got %v want %v", owner, status, http.StatusBadRequest)
+		}
+		if rr.Body.String() != `{"error": "Share link is invalid or has expired"}` {
+			t.Errorf("Handler returned unexpected body for an owner %s: got %v", owner, rr.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
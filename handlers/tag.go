@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+const maxTagLength = 64
+
+// normalizeTags trims the tags and drops duplicates, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, errors.New("Tags can't be empty or longer than " + strconv.Itoa(maxTagLength) + " characters")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// parseTagFilter reads the repeatable "tag" query parameter, and "tag_mode",
+// which is either "all" (the default) or "any".
+func parseTagFilter(r *http.Request, options *repositories.ListOptions) error {
+	query := r.URL.Query()
+	tags, err := normalizeTags(query["tag"])
+	if err != nil {
+		return err
+	}
+	options.Tags = tags
+
+	switch query.Get("tag_mode") {
+	case "", "all":
+	case "any":
+		options.AnyTag = true
+	default:
+		return errors.New("Tag mode has to be either all or any")
+	}
+	return nil
+}
+
+func GetTags(w http.ResponseWriter, r *http.Request, userID uint32) {
+	tags, err := repositories.GetTagsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the tags"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(tags)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func PatchTag(w http.ResponseWriter, r *http.Request, userID uint32, patch []byte) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	tag, err := repositories.GetTag(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested tag does not exist"}`)
+		return
+	}
+
+	if tag.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't update tag belonging to another user"}`)
+		return
+	}
+
+	document, err := json.Marshal(tag)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the tag to JSON"}`)
+		return
+	}
+
+	patched, err := services.MergePatch(document, patch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Failed to apply the merge patch"}`)
+		return
+	}
+
+	var patchedTag models.Tag
+	err = json.Unmarshal(patched, &patchedTag)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Patched tag has fields of wrong type"}`)
+		return
+	}
+	patchedTag.ID = tag.ID
+	patchedTag.UserID = tag.UserID
+	patchedTag.Count = tag.Count
+
+	names, err := normalizeTags([]string{patchedTag.Name})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+	patchedTag.Name = names[0]
+
+	if patchedTag.Name != tag.Name {
+		existing, err := repositories.GetTagByName(database.Database, userID, patchedTag.Name)
+		if err == nil && existing.ID != tag.ID {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error": "Another tag with this name already exists"}`)
+			return
+		}
+		if err != nil && err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to check for tags with the same name"}`)
+			return
+		}
+	}
+
+	err = repositories.UpdateTag(database.Database, patchedTag.ID, patchedTag.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the tag"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(patchedTag)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func DeleteTag(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	tag, err := repositories.GetTag(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested tag does not exist"}`)
+		return
+	}
+
+	if tag.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't delete tag belonging to another user"}`)
+		return
+	}
+
+	err = repositories.DeleteTag(database.Database, tag.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to delete the tag"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func AddContactTags(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	changeContactTags(w, r, userID, body, repositories.AddTagsToContact)
+}
+
+func RemoveContactTags(w http.ResponseWriter, r *http.Request, userID uint32, body Request) {
+	changeContactTags(w, r, userID, body, repositories.RemoveTagsFromContact)
+}
+
+func changeContactTags(w http.ResponseWriter, r *http.Request, userID uint32, body Request, change func(*sql.DB, uint32, uint32, []string) error) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	if len(body.Tags) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Tags field is missing"}`)
+		return
+	}
+
+	tags, err := normalizeTags(body.Tags)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	contact, err := repositories.GetContact(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
+		return
+	}
+
+	if contact.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't update contact belonging to another user"}`)
+		return
+	}
+
+	err = change(database.Database, userID, contact.ID, tags)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to update the contact tags"}`)
+		return
+	}
+
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{contact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(contact)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -5,32 +5,21 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"regexp"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/jafarlihi/addressbook/config"
 	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/logger"
 	"github.com/jafarlihi/addressbook/models"
 	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func CreateUser(w http.ResponseWriter, r *http.Request, body Request) {
-	if body.Username == "" || body.Email == "" || body.Password == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Username, email, or password field(s) is/are missing"}`)
-		return
-	}
-
-	if !regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`).MatchString(body.Email) {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Provided email address is malformed"}`)
-		return
-	}
-
-	if len(body.Password) < 6 {
+	err := services.ValidateNewUser(body.Username, body.Email, body.Password)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Password length can't be smaller than 6"}`)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
 		return
 	}
 
@@ -42,12 +31,25 @@ func CreateUser(w http.ResponseWriter, r *http.Request, body Request) {
 	}
 
 	id, err := repositories.CreateUser(database.Database, body.Username, body.Email, string(passwordHash))
+	if err == repositories.ErrUsernameTaken || err == repositories.ErrEmailTaken {
+		w.WriteHeader(http.StatusConflict)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to create the user, it might already exist"}`)
 		return
 	}
 
+	// The account is usable right away, failing to send the verification
+	// email is only logged as it can be sent again.
+	user := &models.User{ID: uint32(id), Username: body.Username, Email: body.Email}
+	err = sendUserToken(user, models.UserTokenEmailVerification)
+	if err != nil {
+		logger.Log.Error("Failed to send the verification email, error: " + err.Error())
+	}
+
 	jsonResponse, _ := json.Marshal(map[string]int64{"id": id})
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(jsonResponse))
@@ -66,36 +68,94 @@ func CreateToken(w http.ResponseWriter, r *http.Request, body Request) {
 		return
 	}
 
-	var err error
+	scopes, err := services.NormalizeScopes(body.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
 	var user *models.User
 	if body.Username != "" {
 		user, err = repositories.GetUserByUsername(database.Database, body.Username)
 	} else {
 		user, err = repositories.GetUserByEmail(database.Database, body.Email)
 	}
-	if err != nil {
-		switch err {
-		case sql.ErrNoRows:
-			w.WriteHeader(http.StatusBadRequest)
-			io.WriteString(w, `{"error": "User does not exist"}`)
-		default:
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, `{"error": "Failed to get the user"}`)
-		}
+	if err != nil && err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the user"}`)
+		return
+	}
+
+	// Failures are counted per user, so that logging in with the username
+	// and with the email share the same allowance.
+	var accountKey string
+	if user != nil {
+		accountKey = services.AccountThrottleKey(user.ID)
+	} else if body.Username != "" {
+		accountKey = services.UnknownAccountThrottleKey(body.Username)
+	} else {
+		accountKey = services.UnknownAccountThrottleKey(body.Email)
+	}
+	throttleKeys := []string{accountKey, services.IPThrottleKey(clientIP(r))}
+	if !checkLoginThrottle(w, throttleKeys) {
+		return
+	}
+
+	if user == nil {
+		services.CompareDummyPassword(body.Password)
+		recordLoginFailure(throttleKeys)
+		writeInvalidCredentials(w)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		io.WriteString(w, `{"error": "Wrong password"}`)
+		recordLoginFailure(throttleKeys)
+		writeInvalidCredentials(w)
 		return
 	}
+	repositories.DeleteLoginThrottle(database.Database, accountKey)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": user.ID,
-	})
-	tokenString, err := token.SignedString([]byte(config.Config.Jwt.SigningSecret))
+	if !checkUserEnabled(w, user) {
+		return
+	}
+
+	credential, err := repositories.GetTOTPCredential(database.Database, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the TOTP credential"}`)
+		return
+	}
+	if err == nil && credential.Enabled {
+		respondWithMFAChallenge(w, user.ID, scopes)
+		return
+	}
+
+	respondWithTokens(w, user, scopes)
+}
+
+// checkUserEnabled keeps disabled users from logging in, writing the error
+// response if the user is disabled.
+func checkUserEnabled(w http.ResponseWriter, user *models.User) bool {
+	if user.Disabled {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error": "Account is disabled"}`)
+		return false
+	}
+	return true
+}
+
+// respondWithTokens logs the user in, starting a new refresh token family.
+func respondWithTokens(w http.ResponseWriter, user *models.User, scopes []string) {
+	family, err := services.NewTokenFamily()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create token"}`)
+		return
+	}
+
+	tokens, err := issueTokens(user.ID, family, scopes)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		io.WriteString(w, `{"error": "Failed to create token"}`)
@@ -103,10 +163,10 @@ func CreateToken(w http.ResponseWriter, r *http.Request, body Request) {
 	}
 
 	response := struct {
-		Token string      `json:"token"`
-		User  models.User `json:"user"`
+		*tokenResponse
+		User models.User `json:"user"`
 	}{
-		tokenString,
+		tokens,
 		*user,
 	}
 	response.User.Password = ""
@@ -119,3 +179,119 @@ func CreateToken(w http.ResponseWriter, r *http.Request, body Request) {
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(jsonResponse))
 }
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+// issueTokens creates an access token and a new refresh token of the given
+// refresh token family, both granting the given scopes.
+func issueTokens(userID uint32, family string, scopes []string) (*tokenResponse, error) {
+	accessToken, err := services.CreateAccessToken(userID, family, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshTokenHash, err := services.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = repositories.CreateRefreshToken(database.Database, &models.RefreshToken{
+		UserID:    userID,
+		Family:    family,
+		TokenHash: refreshTokenHash,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(services.RefreshTokenLifetime()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(services.AccessTokenLifetime() / time.Second),
+	}, nil
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request, body Request) {
+	if body.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "RefreshToken field is missing"}`)
+		return
+	}
+
+	tokenHash := services.HashRefreshToken(body.RefreshToken)
+	refreshToken, err := repositories.UseRefreshToken(database.Database, tokenHash)
+	if err == sql.ErrNoRows {
+		// A used refresh token being presented again means that it has
+		// leaked, so the whole family is revoked to log out both parties.
+		existing, err := repositories.GetRefreshToken(database.Database, tokenHash)
+		if err == nil && existing.Used && !existing.Revoked {
+			repositories.RevokeRefreshTokenFamily(database.Database, existing.Family)
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": "Refresh token has already been used, the session has been revoked"}`)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Refresh token is invalid or has expired"}`)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to use the refresh token"}`)
+		return
+	}
+
+	tokens, err := issueTokens(refreshToken.UserID, refreshToken.Family, refreshToken.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to create token"}`)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(tokens)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the response to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
+
+func Logout(w http.ResponseWriter, r *http.Request, userID uint32) {
+	if _, ok := services.ParseAPIKeyHeader(r.Header.Get("Authorization")); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "API keys can't be logged out, delete them instead"}`)
+		return
+	}
+
+	token, err := services.ParseAccessToken(r.Header.Get("Authorization"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "`+err.Error()+`"}`)
+		return
+	}
+
+	if token.Family != "" {
+		err = repositories.RevokeRefreshTokenFamily(database.Database, token.Family)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error": "Failed to revoke the refresh tokens"}`)
+			return
+		}
+	}
+
+	err = repositories.CreateRevokedAccessToken(database.Database, token.ID, token.ExpiresAt)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to revoke the token"}`)
+		return
+	}
+	services.RevokeAccessToken(token.ID, token.ExpiresAt)
+
+	w.WriteHeader(http.StatusOK)
+}
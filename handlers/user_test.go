@@ -1,17 +1,20 @@
 package handlers_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/jafarlihi/addressbook/config"
 	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
 	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -118,6 +121,9 @@ func TestCreateUser(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"id"}).AddRow(id)
 	mock.ExpectQuery("^INSERT INTO users").WithArgs(username, email, sqlmock.AnyArg()).WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO user_tokens").WithArgs(id, models.UserTokenEmailVerification, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	recorder := useRecordingMailer(t)
 
 	rr := httptest.NewRecorder()
 	router := router.ConstructRouter()
@@ -135,6 +141,10 @@ func TestCreateUser(t *testing.T) {
 	if rr.Body.String() != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
+
+	if len(recorder.messages) != 1 || recorder.messages[0].To != email {
+		t.Errorf("Handler didn't send the verification email: %v", recorder.messages)
+	}
 }
 
 func TestCreateToken(t *testing.T) {
@@ -162,20 +172,18 @@ func TestCreateToken(t *testing.T) {
 		t.Fatal("Failed to hash password")
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password"}).AddRow(id, username, email, string(passwordHash))
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(id, username, email, string(passwordHash), false, nil, false)
 	mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs(username).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WithArgs(`{"account:1","ip:"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("^DELETE FROM login_throttles").WithArgs("account:1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery("^SELECT (.+) FROM totp_credentials").WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectExec("^INSERT INTO refresh_tokens").WithArgs(id, sqlmock.AnyArg(), sqlmock.AnyArg(), `{"contacts:read","contacts:write","lists:read","lists:write","account"}`, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	jwtSecret := "secret"
 	config.Config.Jwt.SigningSecret = jwtSecret
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": id,
-	})
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	if err != nil {
-		t.Fatal("Failed to create JWT token")
-	}
-
 	rr := httptest.NewRecorder()
 	router := router.ConstructRouter()
 	router.ServeHTTP(rr, req)
@@ -188,9 +196,27 @@ func TestCreateToken(t *testing.T) {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	expected := `{"token":"` + tokenString + `","user":{"id":` + fmt.Sprint(id) + `,"username":"` + username + `","email":"` + email + `","password":""}}`
-	if rr.Body.String() != expected {
-		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	var response struct {
+		Token        string      `json:"token"`
+		RefreshToken string      `json:"refreshToken"`
+		ExpiresIn    int64       `json:"expiresIn"`
+		User         models.User `json:"user"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("Handler returned a body that isn't JSON: %v", rr.Body.String())
+	}
+
+	token, err := services.ParseAccessToken("Bearer " + response.Token)
+	if err != nil {
+		t.Errorf("Returned token can't be parsed: %s", err)
+	} else if token.UserID != id || token.Family == "" {
+		t.Errorf("Returned token has unexpected claims: %+v", token)
+	}
+
+	expectedUser := models.User{ID: id, Username: username, Email: email}
+	if response.RefreshToken == "" || response.ExpiresIn != 900 || response.User != expectedUser {
+		t.Errorf("Handler returned unexpected body: %v", rr.Body.String())
 	}
 }
 
@@ -219,8 +245,15 @@ func TestCreateTokenWithWrongPassword(t *testing.T) {
 		t.Fatal("Failed to hash password")
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password"}).AddRow(id, username, email, string(passwordHash))
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(id, username, email, string(passwordHash), false, nil, false)
 	mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs(username).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("account:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectExec("^UPDATE login_throttles SET blocked_until").WithArgs("account:1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^INSERT INTO login_throttles").WithArgs("ip:", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
 
 	rr := httptest.NewRecorder()
 	router := router.ConstructRouter()
@@ -230,12 +263,192 @@ func TestCreateTokenWithWrongPassword(t *testing.T) {
 		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 
-	if status := rr.Code; status != http.StatusBadRequest {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
 	}
 
-	expected := `{"error": "Wrong password"}`
+	expected := `{"error": "Invalid credentials"}`
 	if rr.Body.String() != expected {
 		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestCreateTokenForDisabledUser(t *testing.T) {
+	req, err := http.NewRequest("POST", "/api/user/token", strings.NewReader(`{"username": "user", "password": "password"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal("Failed to hash password")
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", string(passwordHash), true, nil, true)
+	mock.ExpectQuery("^SELECT (.*) FROM users").WithArgs("user").WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT max\\(blocked_until\\) FROM login_throttles").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("^DELETE FROM login_throttles").WithArgs("account:1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusForbidden)
+	}
+
+	expected := `{"error": "Account is disabled"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	refreshToken := "refresh-token"
+	tokenHash := services.HashRefreshToken(refreshToken)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	var userID uint32
+	userID = 1
+	rows := sqlmock.NewRows([]string{"id", "user_id", "family", "token_hash", "scopes", "expires_at", "used", "revoked"}).
+		AddRow(1, userID, "family", tokenHash, "{contacts:read}", time.Now().Add(time.Hour), true, false)
+	mock.ExpectQuery("^UPDATE refresh_tokens SET used = true").WithArgs(tokenHash).WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO refresh_tokens").WithArgs(userID, "family", sqlmock.AnyArg(), `{"contacts:read"}`, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+
+	req, err := http.NewRequest("POST", "/api/user/token/refresh", strings.NewReader(`{"refreshToken": "`+refreshToken+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var response struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.RefreshToken == "" || response.RefreshToken == refreshToken {
+		t.Errorf("Handler didn't rotate the refresh token: %v", rr.Body.String())
+	}
+	token, err := services.ParseAccessToken("Bearer " + response.Token)
+	if err != nil || token.UserID != 1 {
+		t.Fatalf("Handler returned an unusable access token: %v", rr.Body.String())
+	}
+	if len(token.Scopes) != 1 || token.Scopes[0] != services.ScopeContactsRead {
+		t.Errorf("Handler didn't keep the scopes of the refresh token: %v", token.Scopes)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	refreshToken := "refresh-token"
+	tokenHash := services.HashRefreshToken(refreshToken)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectQuery("^UPDATE refresh_tokens SET used = true").WithArgs(tokenHash).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family", "token_hash", "scopes", "expires_at", "used", "revoked"}))
+	mock.ExpectQuery("^SELECT (.*) FROM refresh_tokens").WithArgs(tokenHash).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family", "token_hash", "scopes", "expires_at", "used", "revoked"}).
+			AddRow(1, 1, "family", tokenHash, "{contacts:read}", time.Now().Add(time.Hour), true, false))
+	mock.ExpectExec("^UPDATE refresh_tokens SET revoked = true").WithArgs("family").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	req, err := http.NewRequest("POST", "/api/user/token/refresh", strings.NewReader(`{"refreshToken": "`+refreshToken+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusUnauthorized {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	expected := `{"error": "Refresh token has already been used, the session has been revoked"}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	mock.ExpectExec("^UPDATE refresh_tokens SET revoked = true").WithArgs("family").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO revoked_access_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for _, expectedStatus := range []int{http.StatusOK, http.StatusUnauthorized} {
+		req, err := http.NewRequest("POST", "/api/user/logout", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Add("Authorization", "Bearer "+tokenString)
+
+		rr := httptest.NewRecorder()
+		router := router.ConstructRouter()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != expectedStatus {
+			t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+const maxImportSize = 10 << 20
+
+// importError reports a failed card of a vCard import or a failed row of a
+// CSV import, both of which are counted from 1.
+type importError struct {
+	Card  int    `json:"card,omitempty"`
+	Row   int    `json:"row,omitempty"`
+	Error string `json:"error"`
+}
+
+// vcardVersion picks the vCard version to export from the "version" query
+// parameter or the version parameter of the Accept header, defaulting to 3.0.
+func vcardVersion(r *http.Request) string {
+	if r.URL.Query().Get("version") == "4.0" || strings.Contains(r.Header.Get("Accept"), "version=4.0") {
+		return "4.0"
+	}
+	return "3.0"
+}
+
+// vcardWriter writes contacts as vCards one at a time and flushes every 100
+// contacts so the response streams. Like the other exports every write
+// extends the write deadline.
+type vcardWriter struct {
+	w       http.ResponseWriter
+	version string
+	count   int
+}
+
+func startVCards(w http.ResponseWriter, r *http.Request, filename string) *vcardWriter {
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	extendWriteDeadline(w)
+	w.WriteHeader(http.StatusOK)
+	return &vcardWriter{w: w, version: vcardVersion(r)}
+}
+
+func (v *vcardWriter) write(contact *models.Contact) error {
+	extendWriteDeadline(v.w)
+	if err := services.WriteVCard(v.w, contact, v.version); err != nil {
+		return err
+	}
+
+	v.count++
+	if v.count%100 == 0 {
+		v.flush()
+	}
+	return nil
+}
+
+func (v *vcardWriter) flush() {
+	extendWriteDeadline(v.w)
+	if flusher, ok := v.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func writeVCards(w http.ResponseWriter, r *http.Request, contacts []*models.Contact, filename string) {
+	writer := startVCards(w, r, filename)
+	for _, contact := range contacts {
+		if err := writer.write(contact); err != nil {
+			return
+		}
+	}
+}
+
+func ExportContactVCard(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contact, err := repositories.GetContact(database.Database, uint32(id))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Requested contact does not exist"}`)
+		return
+	}
+
+	if contact.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error": "Can't fetch contact belonging to another user"}`)
+		return
+	}
+
+	err = repositories.LoadContactDetails(database.Database, []*models.Contact{contact})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the contact details"}`)
+		return
+	}
+
+	writeVCards(w, r, []*models.Contact{contact}, "contact-"+idString+".vcf")
+}
+
+func ExportContactsVCard(w http.ResponseWriter, r *http.Request, userID uint32) {
+	writer := startVCards(w, r, "contacts.vcf")
+	err := repositories.StreamContactsByUserID(database.Database, userID, writer.write)
+	if err != nil {
+		logger.Log.Error("Failed to stream the vCard export, error: " + err.Error())
+	}
+	writer.flush()
+}
+
+func ExportContactListVCard(w http.ResponseWriter, r *http.Request, userID uint32) {
+	params := mux.Vars(r)
+	idString := params["id"]
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Provided ID can't be parsed as an integer"}`)
+		return
+	}
+
+	contactList, ok := authorizeContactList(w, uint32(id), userID, services.PermissionRead, "fetch")
+	if !ok {
+		return
+	}
+
+	writer := startVCards(w, r, "contact-list-"+idString+".vcf")
+	err = repositories.StreamContactsOfContactList(database.Database, contactList.ID, writer.write)
+	if err != nil {
+		logger.Log.Error("Failed to stream the contact-list vCard export, error: " + err.Error())
+	}
+	writer.flush()
+}
+
+func ImportVCards(w http.ResponseWriter, r *http.Request, userID uint32) {
+	cards, err := services.ParseVCards(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Request body couldn't be read as a vCard file"}`)
+		return
+	}
+
+	if len(cards) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": "Request body doesn't contain any vCards"}`)
+		return
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to get the custom fields"}`)
+		return
+	}
+
+	imported := make([]int64, 0)
+	errors := make([]*importError, 0)
+	for _, card := range cards {
+		if card.Err != nil {
+			errors = append(errors, &importError{Card: card.Index, Error: card.Err.Error()})
+			continue
+		}
+
+		card.Contact.UserID = userID
+		err := services.ValidateContact(card.Contact)
+		if err == nil {
+			err = services.ValidateCustomFieldValues(card.Contact, customFields)
+		}
+		if err != nil {
+			errors = append(errors, &importError{Card: card.Index, Error: err.Error()})
+			continue
+		}
+
+		id, err := repositories.CreateContact(database.Database, card.Contact)
+		if err != nil {
+			errors = append(errors, &importError{Card: card.Index, Error: "Failed to create the contact"})
+			continue
+		}
+		imported = append(imported, id)
+	}
+
+	response := struct {
+		Imported []int64        `json:"imported"`
+		Errors   []*importError `json:"errors"`
+	}{
+		imported,
+		errors,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error": "Failed to marshal the result to JSON"}`)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(jsonResponse))
+}
@@ -0,0 +1,195 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestImportVCards(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+	email := "john@mail.com"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(contactID)
+	mock.ExpectQuery("^SELECT (.*) FROM custom_fields").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "type", "required", "options"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO contacts").WithArgs(userID, "John", "Doe", email, "", "", "", "John Doe "+email).WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(contactID, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	vcf := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Doe;John;;;\r\nEMAIL:" + email + "\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nN:Roe;Jane;;;\r\nEND:VCARD\r\n"
+	req, err := http.NewRequest("POST", "/api/contact/import", strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := `{"imported":[` + fmt.Sprint(contactID) + `],"errors":[{"card":2,"error":"Name, surname, and/or email field(s) is/are missing"}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExportContactVCard(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+	email := "john@mail.com"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).AddRow(contactID, userID, "John", "Doe", email, "", "", "X-CUSTOM:value")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts").WithArgs(contactID).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(3, contactID, "", email, true))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("GET", "/api/contact/"+fmt.Sprint(contactID)+".vcf", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := "BEGIN:VCARD\r\nVERSION:3.0\r\nPRODID:-//addressbook//EN\r\nFN:John Doe\r\nN:Doe;John;;;\r\nEMAIL;TYPE=INTERNET,PREF:" + email + "\r\nX-CUSTOM:value\r\nEND:VCARD\r\n"
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExportContactsVCard(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	database.Database = db
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(2, 1, "John", "Doe", "john@mail.com", "", "", "").
+		AddRow(3, 1, "Jane", "Roe", "jane@mail.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.*) FROM contacts WHERE user_id = \\$1 AND id > \\$2 ORDER BY id LIMIT 500$").WithArgs(1, 0).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WithArgs("{2,3}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WithArgs("{2,3}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WithArgs("{2,3}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	req, err := http.NewRequest("GET", "/api/contact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+tokenString)
+	req.Header.Add("Accept", "text/vcard")
+
+	rr := httptest.NewRecorder()
+	router := router.ConstructRouter()
+	router.ServeHTTP(rr, req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := "BEGIN:VCARD\r\nVERSION:3.0\r\nPRODID:-//addressbook//EN\r\nFN:John Doe\r\nN:Doe;John;;;\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nPRODID:-//addressbook//EN\r\nFN:Jane Roe\r\nN:Roe;Jane;;;\r\nEND:VCARD\r\n"
+	if rr.Body.String() != expected {
+		t.Errorf("Handler returned unexpected body: got %q want %q", rr.Body.String(), expected)
+	}
+}
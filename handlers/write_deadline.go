@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+)
+
+// writeDeadlineSetter is implemented by the response writers of net/http for
+// both HTTP/1 and HTTP/2 when built with Go 1.20 or later.
+type writeDeadlineSetter interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// extendWriteDeadline gives the response another write timeout from now.
+// Streamed responses call it as they go, so that the timeout bounds how long
+// a client may stall rather than how long the whole response may take.
+// Writers that don't support deadlines, like test recorders, have none to
+// extend.
+func extendWriteDeadline(w http.ResponseWriter) {
+	timeout, _ := time.ParseDuration(config.Config.HttpServer.WriteTimeout)
+	if timeout <= 0 {
+		return
+	}
+	for {
+		switch writer := w.(type) {
+		case writeDeadlineSetter:
+			writer.SetWriteDeadline(time.Now().Add(timeout))
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return
+		}
+	}
+}
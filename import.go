@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// importedEntry is a parsed card or row, entry says which one for error
+// messages.
+type importedEntry struct {
+	entry   string
+	contact *models.Contact
+	err     error
+}
+
+// runImport imports contacts like the vCard and CSV imports of the API do,
+// validating them the same way.
+func runImport(args []string) int {
+	flags := newFlagSet("import")
+	userRef := flags.String("user", "", "user to import the contacts for")
+	format := flags.String("format", "", "format of the file, vcf or csv, guessed from its extension by default")
+	preset := flags.String("preset", "", "CSV column preset, google or outlook")
+	customMapping := flags.String("mapping", "", "CSV column mapping as a JSON object, applied on top of the preset")
+	contactListID := flags.Uint("list", 0, "ID of the contact-list to add the imported contacts to")
+	dryRun := flags.Bool("dry-run", false, "only validate the contacts")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *userRef == "" {
+		return commandUsage("import")
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if *format == "vcard" {
+		*format = "vcf"
+	}
+	if *format != "vcf" && *format != "csv" {
+		return fail("Format has to be either vcf or csv")
+	}
+
+	database.InitDatabase()
+
+	user, err := findUser(*userRef)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if *contactListID != 0 {
+		if err := authorizeImportList(uint32(*contactListID), user.ID); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	var file io.Reader = os.Stdin
+	if path != "-" {
+		opened, err := os.Open(path)
+		if err != nil {
+			return fail("Failed to open the file, error: " + err.Error())
+		}
+		defer opened.Close()
+		file = opened
+	}
+
+	var entries []*importedEntry
+	if *format == "vcf" {
+		cards, err := services.ParseVCards(file)
+		if err != nil {
+			return fail("File couldn't be read as a vCard file")
+		}
+		for _, card := range cards {
+			entries = append(entries, &importedEntry{fmt.Sprintf("Card %d", card.Index), card.Contact, card.Err})
+		}
+	} else {
+		mapping := make(services.CSVMapping)
+		if *preset != "" {
+			presetMapping, ok := services.CSVPresets[*preset]
+			if !ok {
+				return fail("Unknown preset, it has to be either google or outlook")
+			}
+			for header, field := range presetMapping {
+				mapping[header] = field
+			}
+		}
+		if *customMapping != "" {
+			if err := json.Unmarshal([]byte(*customMapping), &mapping); err != nil {
+				return fail("Mapping couldn't be parsed as a JSON object")
+			}
+		}
+		if len(mapping) == 0 {
+			return fail("Preset and mapping are missing, at least one is required for CSV files")
+		}
+		if err := mapping.Validate(); err != nil {
+			return fail(err.Error())
+		}
+
+		rows, err := services.ParseCSVContacts(file, mapping)
+		if err != nil {
+			return fail(err.Error())
+		}
+		for _, row := range rows {
+			entries = append(entries, &importedEntry{fmt.Sprintf("Row %d", row.Row), row.Contact, row.Err})
+		}
+	}
+
+	customFields, err := repositories.GetCustomFieldsByUserID(database.Database, user.ID)
+	if err != nil {
+		return fail("Failed to get the custom fields")
+	}
+
+	valid, imported, failed := 0, 0, 0
+	for _, entry := range entries {
+		err := entry.err
+		if err == nil {
+			entry.contact.UserID = user.ID
+			err = services.ValidateContact(entry.contact)
+		}
+		if err == nil {
+			err = services.ValidateCustomFieldValues(entry.contact, customFields)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, entry.entry+": "+err.Error())
+			failed++
+			continue
+		}
+		valid++
+		if *dryRun {
+			continue
+		}
+
+		id, err := repositories.CreateContact(database.Database, entry.contact)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, entry.entry+": Failed to create the contact")
+			failed++
+			continue
+		}
+		imported++
+
+		if *contactListID != 0 {
+			err = repositories.AddContactToContactList(database.Database, uint32(*contactListID), uint32(id))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, entry.entry+": Failed to add contact to contact-list")
+			}
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("%d valid, %d invalid\n", valid, failed)
+	} else {
+		fmt.Printf("Imported %d, %d failed\n", imported, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// authorizeImportList checks that the user may import into the contact-list,
+// as the API does.
+func authorizeImportList(id uint32, userID uint32) error {
+	contactList, err := repositories.GetContactList(database.Database, id)
+	if err != nil {
+		return fmt.Errorf("Contact-list %d does not exist", id)
+	}
+
+	sharedRole := ""
+	if contactList.UserID != userID {
+		sharedRole, err = repositories.GetContactListShareRole(database.Database, contactList.ID, userID)
+		if err != nil && err != sql.ErrNoRows {
+			return errors.New("Failed to get the contact-list share")
+		}
+	}
+
+	role := services.ContactListRole(contactList, userID, sharedRole)
+	if role == "" {
+		return errors.New("Can't import into contact-list belonging to another user")
+	}
+	if !services.HasPermission(role, services.PermissionEdit) {
+		return fmt.Errorf("Can't import into contact-list shared with you as %s", role)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// ExportArchiveLifetime is how long a completed export can be downloaded for.
+const ExportArchiveLifetime = 7 * 24 * time.Hour
+
+// ExportJobLease is how long an export job is left to the instance running
+// it without hearing from it, before it's considered interrupted and failed.
+// Running jobs renew their lease every ExportJobLeaseRenewInterval.
+const (
+	ExportJobLease              = 2 * time.Minute
+	ExportJobLeaseRenewInterval = 30 * time.Second
+)
+
+const exportVCardVersion = "4.0"
+
+// running tracks the export jobs of this instance, so that shutting down can
+// wait for them.
+var running sync.WaitGroup
+
+// exportedContactList is a contact-list along with the IDs of its contacts,
+// which are exported in full in contacts.json.
+type exportedContactList struct {
+	*models.ContactList
+	ContactIDs []uint32 `json:"contactIDs"`
+}
+
+// auditHistory is the record of access to the account that's kept, share
+// links with their accesses, the refresh tokens issued by logging in, and
+// the failed attempts at logging in or confirming a password or code.
+type auditHistory struct {
+	ShareLinks        []*models.ShareLink       `json:"shareLinks"`
+	ShareLinkAccesses []*models.ShareLinkAccess `json:"shareLinkAccesses"`
+	Sessions          []*exportedSession        `json:"sessions"`
+	LoginFailures     []*models.LoginThrottle   `json:"loginFailures"`
+}
+
+// exportedSession is a refresh token without its hash. Tokens rotated from
+// the same login share their family.
+type exportedSession struct {
+	Family    string    `json:"family"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Used      bool      `json:"used"`
+	Revoked   bool      `json:"revoked"`
+}
+
+// StartExport runs the export job in the background, tests can replace it
+// to keep jobs from running.
+var StartExport = func(job *models.ExportJob) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		runExport(database.Database, job)
+	}()
+}
+
+// Wait waits for the export jobs of this instance to finish, or returns the
+// context's error once it's done. Jobs left running are failed by another
+// instance once their lease expires.
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// renewLease renews the lease of the job until stop is closed.
+func renewLease(db *sql.DB, job *models.ExportJob, stop chan struct{}) {
+	ticker := time.NewTicker(ExportJobLeaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			repositories.RenewExportJobLease(db, job.ID, ExportJobLease)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func runExport(db *sql.DB, job *models.ExportJob) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go renewLease(db, job, stop)
+
+	reported := -1
+	progress := func(percent int) {
+		if percent == reported {
+			return
+		}
+		reported = percent
+		repositories.UpdateExportJobProgress(db, job.ID, models.ExportJobRunning, percent)
+	}
+	progress(0)
+
+	var archive bytes.Buffer
+	err := BuildExport(db, job.UserID, &archive, progress)
+	if err != nil {
+		logger.Log.Error("Failed to build an export, error: " + err.Error())
+		repositories.FailExportJob(db, job.ID, "Failed to build the export")
+		return
+	}
+
+	err = repositories.CompleteExportJob(db, job.ID, archive.Bytes(), time.Now().Add(ExportArchiveLifetime))
+	if err != nil {
+		repositories.FailExportJob(db, job.ID, "Failed to store the export")
+	}
+}
+
+// BuildExport writes a ZIP archive of the profile, contacts, contact-lists,
+// API keys and audit history of the user to w, reporting its progress in
+// percent.
+func BuildExport(db *sql.DB, userID uint32, w io.Writer, progress func(int)) error {
+	user, err := repositories.GetUser(db, userID)
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+
+	contacts, err := repositories.GetContactsByUserID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	contactLists, err := repositories.GetContactListsByUserID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := repositories.GetAPIKeysByUserID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	history, err := getAuditHistory(db, userID)
+	if err != nil {
+		return err
+	}
+
+	// Fetching the memberships of every contact-list is the slow part, the
+	// rest is counted as a single step each.
+	steps := len(contactLists) + 6
+	done := 4
+	progress(done * 100 / steps)
+
+	archive := zip.NewWriter(w)
+	if err := writeJSONFile(archive, "profile.json", user); err != nil {
+		return err
+	}
+	if err := writeJSONFile(archive, "contacts.json", contacts); err != nil {
+		return err
+	}
+
+	file, err := archive.Create("contacts.vcf")
+	if err != nil {
+		return err
+	}
+	for _, contact := range contacts {
+		if err := services.WriteVCard(file, contact, exportVCardVersion); err != nil {
+			return err
+		}
+	}
+	done++
+	progress(done * 100 / steps)
+
+	exportedLists := make([]*exportedContactList, 0, len(contactLists))
+	for _, contactList := range contactLists {
+		members, err := repositories.GetContactsOfContactList(db, contactList.ID)
+		if err != nil {
+			return err
+		}
+		contactIDs := make([]uint32, 0, len(members))
+		for _, member := range members {
+			contactIDs = append(contactIDs, member.ID)
+		}
+		exportedLists = append(exportedLists, &exportedContactList{contactList, contactIDs})
+		done++
+		progress(done * 100 / steps)
+	}
+	if err := writeJSONFile(archive, "contact-lists.json", exportedLists); err != nil {
+		return err
+	}
+
+	if err := writeJSONFile(archive, "api-keys.json", apiKeys); err != nil {
+		return err
+	}
+	if err := writeJSONFile(archive, "audit-history.json", history); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	progress(100)
+	return nil
+}
+
+func getAuditHistory(db *sql.DB, userID uint32) (*auditHistory, error) {
+	shareLinks, err := repositories.GetShareLinksByUserID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accesses, err := repositories.GetShareLinkAccessesByUserID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokens, err := repositories.GetRefreshTokensByUserID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*exportedSession, 0, len(refreshTokens))
+	for _, token := range refreshTokens {
+		sessions = append(sessions, &exportedSession{token.Family, token.Scopes, token.ExpiresAt, token.Used, token.Revoked})
+	}
+
+	// Failures counted per IP address can't be attributed to a user, only the
+	// ones counted per account are exported.
+	loginFailures, err := repositories.GetLoginThrottles(db, []string{services.AccountThrottleKey(userID), services.MFAThrottleKey(userID)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditHistory{shareLinks, accesses, sessions, loginFailures}, nil
+}
+
+func writeJSONFile(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,119 @@
+package jobs_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/jobs"
+)
+
+func expectContacts(mock sqlmock.Sqlmock, query string, arg uint32) {
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(2, 1, "John", "Doe", "john@mail.com", "", "", "")
+	mock.ExpectQuery(query).WithArgs(arg).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.*) FROM contact_phone_numbers").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}).AddRow(1, 2, "mobile", "+15550100"))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_emails").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_addresses").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.*) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+}
+
+func TestBuildExport(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(1, "user", "valid@mail.com", "hash", true, nil, false))
+	expectContacts(mock, "^SELECT (.+) FROM contacts WHERE user_id = \\$1", 1)
+	mock.ExpectQuery("^SELECT (.+) FROM contact_lists WHERE user_id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "description", "color", "archived"}).AddRow(3, 1, "Friends", "", "", false))
+	mock.ExpectQuery("^SELECT (.+) FROM api_keys WHERE user_id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "created_at"}))
+	mock.ExpectQuery("^SELECT (.+) FROM share_links WHERE user_id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "contact_list", "contact", "token_hash", "password_hash", "fields", "expires_at", "max_views", "views", "revoked", "created_at"}).
+			AddRow(7, 1, 3, nil, "share-token-hash", "", "{name}", time.Now().Add(time.Hour), 0, 1, false, time.Now()))
+	mock.ExpectQuery("^SELECT (.+) FROM share_link_accesses a JOIN share_links l").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "share_link", "accessed_at", "ip", "user_agent", "result"}).AddRow(9, 7, time.Now(), "192.0.2.1", "curl", "granted"))
+	mock.ExpectQuery("^SELECT (.+) FROM refresh_tokens WHERE user_id = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family", "token_hash", "scopes", "expires_at", "used", "revoked"}).AddRow(4, 1, "family", "refresh-token-hash", "{contacts:read}", time.Now().Add(time.Hour), false, false))
+	mock.ExpectQuery("^SELECT (.+) FROM login_throttles").WithArgs(`{"account:1","mfa:1"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "failures", "last_failure_at", "blocked_until"}).AddRow("account:1", 2, time.Now(), nil))
+	expectContacts(mock, "^SELECT (.+) FROM contacts WHERE id IN", 3)
+
+	var buffer bytes.Buffer
+	reported := make([]int, 0)
+	err = jobs.BuildExport(db, 1, &buffer, func(percent int) { reported = append(reported, percent) })
+	if err != nil {
+		t.Fatalf("Error was not expected while building the export: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(reported) == 0 || reported[len(reported)-1] != 100 {
+		t.Errorf("Unexpected progress reports: %v", reported)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("Export isn't a valid ZIP archive: %s", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(content)
+	}
+
+	for _, name := range []string{"profile.json", "contacts.json", "contacts.vcf", "contact-lists.json", "api-keys.json", "audit-history.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Export is missing %s", name)
+		}
+	}
+
+	if strings.Contains(files["profile.json"], "hash") {
+		t.Errorf("Export contains the password hash: %s", files["profile.json"])
+	}
+
+	if !strings.Contains(files["contacts.vcf"], "FN:John Doe") || !strings.Contains(files["contacts.vcf"], "+15550100") {
+		t.Errorf("Unexpected vCards: %s", files["contacts.vcf"])
+	}
+
+	var history struct {
+		ShareLinks        []struct{ ID uint32 }     `json:"shareLinks"`
+		ShareLinkAccesses []struct{ IP string }     `json:"shareLinkAccesses"`
+		Sessions          []struct{ Family string } `json:"sessions"`
+		LoginFailures     []struct{ Failures int }  `json:"loginFailures"`
+	}
+	json.Unmarshal([]byte(files["audit-history.json"]), &history)
+	if len(history.ShareLinks) != 1 || len(history.ShareLinkAccesses) != 1 || history.ShareLinkAccesses[0].IP != "192.0.2.1" ||
+		len(history.Sessions) != 1 || len(history.LoginFailures) != 1 || history.LoginFailures[0].Failures != 2 {
+		t.Errorf("Unexpected audit history: %s", files["audit-history.json"])
+	}
+	if strings.Contains(files["audit-history.json"], "token-hash") {
+		t.Errorf("Export contains token hashes: %s", files["audit-history.json"])
+	}
+
+	var contactLists []struct {
+		Name       string   `json:"name"`
+		ContactIDs []uint32 `json:"contactIDs"`
+	}
+	json.Unmarshal([]byte(files["contact-lists.json"]), &contactLists)
+	if len(contactLists) != 1 || contactLists[0].Name != "Friends" || len(contactLists[0].ContactIDs) != 1 || contactLists[0].ContactIDs[0] != 2 {
+		t.Errorf("Unexpected contact-lists: %s", files["contact-lists.json"])
+	}
+}
@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/logger"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(message *Message) error
+}
+
+// Default is the mailer emails are sent with, it logs them until InitMailer
+// is called.
+var Default Mailer = &LogMailer{}
+
+func InitMailer() {
+	mailer, err := ConfiguredMailer()
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+	Default = mailer
+}
+
+// ConfiguredMailer returns the mailer of the configured driver.
+func ConfiguredMailer() (Mailer, error) {
+	mailConfig := config.Config.Mail
+	switch mailConfig.Driver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     mailConfig.Smtp.Host,
+			Port:     mailConfig.Smtp.Port,
+			Username: mailConfig.Smtp.Username,
+			Password: mailConfig.Smtp.Password,
+			From:     mailConfig.From,
+		}, nil
+	case "file":
+		return &FileMailer{Directory: mailConfig.Directory, From: mailConfig.From}, nil
+	case "log", "":
+		return &LogMailer{From: mailConfig.From}, nil
+	}
+	return nil, errors.New("Unknown mail driver " + mailConfig.Driver + ", has to be one of smtp, file, or log")
+}
+
+// Bytes formats the message as an RFC 5322 email.
+func (message *Message) Bytes(from string) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("\r\n")
+	buffer.WriteString(message.Body)
+	return buffer.Bytes()
+}
+
+// SMTPMailer sends emails through an SMTP server, authenticating only if a
+// username is configured so that local SMTP catchers work without setup.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(message *Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	err := smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{message.To}, message.Bytes(m.From))
+	if err != nil {
+		logger.Log.Error("Failed to send an email, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// FileMailer writes every email to its own .eml file in Directory.
+type FileMailer struct {
+	Directory string
+	From      string
+}
+
+func (m *FileMailer) Send(message *Message) error {
+	err := os.MkdirAll(m.Directory, 0755)
+	if err != nil {
+		logger.Log.Error("Failed to create the mail directory, error: " + err.Error())
+		return err
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + ".eml"
+	err = ioutil.WriteFile(filepath.Join(m.Directory, name), message.Bytes(m.From), 0644)
+	if err != nil {
+		logger.Log.Error("Failed to write an email, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// LogMailer only logs emails, it's meant for local development.
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(message *Message) error {
+	logger.Log.Info("Email to " + message.To + ", subject: " + message.Subject + "\n" + message.Body)
+	return nil
+}
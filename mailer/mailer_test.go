@@ -0,0 +1,36 @@
+package mailer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jafarlihi/addressbook/mailer"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal("Failed to create a temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	m := &mailer.FileMailer{Directory: filepath.Join(dir, "outbox"), From: "addressbook@localhost"}
+	err = m.Send(&mailer.Message{To: "valid@mail.com", Subject: "Subject", Body: "Body"})
+	if err != nil {
+		t.Fatalf("Send returned error %s", err.Error())
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "outbox", "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one email to be written, got %v", files)
+	}
+	content, _ := ioutil.ReadFile(files[0])
+	for _, expected := range []string{"From: addressbook@localhost\r\n", "To: valid@mail.com\r\n", "Subject: Subject\r\n", "\r\n\r\nBody"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Email doesn't contain %q: %s", expected, content)
+		}
+	}
+}
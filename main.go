@@ -1,26 +1,130 @@
 package main
 
 import (
-	"net/http"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 
-	gorillaHandlers "github.com/gorilla/handlers"
 	"github.com/jafarlihi/addressbook/config"
-	"github.com/jafarlihi/addressbook/database"
 	"github.com/jafarlihi/addressbook/logger"
-	"github.com/jafarlihi/addressbook/router"
 )
 
+// command is a subcommand of the addressbook binary, run returns the exit
+// code. Commands that report config problems themselves run even if the
+// config has problems.
+type command struct {
+	name            string
+	usage           string
+	run             func(args []string) int
+	reportsProblems bool
+}
+
+// commands are set up in init as they refer to themselves for printing
+// their usage.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"serve", "serve [-allow-pending-migrations]\n      serve the API, the default command", runServe, false},
+		{"migrate", "migrate up | down [steps] | status\n      apply the pending migrations, revert the last one(s), or list them", runMigrate, false},
+		{"user", "user create -username <username> -email <email> [-verified]\n" +
+			"  user list [-json]\n" +
+			"  user disable | enable <user>\n" +
+			"  user reset-password <user>\n" +
+			"      manage users, passwords are read from standard input", runUser, false},
+		{"export", "export -user <user> [-o <file>]\n      write the data export ZIP of a user to the file or standard output", runExport, false},
+		{"import", "import -user <user> [-format vcf | csv] [-preset google | outlook] [-mapping <json>] [-list <id>] [-dry-run] <file>\n" +
+			"      import contacts from a vCard or CSV file", runImport, false},
+		{"check-config", "check-config\n      check the config, signing keys, and database, and report the problems found", runCheckConfig, true},
+		{"print-config", "print-config\n      print the effective config as JSON, with secrets redacted", runPrintConfig, true},
+	}
+}
+
+// globalFlags are given before the command, they select the config file and
+// override its settings.
+var globalFlags = flag.NewFlagSet("addressbook", flag.ContinueOnError)
+
+// configErr holds the problems found while loading the config.
+var configErr error
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: addressbook [-config <file>] [-<setting> <value> ...] <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, command := range commands {
+		fmt.Fprintln(os.Stderr, "  "+command.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Users are given by their ID, username, or email.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags:")
+	globalFlags.PrintDefaults()
+}
+
 func main() {
+	config.RegisterFlags(globalFlags)
+	globalFlags.Usage = usage
+	if err := globalFlags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	// Running addressbook without a command serves the API.
+	name, args := "serve", globalFlags.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+
+	var selected *command
+	for _, command := range commands {
+		if command.name == name {
+			selected = command
+		}
+	}
+	if selected == nil {
+		fmt.Fprintln(os.Stderr, "Unknown command "+name)
+		usage()
+		os.Exit(2)
+	}
+
 	logger.InitLogger()
-	config.InitConfig()
-	database.InitDatabase()
+	configErr = config.InitConfig()
+	if configErr != nil && !selected.reportsProblems {
+		fmt.Fprintln(os.Stderr, "The config has problems:")
+		fmt.Fprintln(os.Stderr, configErr.Error())
+		os.Exit(1)
+	}
+	os.Exit(selected.run(args))
+}
 
-	router := router.ConstructRouter()
+// newFlagSet returns the flag set of a command, printing the usage of the
+// command on errors.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		commandUsage(strings.Fields(name)[0])
+		flags.PrintDefaults()
+	}
+	return flags
+}
 
-	origins := gorillaHandlers.AllowedOrigins([]string{"*"})
-	headers := gorillaHandlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
-	methods := gorillaHandlers.AllowedMethods([]string{"GET", "POST", "DELETE"})
+// commandUsage prints the usage of the command and returns the exit code of
+// misused commands.
+func commandUsage(name string) int {
+	for _, command := range commands {
+		if command.name == name {
+			fmt.Fprintln(os.Stderr, "Usage: addressbook "+command.usage)
+		}
+	}
+	return 2
+}
 
-	logger.Log.Info("Starting HTTP server listening at " + config.Config.HttpServer.Port)
-	logger.Log.Critical(http.ListenAndServe(":"+config.Config.HttpServer.Port, gorillaHandlers.CORS(origins, headers, methods)(router)))
+// fail prints the error and returns the exit code of failed commands.
+func fail(message string) int {
+	fmt.Fprintln(os.Stderr, "Error: "+message)
+	return 1
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jafarlihi/addressbook/database"
+)
+
+func runMigrate(args []string) int {
+	steps := 1
+	switch {
+	case len(args) == 1 && (args[0] == "up" || args[0] == "down" || args[0] == "status"):
+	case len(args) == 2 && args[0] == "down":
+		var err error
+		steps, err = strconv.Atoi(args[1])
+		if err != nil || steps < 1 {
+			return fail("Steps have to be a positive number")
+		}
+	default:
+		return commandUsage("migrate")
+	}
+
+	database.InitDatabase()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(database.Database)
+		for _, migration := range applied {
+			fmt.Println("Applied " + migration.Label())
+		}
+		if err != nil {
+			return fail(err.Error())
+		}
+		if len(applied) == 0 {
+			fmt.Println("The schema is up to date")
+		}
+	case "down":
+		reverted, err := database.MigrateDown(database.Database, steps)
+		for _, migration := range reverted {
+			fmt.Println("Reverted " + migration.Label())
+		}
+		if err != nil {
+			return fail(err.Error())
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations are applied")
+		}
+	case "status":
+		statuses, err := database.GetMigrationStatus(database.Database)
+		if err != nil {
+			return fail(err.Error())
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, status := range statuses {
+			state := "pending"
+			if status.Unknown {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05") + ", unknown to this binary"
+			} else if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, state)
+		}
+		w.Flush()
+	}
+	return 0
+}
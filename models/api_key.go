@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// APIKey is stored by the hash of the key, Prefix is kept so that users can
+// tell their keys apart. ExpiresAt is nil for keys that don't expire.
+type APIKey struct {
+	ID         uint32     `json:"id"`
+	UserID     uint32     `json:"userID"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	KeyHash    string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -1,9 +1,46 @@
 package models
 
 type Contact struct {
+	ID           uint32           `json:"id"`
+	UserID       uint32           `json:"userID"`
+	Name         string           `json:"name"`
+	Surname      string           `json:"surname"`
+	Email        string           `json:"email"`
+	PhoneNumbers []*PhoneNumber   `json:"phoneNumbers"`
+	Emails       []*EmailAddress  `json:"emails"`
+	Addresses    []*PostalAddress `json:"addresses"`
+	Notes        string           `json:"notes"`
+	Birthday     string           `json:"birthday"`
+	// Tags are managed through their own endpoints, they are ignored when
+	// creating or updating a contact.
+	Tags []string `json:"tags"`
+	// CustomFields maps the names of the user's custom fields to their
+	// values, which are strings, numbers, or booleans depending on the type.
+	CustomFields map[string]interface{} `json:"customFields"`
+	// VCardExtra holds the raw vCard properties this service doesn't
+	// understand, so that they survive an import/export round-trip.
+	VCardExtra string `json:"-"`
+}
+
+type PhoneNumber struct {
+	ID     uint32 `json:"id"`
+	Label  string `json:"label"`
+	Number string `json:"number"`
+}
+
+type EmailAddress struct {
 	ID      uint32 `json:"id"`
-	UserID  uint32 `json:"userID"`
-	Name    string `json:"name"`
-	Surname string `json:"surname"`
-	Email   string `json:"email"`
+	Label   string `json:"label"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
+type PostalAddress struct {
+	ID       uint32 `json:"id"`
+	Label    string `json:"label"`
+	Street   string `json:"street"`
+	City     string `json:"city"`
+	Region   string `json:"region"`
+	Postcode string `json:"postcode"`
+	Country  string `json:"country"`
 }
@@ -1,7 +1,10 @@
 package models
 
 type ContactList struct {
-	ID     uint32 `json:"id"`
-	UserID uint32 `json:"userID"`
-	Name   string `json:"name"`
+	ID          uint32 `json:"id"`
+	UserID      uint32 `json:"userID"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+	Archived    bool   `json:"archived"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ContactListShare grants another user a role on a contact-list, Username
+// and Email are those of the user it's shared with.
+type ContactListShare struct {
+	ContactListID uint32    `json:"contactListID"`
+	UserID        uint32    `json:"userID"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// SharedContactList is a contact-list another user has shared, Owner is
+// their username.
+type SharedContactList struct {
+	ContactList
+	Owner string `json:"owner"`
+	Role  string `json:"role"`
+}
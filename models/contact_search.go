@@ -0,0 +1,10 @@
+package models
+
+// ContactSearchResult is a contact matching a search query. Highlight holds
+// the matching fragments of the contact with the matched words wrapped in
+// <mark> and </mark>.
+type ContactSearchResult struct {
+	Contact   *Contact `json:"contact"`
+	Score     float64  `json:"score"`
+	Highlight string   `json:"highlight"`
+}
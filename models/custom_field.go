@@ -0,0 +1,20 @@
+package models
+
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldBool   = "bool"
+	CustomFieldEnum   = "enum"
+)
+
+// CustomField is a user-defined contact field. Options lists the allowed
+// values of enum fields and is empty for the other types.
+type CustomField struct {
+	ID       uint32   `json:"id"`
+	UserID   uint32   `json:"userID"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+}
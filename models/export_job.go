@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	ExportJobPending   = "pending"
+	ExportJobRunning   = "running"
+	ExportJobCompleted = "completed"
+	ExportJobFailed    = "failed"
+)
+
+// ExportJob builds a ZIP archive of all the data of a user in the
+// background. The archive is kept until ExpiresAt, which is set once the job
+// has completed.
+type ExportJob struct {
+	ID          uint32     `json:"id"`
+	UserID      uint32     `json:"userID"`
+	Status      string     `json:"status"`
+	Progress    int        `json:"progress"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
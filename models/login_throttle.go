@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginThrottle counts the failed attempts at logging in or confirming a
+// password or code under a throttle key, like an account or IP address.
+type LoginThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	BlockedUntil  *time.Time `json:"blockedUntil"`
+}
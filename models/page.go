@@ -0,0 +1,7 @@
+package models
+
+type Page struct {
+	Items interface{} `json:"items"`
+	Next  *string     `json:"next"`
+	Total int         `json:"total"`
+}
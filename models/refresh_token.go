@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken is stored by the hash of the token, the token itself is only
+// ever known to the client.
+type RefreshToken struct {
+	ID        uint32
+	UserID    uint32
+	Family    string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
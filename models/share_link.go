@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ShareLink gives anyone with its token read access to a contact-list or a
+// single contact, exactly one of ContactListID and ContactID is set. Fields
+// are the contact fields the link exposes. MaxViews is 0 for links without
+// a view limit.
+type ShareLink struct {
+	ID            uint32    `json:"id"`
+	UserID        uint32    `json:"userID"`
+	ContactListID *uint32   `json:"contactListID"`
+	ContactID     *uint32   `json:"contactID"`
+	TokenHash     string    `json:"-"`
+	PasswordHash  string    `json:"-"`
+	HasPassword   bool      `json:"hasPassword"`
+	Fields        []string  `json:"fields"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	MaxViews      int       `json:"maxViews"`
+	Views         int       `json:"views"`
+	Revoked       bool      `json:"revoked"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// OwnerInactive is set when looking a link up by its token, if its owner
+	// has been disabled or has scheduled the deletion of their account.
+	OwnerInactive bool `json:"-"`
+}
+
+// Results of accessing a share link.
+const (
+	ShareLinkAccessGranted       = "granted"
+	ShareLinkAccessWrongPassword = "wrong_password"
+	ShareLinkAccessRevoked       = "revoked"
+	ShareLinkAccessExpired       = "expired"
+	ShareLinkAccessViewsExceeded = "views_exceeded"
+	ShareLinkAccessOwnerInactive = "owner_inactive"
+)
+
+type ShareLinkAccess struct {
+	ID          uint32    `json:"id"`
+	ShareLinkID uint32    `json:"shareLinkID"`
+	AccessedAt  time.Time `json:"accessedAt"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"userAgent"`
+	Result      string    `json:"result"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type Tag struct {
+	ID     uint32 `json:"id"`
+	UserID uint32 `json:"userID"`
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+}
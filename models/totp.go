@@ -0,0 +1,11 @@
+package models
+
+// TOTPCredential is the TOTP secret of a user. It's only used for logging in
+// once Enabled, after the user has confirmed it with a code. LastUsedStep is
+// the time step of the last accepted code, codes can't be used twice.
+type TOTPCredential struct {
+	UserID       uint32
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
@@ -1,8 +1,13 @@
 package models
 
+import "time"
+
 type User struct {
-	ID       uint32 `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID                  uint32     `json:"id"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	Password            string     `json:"password"`
+	EmailVerified       bool       `json:"emailVerified"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+	Disabled            bool       `json:"disabled"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use token emailed to a user, stored by its hash.
+// Purpose is one of the UserToken constants.
+type UserToken struct {
+	ID        uint32
+	UserID    uint32
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	Used      bool
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func CreateAPIKey(db *sql.DB, key *models.APIKey) error {
+	sql := "INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at"
+	err := db.QueryRow(sql, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new API key, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func GetAPIKey(db *sql.DB, id uint32) (*models.APIKey, error) {
+	sql := "SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE id = $1"
+	row := db.QueryRow(sql, id)
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, (*pq.StringArray)(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT an API key, error: " + err.Error())
+		return nil, err
+	}
+	return &key, nil
+}
+
+func GetAPIKeysByUserID(db *sql.DB, userID uint32) ([]*models.APIKey, error) {
+	sql := "SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE user_id = $1 ORDER BY id"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT API keys, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		key := &models.APIKey{}
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, (*pq.StringArray)(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of API keys, error: " + err.Error())
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// UseAPIKey looks up an unexpired API key by its hash and records that it
+// has been used. It returns sql.ErrNoRows if the key is unknown or expired, or
+// if its user is disabled.
+func UseAPIKey(db *sql.DB, keyHash string) (*models.APIKey, error) {
+	sql := "UPDATE api_keys SET last_used_at = now() WHERE key_hash = $1 AND (expires_at IS NULL OR expires_at > now()) AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = api_keys.user_id AND users.disabled) RETURNING id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at"
+	row := db.QueryRow(sql, keyHash)
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, (*pq.StringArray)(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE an API key, error: " + err.Error())
+		return nil, err
+	}
+	return &key, nil
+}
+
+func DeleteAPIKey(db *sql.DB, id uint32) error {
+	sql := "DELETE FROM api_keys WHERE id = $1"
+	_, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE an API key, error: " + err.Error())
+		return err
+	}
+	return nil
+}
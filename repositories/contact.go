@@ -2,27 +2,48 @@ package repositories
 
 import (
 	"database/sql"
+	"sort"
+	"strconv"
 
 	"github.com/jafarlihi/addressbook/logger"
 	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
 )
 
-func CreateContact(db *sql.DB, userID uint32, name string, surname string, email string) (int64, error) {
-	sql := "INSERT INTO contacts (user_id, name, surname, email) VALUES ($1, $2, $3, $4) RETURNING id"
+func CreateContact(db *sql.DB, contact *models.Contact) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sql := "INSERT INTO contacts (user_id, name, surname, email, notes, birthday, vcard_extra, search_text) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
 	var id int64
-	err := db.QueryRow(sql, userID, name, surname, email).Scan(&id)
+	err = tx.QueryRow(sql, contact.UserID, contact.Name, contact.Surname, contact.Email, contact.Notes, contact.Birthday, contact.VCardExtra, contactSearchText(contact)).Scan(&id)
 	if err != nil {
 		logger.Log.Error("Failed to INSERT a new contact, error: " + err.Error())
 		return 0, err
 	}
+
+	err = insertContactDetails(tx, uint32(id), contact)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit a new contact, error: " + err.Error())
+		return 0, err
+	}
 	return id, nil
 }
 
 func GetContact(db *sql.DB, id uint32) (*models.Contact, error) {
-	sql := "SELECT id, user_id, name, surname, email FROM contacts WHERE id = $1"
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts WHERE id = $1"
 	row := db.QueryRow(sql, id)
 	var contact models.Contact
-	err := row.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email)
+	err := row.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT a contact, error: " + err.Error())
 		return nil, err
@@ -41,7 +62,7 @@ func DeleteContact(db *sql.DB, id uint32) error {
 }
 
 func GetContactsByUserID(db *sql.DB, userID uint32) ([]*models.Contact, error) {
-	sql := "SELECT id, user_id, name, surname, email FROM contacts WHERE user_id = $1"
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts WHERE user_id = $1"
 	rows, err := db.Query(sql, userID)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT contacts, error: " + err.Error())
@@ -52,17 +73,23 @@ func GetContactsByUserID(db *sql.DB, userID uint32) ([]*models.Contact, error) {
 	contacts := make([]*models.Contact, 0)
 	for rows.Next() {
 		contact := &models.Contact{}
-		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email); err != nil {
+		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra); err != nil {
 			logger.Log.Error("Failed to scan SELECTed row of contacts, error: " + err.Error())
 			return nil, err
 		}
 		contacts = append(contacts, contact)
 	}
+	rows.Close()
+
+	err = LoadContactDetails(db, contacts)
+	if err != nil {
+		return nil, err
+	}
 	return contacts, nil
 }
 
 func GetContactsOfContactList(db *sql.DB, contactListID uint32) ([]*models.Contact, error) {
-	sql := "SELECT id, user_id, name, surname, email FROM contacts WHERE id IN (SELECT contact FROM contact_list_entries WHERE contact_list = $1)"
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts WHERE id IN (SELECT contact FROM contact_list_entries WHERE contact_list = $1)"
 	rows, err := db.Query(sql, contactListID)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT contacts, error: " + err.Error())
@@ -73,11 +100,215 @@ func GetContactsOfContactList(db *sql.DB, contactListID uint32) ([]*models.Conta
 	contacts := make([]*models.Contact, 0)
 	for rows.Next() {
 		contact := &models.Contact{}
-		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email); err != nil {
+		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra); err != nil {
 			logger.Log.Error("Failed to scan SELECTed row of contacts, error: " + err.Error())
 			return nil, err
 		}
 		contacts = append(contacts, contact)
 	}
+	rows.Close()
+
+	err = LoadContactDetails(db, contacts)
+	if err != nil {
+		return nil, err
+	}
 	return contacts, nil
 }
+
+func UpdateContact(db *sql.DB, contact *models.Contact) error {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE contacts SET name = $2, surname = $3, email = $4, notes = $5, birthday = $6, vcard_extra = $7, search_text = $8 WHERE id = $1"
+	_, err = tx.Exec(sql, contact.ID, contact.Name, contact.Surname, contact.Email, contact.Notes, contact.Birthday, contact.VCardExtra, contactSearchText(contact))
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a contact, error: " + err.Error())
+		return err
+	}
+
+	err = deleteContactDetails(tx, contact.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertContactDetails(tx, contact.ID, contact)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit an updated contact, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+const contactStreamBatchSize = 500
+
+// StreamContactsByUserID calls f for every contact of the user without
+// loading all of them into memory. Contact details are loaded in batches.
+func StreamContactsByUserID(db *sql.DB, userID uint32, f func(*models.Contact) error) error {
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts WHERE user_id = $1"
+	return streamContacts(db, f, sql, userID)
+}
+
+// StreamContactsOfContactList calls f for every contact of the contact-list
+// without loading all of them into memory.
+func StreamContactsOfContactList(db *sql.DB, contactListID uint32, f func(*models.Contact) error) error {
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts WHERE id IN (SELECT contact FROM contact_list_entries WHERE contact_list = $1)"
+	return streamContacts(db, f, sql, contactListID)
+}
+
+// streamContacts pages through the contacts the query selects by their IDs,
+// a batch at a time. Each batch is read and its rows closed before its
+// details are loaded, so that only one connection is held at a time.
+func streamContacts(db *sql.DB, f func(*models.Contact) error, query string, args ...interface{}) error {
+	query += " AND id > $" + strconv.Itoa(len(args)+1) + " ORDER BY id LIMIT " + strconv.Itoa(contactStreamBatchSize)
+	args = append(args, uint32(0))
+	for {
+		batch, err := selectContactBatch(db, query, args...)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := LoadContactDetails(db, batch); err != nil {
+			return err
+		}
+		for _, contact := range batch {
+			if err := f(contact); err != nil {
+				return err
+			}
+		}
+		if len(batch) < contactStreamBatchSize {
+			return nil
+		}
+		args[len(args)-1] = batch[len(batch)-1].ID
+	}
+}
+
+func selectContactBatch(db *sql.DB, query string, args ...interface{}) ([]*models.Contact, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contacts, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	batch := make([]*models.Contact, 0, contactStreamBatchSize)
+	for rows.Next() {
+		contact := &models.Contact{}
+		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contacts, error: " + err.Error())
+			return nil, err
+		}
+		batch = append(batch, contact)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Log.Error("Failed to iterate SELECTed rows of contacts, error: " + err.Error())
+		return nil, err
+	}
+	return batch, nil
+}
+
+var ContactSortColumns = []string{"id", "name", "surname", "email"}
+var ContactFilters = []string{"email_domain", "name_prefix"}
+
+func ListContactsByUserID(db *sql.DB, userID uint32, options *ListOptions) (*models.Page, error) {
+	query := &listQuery{}
+	query.where("user_id = ?", userID)
+	return listContacts(db, query, options)
+}
+
+func ListContactsOfContactList(db *sql.DB, contactListID uint32, options *ListOptions) (*models.Page, error) {
+	query := &listQuery{}
+	query.where("id IN (SELECT contact FROM contact_list_entries WHERE contact_list = ?)", contactListID)
+	return listContacts(db, query, options)
+}
+
+func listContacts(db *sql.DB, query *listQuery, options *ListOptions) (*models.Page, error) {
+	if domain, ok := options.Filters["email_domain"]; ok {
+		query.where("lower(split_part(email, '@', 2)) = lower(?)", domain)
+	}
+	if prefix, ok := options.Filters["name_prefix"]; ok {
+		query.where("lower(name) LIKE lower(?) || '%'", escapeLike(prefix))
+	}
+	if len(options.Tags) > 0 {
+		tagged := "SELECT ct.contact FROM contact_tags ct JOIN tags t ON t.id = ct.tag WHERE t.name = ANY(?)"
+		if options.AnyTag {
+			query.where("id IN ("+tagged+")", pq.Array(options.Tags))
+		} else {
+			query.where("id IN ("+tagged+" GROUP BY ct.contact HAVING COUNT(*) = ?)", pq.Array(options.Tags), len(options.Tags))
+		}
+	}
+	names := make([]string, 0, len(options.CustomFields))
+	for name := range options.CustomFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		query.where("id IN (SELECT v.contact FROM contact_custom_values v JOIN custom_fields f ON f.id = v.field WHERE f.name = ? AND v.value = ?)", name, customFieldText(options.CustomFields[name]))
+	}
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM contacts"+query.whereClause(), query.args...).Scan(&total)
+	if err != nil {
+		logger.Log.Error("Failed to COUNT contacts, error: " + err.Error())
+		return nil, err
+	}
+
+	query.keyset(options.Sort, options.After)
+	sql := "SELECT id, user_id, name, surname, email, notes, birthday, vcard_extra FROM contacts" + query.whereClause() + orderClause(options.Sort) + " LIMIT " + strconv.Itoa(options.Limit+1)
+	rows, err := db.Query(sql, query.args...)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contacts, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make([]*models.Contact, 0)
+	for rows.Next() {
+		contact := &models.Contact{}
+		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contacts, error: " + err.Error())
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	rows.Close()
+
+	page := &models.Page{Total: total}
+	if len(contacts) > options.Limit {
+		contacts = contacts[:options.Limit]
+		last := contacts[len(contacts)-1]
+		values := make([]interface{}, len(options.Sort))
+		for i, field := range options.Sort {
+			switch field.Column {
+			case "id":
+				values[i] = last.ID
+			case "name":
+				values[i] = last.Name
+			case "surname":
+				values[i] = last.Surname
+			case "email":
+				values[i] = last.Email
+			}
+		}
+		next := EncodeCursor(options.Sort, values)
+		page.Next = &next
+	}
+
+	err = LoadContactDetails(db, contacts)
+	if err != nil {
+		return nil, err
+	}
+	page.Items = contacts
+	return page, nil
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func insertContactDetails(tx *sql.Tx, contactID uint32, contact *models.Contact) error {
+	for _, phoneNumber := range contact.PhoneNumbers {
+		query := "INSERT INTO contact_phone_numbers (contact, label, number) VALUES ($1, $2, $3)"
+		_, err := tx.Exec(query, contactID, phoneNumber.Label, phoneNumber.Number)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new contact phone number, error: " + err.Error())
+			return err
+		}
+	}
+	for _, email := range contact.Emails {
+		query := "INSERT INTO contact_emails (contact, label, address, is_primary) VALUES ($1, $2, $3, $4)"
+		_, err := tx.Exec(query, contactID, email.Label, email.Address, email.Primary)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new contact email, error: " + err.Error())
+			return err
+		}
+	}
+	for _, address := range contact.Addresses {
+		query := "INSERT INTO contact_addresses (contact, label, street, city, region, postcode, country) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+		_, err := tx.Exec(query, contactID, address.Label, address.Street, address.City, address.Region, address.Postcode, address.Country)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new contact address, error: " + err.Error())
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(contact.CustomFields))
+	for name := range contact.CustomFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		query := "INSERT INTO contact_custom_values (contact, field, value) SELECT $1, id, $2 FROM custom_fields WHERE user_id = $3 AND name = $4"
+		_, err := tx.Exec(query, contactID, customFieldText(contact.CustomFields[name]), contact.UserID, name)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new contact custom value, error: " + err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteContactDetails(tx *sql.Tx, contactID uint32) error {
+	for _, table := range []string{"contact_phone_numbers", "contact_emails", "contact_addresses", "contact_custom_values"} {
+		_, err := tx.Exec("DELETE FROM "+table+" WHERE contact = $1", contactID)
+		if err != nil {
+			logger.Log.Error("Failed to DELETE from " + table + ", error: " + err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadContactDetails fills in phone numbers, emails, postal addresses, tags
+// and custom fields of the given contacts. Each kind of detail is fetched with a single query for
+// all of the contacts.
+func LoadContactDetails(db *sql.DB, contacts []*models.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	contactsByID := make(map[uint32]*models.Contact, len(contacts))
+	ids := make([]int64, 0, len(contacts))
+	for _, contact := range contacts {
+		contact.PhoneNumbers = make([]*models.PhoneNumber, 0)
+		contact.Emails = make([]*models.EmailAddress, 0)
+		contact.Addresses = make([]*models.PostalAddress, 0)
+		contact.Tags = make([]string, 0)
+		contact.CustomFields = make(map[string]interface{})
+		contactsByID[contact.ID] = contact
+		ids = append(ids, int64(contact.ID))
+	}
+
+	query := "SELECT id, contact, label, number FROM contact_phone_numbers WHERE contact = ANY($1) ORDER BY id"
+	rows, err := db.Query(query, pq.Array(ids))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact phone numbers, error: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactID uint32
+		phoneNumber := &models.PhoneNumber{}
+		if err := rows.Scan(&phoneNumber.ID, &contactID, &phoneNumber.Label, &phoneNumber.Number); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact phone numbers, error: " + err.Error())
+			return err
+		}
+		contactsByID[contactID].PhoneNumbers = append(contactsByID[contactID].PhoneNumbers, phoneNumber)
+	}
+
+	query = "SELECT id, contact, label, address, is_primary FROM contact_emails WHERE contact = ANY($1) ORDER BY id"
+	rows, err = db.Query(query, pq.Array(ids))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact emails, error: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactID uint32
+		email := &models.EmailAddress{}
+		if err := rows.Scan(&email.ID, &contactID, &email.Label, &email.Address, &email.Primary); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact emails, error: " + err.Error())
+			return err
+		}
+		contactsByID[contactID].Emails = append(contactsByID[contactID].Emails, email)
+	}
+
+	query = "SELECT id, contact, label, street, city, region, postcode, country FROM contact_addresses WHERE contact = ANY($1) ORDER BY id"
+	rows, err = db.Query(query, pq.Array(ids))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact addresses, error: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactID uint32
+		address := &models.PostalAddress{}
+		if err := rows.Scan(&address.ID, &contactID, &address.Label, &address.Street, &address.City, &address.Region, &address.Postcode, &address.Country); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact addresses, error: " + err.Error())
+			return err
+		}
+		contactsByID[contactID].Addresses = append(contactsByID[contactID].Addresses, address)
+	}
+
+	query = "SELECT ct.contact, t.name FROM contact_tags ct JOIN tags t ON t.id = ct.tag WHERE ct.contact = ANY($1) ORDER BY t.name"
+	rows, err = db.Query(query, pq.Array(ids))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact tags, error: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactID uint32
+		var tag string
+		if err := rows.Scan(&contactID, &tag); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact tags, error: " + err.Error())
+			return err
+		}
+		contactsByID[contactID].Tags = append(contactsByID[contactID].Tags, tag)
+	}
+
+	query = "SELECT v.contact, f.name, f.type, v.value FROM contact_custom_values v JOIN custom_fields f ON f.id = v.field WHERE v.contact = ANY($1)"
+	rows, err = db.Query(query, pq.Array(ids))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact custom values, error: " + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var contactID uint32
+		var name, fieldType, value string
+		if err := rows.Scan(&contactID, &name, &fieldType, &value); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact custom values, error: " + err.Error())
+			return err
+		}
+		contactsByID[contactID].CustomFields[name] = customFieldValue(fieldType, value)
+	}
+	return nil
+}
@@ -2,34 +2,63 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
+	"strconv"
 
 	"github.com/jafarlihi/addressbook/logger"
 	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
 )
 
+var ErrContactListNameTaken = errors.New("Another contact-list with this name already exists")
+
+// uniqueContactListError maps violations of the unique index on the names of
+// a user's contact-lists to ErrContactListNameTaken, returning other errors
+// as they are.
+func uniqueContactListError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "contact_lists_user_id_name_idx" {
+		return ErrContactListNameTaken
+	}
+	return err
+}
+
+// CreateContactList returns ErrContactListNameTaken if the user already has
+// a contact-list with the name.
 func CreateContactList(db *sql.DB, userID uint32, name string) (int64, error) {
 	sql := "INSERT INTO contact_lists (user_id, name) VALUES ($1, $2) RETURNING id"
 	var id int64
 	err := db.QueryRow(sql, userID, name).Scan(&id)
 	if err != nil {
 		logger.Log.Error("Failed to INSERT a new contact-list, error: " + err.Error())
-		return 0, err
+		return 0, uniqueContactListError(err)
 	}
 	return id, nil
 }
 
 func GetContactList(db *sql.DB, id uint32) (*models.ContactList, error) {
-	sql := "SELECT id, user_id, name FROM contact_lists WHERE id = $1"
+	sql := "SELECT id, user_id, name, description, color, archived FROM contact_lists WHERE id = $1"
 	row := db.QueryRow(sql, id)
 	var contactList models.ContactList
-	err := row.Scan(&contactList.ID, &contactList.UserID, &contactList.Name)
+	err := row.Scan(&contactList.ID, &contactList.UserID, &contactList.Name, &contactList.Description, &contactList.Color, &contactList.Archived)
 	if err != nil {
-		logger.Log.Error("Failed to SELECT a contact, error: " + err.Error())
+		logger.Log.Error("Failed to SELECT a contact-list, error: " + err.Error())
 		return nil, err
 	}
 	return &contactList, nil
 }
 
+// UpdateContactList returns ErrContactListNameTaken if another contact-list
+// of the user already has the name.
+func UpdateContactList(db *sql.DB, id uint32, name string, description string, color string, archived bool) error {
+	sql := "UPDATE contact_lists SET name = $2, description = $3, color = $4, archived = $5 WHERE id = $1"
+	_, err := db.Exec(sql, id, name, description, color, archived)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a contact-list, error: " + err.Error())
+		return uniqueContactListError(err)
+	}
+	return nil
+}
+
 func DeleteContactList(db *sql.DB, id uint32) error {
 	sql := "DELETE FROM contact_lists WHERE id = $1"
 	_, err := db.Query(sql, id)
@@ -41,7 +70,7 @@ func DeleteContactList(db *sql.DB, id uint32) error {
 }
 
 func GetContactListsByUserID(db *sql.DB, userID uint32) ([]*models.ContactList, error) {
-	sql := "SELECT id, user_id, name FROM contact_lists WHERE user_id = $1"
+	sql := "SELECT id, user_id, name, description, color, archived FROM contact_lists WHERE user_id = $1"
 	rows, err := db.Query(sql, userID)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT contact-lists, error: " + err.Error())
@@ -52,7 +81,7 @@ func GetContactListsByUserID(db *sql.DB, userID uint32) ([]*models.ContactList,
 	contactLists := make([]*models.ContactList, 0)
 	for rows.Next() {
 		contactList := &models.ContactList{}
-		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name); err != nil {
+		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name, &contactList.Description, &contactList.Color, &contactList.Archived); err != nil {
 			logger.Log.Error("Failed to scan SELECTed row of contact-lists, error: " + err.Error())
 			return nil, err
 		}
@@ -62,7 +91,7 @@ func GetContactListsByUserID(db *sql.DB, userID uint32) ([]*models.ContactList,
 }
 
 func SearchContactListsByName(db *sql.DB, userID uint32, term string) ([]*models.ContactList, error) {
-	sql := "SELECT id, user_id, name FROM contact_lists WHERE user_id = $1 AND name ILIKE '%' || $2 || '%'"
+	sql := "SELECT id, user_id, name, description, color, archived FROM contact_lists WHERE user_id = $1 AND name ILIKE '%' || $2 || '%'"
 	rows, err := db.Query(sql, userID, term)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT contact-lists, error: " + err.Error())
@@ -73,7 +102,7 @@ func SearchContactListsByName(db *sql.DB, userID uint32, term string) ([]*models
 	contactLists := make([]*models.ContactList, 0)
 	for rows.Next() {
 		contactList := &models.ContactList{}
-		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name); err != nil {
+		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name, &contactList.Description, &contactList.Color, &contactList.Archived); err != nil {
 			logger.Log.Error("Failed to scan SELECTed row of contact-lists, error: " + err.Error())
 			return nil, err
 		}
@@ -101,3 +130,59 @@ func DeleteContactFromContactList(db *sql.DB, contactListID uint32, contactID ui
 	}
 	return nil
 }
+
+var ContactListSortColumns = []string{"id", "name"}
+var ContactListFilters = []string{"name_prefix"}
+
+func ListContactListsByUserID(db *sql.DB, userID uint32, options *ListOptions) (*models.Page, error) {
+	query := &listQuery{}
+	query.where("user_id = ?", userID)
+	if prefix, ok := options.Filters["name_prefix"]; ok {
+		query.where("lower(name) LIKE lower(?) || '%'", escapeLike(prefix))
+	}
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM contact_lists"+query.whereClause(), query.args...).Scan(&total)
+	if err != nil {
+		logger.Log.Error("Failed to COUNT contact-lists, error: " + err.Error())
+		return nil, err
+	}
+
+	query.keyset(options.Sort, options.After)
+	sql := "SELECT id, user_id, name, description, color, archived FROM contact_lists" + query.whereClause() + orderClause(options.Sort) + " LIMIT " + strconv.Itoa(options.Limit+1)
+	rows, err := db.Query(sql, query.args...)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact-lists, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	contactLists := make([]*models.ContactList, 0)
+	for rows.Next() {
+		contactList := &models.ContactList{}
+		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name, &contactList.Description, &contactList.Color, &contactList.Archived); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact-lists, error: " + err.Error())
+			return nil, err
+		}
+		contactLists = append(contactLists, contactList)
+	}
+
+	page := &models.Page{Total: total}
+	if len(contactLists) > options.Limit {
+		contactLists = contactLists[:options.Limit]
+		last := contactLists[len(contactLists)-1]
+		values := make([]interface{}, len(options.Sort))
+		for i, field := range options.Sort {
+			switch field.Column {
+			case "id":
+				values[i] = last.ID
+			case "name":
+				values[i] = last.Name
+			}
+		}
+		next := EncodeCursor(options.Sort, values)
+		page.Next = &next
+	}
+	page.Items = contactLists
+	return page, nil
+}
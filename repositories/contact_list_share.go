@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+)
+
+// ShareContactList shares the contact-list with the user, changing the role
+// if it has already been shared with them.
+func ShareContactList(db *sql.DB, contactListID uint32, userID uint32, role string) error {
+	sql := "INSERT INTO contact_list_shares (contact_list, user_id, role) VALUES ($1, $2, $3) ON CONFLICT (contact_list, user_id) DO UPDATE SET role = $3"
+	_, err := db.Exec(sql, contactListID, userID, role)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a contact-list share, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetContactListShareRole returns sql.ErrNoRows if the contact-list hasn't
+// been shared with the user.
+func GetContactListShareRole(db *sql.DB, contactListID uint32, userID uint32) (string, error) {
+	sql := "SELECT role FROM contact_list_shares WHERE contact_list = $1 AND user_id = $2"
+	var role string
+	err := db.QueryRow(sql, contactListID, userID).Scan(&role)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a contact-list share, error: " + err.Error())
+		return "", err
+	}
+	return role, nil
+}
+
+func GetContactListShares(db *sql.DB, contactListID uint32) ([]*models.ContactListShare, error) {
+	sql := "SELECT s.contact_list, s.user_id, u.username, u.email, s.role, s.created_at FROM contact_list_shares s JOIN users u ON u.id = s.user_id WHERE s.contact_list = $1 ORDER BY s.created_at"
+	rows, err := db.Query(sql, contactListID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT contact-list shares, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]*models.ContactListShare, 0)
+	for rows.Next() {
+		share := &models.ContactListShare{}
+		if err := rows.Scan(&share.ContactListID, &share.UserID, &share.Username, &share.Email, &share.Role, &share.CreatedAt); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of contact-list shares, error: " + err.Error())
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// DeleteContactListShare returns false if the contact-list wasn't shared
+// with the user. The contacts the user has added to the list are removed
+// from it, so that the owner can't keep reading them once the share ends.
+func DeleteContactListShare(db *sql.DB, contactListID uint32, userID uint32) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return false, err
+	}
+	defer tx.Rollback()
+
+	sql := "DELETE FROM contact_list_shares WHERE contact_list = $1 AND user_id = $2"
+	result, err := tx.Exec(sql, contactListID, userID)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE a contact-list share, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected != 1 {
+		return false, nil
+	}
+
+	sql = "DELETE FROM contact_list_entries WHERE contact_list = $1 AND contact IN (SELECT id FROM contacts WHERE user_id = $2)"
+	_, err = tx.Exec(sql, contactListID, userID)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE the contacts of a shared user from a contact-list, error: " + err.Error())
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit a deleted contact-list share, error: " + err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+func GetContactListsSharedWithUser(db *sql.DB, userID uint32) ([]*models.SharedContactList, error) {
+	sql := "SELECT l.id, l.user_id, l.name, l.description, l.color, l.archived, u.username, s.role FROM contact_list_shares s JOIN contact_lists l ON l.id = s.contact_list JOIN users u ON u.id = l.user_id WHERE s.user_id = $1 ORDER BY l.name"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT shared contact-lists, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	contactLists := make([]*models.SharedContactList, 0)
+	for rows.Next() {
+		contactList := &models.SharedContactList{}
+		if err := rows.Scan(&contactList.ID, &contactList.UserID, &contactList.Name, &contactList.Description, &contactList.Color, &contactList.Archived, &contactList.Owner, &contactList.Role); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of shared contact-lists, error: " + err.Error())
+			return nil, err
+		}
+		contactLists = append(contactLists, contactList)
+	}
+	return contactLists, nil
+}
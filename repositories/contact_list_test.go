@@ -36,3 +36,29 @@ func TestCreateContactList(t *testing.T) {
 		t.Errorf("Returned ID '%d' does not match the expectations", returnedID)
 	}
 }
+
+func TestUpdateContactList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var id uint32
+	id = 1
+	name := "name"
+	description := "description"
+	color := "#ff0000"
+	archived := true
+
+	mock.ExpectExec("^UPDATE contact_lists").WithArgs(id, name, description, color, archived).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = repositories.UpdateContactList(db, id, name, description, color, archived)
+	if err != nil {
+		t.Errorf("Error was not expected while updating the contact-list: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
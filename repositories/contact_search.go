@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+)
+
+// contactSearchText joins the searchable fields of a contact into the text
+// stored in contacts.search_text, which the full-text and trigram indexes are
+// built on. It's kept in the contacts table because the indexes can't span
+// the detail tables.
+func contactSearchText(contact *models.Contact) string {
+	parts := []string{contact.Name, contact.Surname, contact.Email}
+	for _, email := range contact.Emails {
+		if email.Address != contact.Email {
+			parts = append(parts, email.Address)
+		}
+	}
+	for _, phoneNumber := range contact.PhoneNumbers {
+		parts = append(parts, phoneNumber.Number)
+	}
+	parts = append(parts, contact.Notes)
+
+	text := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			text = append(text, part)
+		}
+	}
+	return strings.Join(text, " ")
+}
+
+// SearchContacts ranks the contacts of the user against the query, matching
+// whole words with full-text search and misspelled or partial words with
+// trigram similarity.
+func SearchContacts(db *sql.DB, userID uint32, query string, limit int) ([]*models.ContactSearchResult, error) {
+	sql := `SELECT c.id, c.user_id, c.name, c.surname, c.email, c.notes, c.birthday, c.vcard_extra,
+		ts_rank(c.search_vector, q.query) + word_similarity($2, c.search_text) AS score,
+		ts_headline('simple', c.search_text, q.query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, FragmentDelimiter=" ... "') AS highlight
+		FROM contacts c, websearch_to_tsquery('simple', $2) q(query)
+		WHERE c.user_id = $1 AND (c.search_vector @@ q.query OR $2 <% c.search_text)
+		ORDER BY score DESC, c.id LIMIT $3`
+	rows, err := db.Query(sql, userID, query, limit)
+	if err != nil {
+		logger.Log.Error("Failed to search contacts, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*models.ContactSearchResult, 0)
+	contacts := make([]*models.Contact, 0)
+	for rows.Next() {
+		result := &models.ContactSearchResult{Contact: &models.Contact{}}
+		contact := result.Contact
+		if err := rows.Scan(&contact.ID, &contact.UserID, &contact.Name, &contact.Surname, &contact.Email, &contact.Notes, &contact.Birthday, &contact.VCardExtra, &result.Score, &result.Highlight); err != nil {
+			logger.Log.Error("Failed to scan searched row of contacts, error: " + err.Error())
+			return nil, err
+		}
+		results = append(results, result)
+		contacts = append(contacts, contact)
+	}
+	rows.Close()
+
+	err = LoadContactDetails(db, contacts)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -1,9 +1,11 @@
 package repositories_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/models"
 	"github.com/jafarlihi/addressbook/repositories"
 )
 
@@ -22,10 +24,24 @@ func TestCreateContact(t *testing.T) {
 	surname := "surname"
 	email := "contact@email.com"
 
+	phoneNumber := "+1 555 0100"
+
 	rows := sqlmock.NewRows([]string{"id"}).AddRow(id)
-	mock.ExpectQuery("^INSERT INTO contacts").WithArgs(userID, name, surname, email).WillReturnRows(rows)
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO contacts").WithArgs(userID, name, surname, email, "", "", "", name+" "+surname+" "+email+" "+phoneNumber).WillReturnRows(rows)
+	mock.ExpectExec("^INSERT INTO contact_phone_numbers").WithArgs(id, "work", phoneNumber).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(id, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	returnedID, err := repositories.CreateContact(db, userID, name, surname, email)
+	contact := &models.Contact{
+		UserID:       userID,
+		Name:         name,
+		Surname:      surname,
+		Email:        email,
+		PhoneNumbers: []*models.PhoneNumber{{Label: "work", Number: phoneNumber}},
+		Emails:       []*models.EmailAddress{{Address: email, Primary: true}},
+	}
+	returnedID, err := repositories.CreateContact(db, contact)
 	if err != nil {
 		t.Errorf("Error was not expected while creating the contact: %s", err)
 	}
@@ -38,3 +54,242 @@ func TestCreateContact(t *testing.T) {
 		t.Errorf("Returned ID '%d' does not match the expectations", returnedID)
 	}
 }
+
+func TestUpdateContact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var id uint32
+	id = 1
+	name := "name"
+	surname := "surname"
+	email := "contact@email.com"
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE contacts").WithArgs(id, name, surname, email, "", "", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_phone_numbers").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_emails").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM contact_addresses").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^DELETE FROM contact_custom_values").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO contact_emails").WithArgs(id, "", email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	contact := &models.Contact{
+		ID:      id,
+		Name:    name,
+		Surname: surname,
+		Email:   email,
+		Emails:  []*models.EmailAddress{{Address: email, Primary: true}},
+	}
+	err = repositories.UpdateContact(db, contact)
+	if err != nil {
+		t.Errorf("Error was not expected while updating the contact: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetContactsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(1, userID, "name", "surname", "first@email.com", "", "", "").
+		AddRow(2, userID, "name2", "surname2", "second@email.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE user_id").WithArgs(userID).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.+) FROM contact_phone_numbers WHERE contact = ANY").WithArgs("{1,2}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}).AddRow(1, 2, "home", "555 0100"))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_emails WHERE contact = ANY").WithArgs("{1,2}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}).AddRow(1, 1, "", "first@email.com", true).AddRow(2, 2, "", "second@email.com", true))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_addresses WHERE contact = ANY").WithArgs("{1,2}").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}).AddRow(1, 1, "home", "Street 1", "City", "", "", "Country"))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	contacts, err := repositories.GetContactsByUserID(db, userID)
+	if err != nil {
+		t.Errorf("Error was not expected while fetching the contacts: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(contacts) != 2 || len(contacts[0].Emails) != 1 || len(contacts[0].Addresses) != 1 || len(contacts[0].PhoneNumbers) != 0 ||
+		len(contacts[1].PhoneNumbers) != 1 || contacts[1].PhoneNumbers[0].Number != "555 0100" || contacts[1].Emails[0].Address != "second@email.com" {
+		t.Errorf("Returned contacts do not match the expectations")
+	}
+}
+
+func TestStreamContactsOfContactList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var contactListID uint32
+	contactListID = 1
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(1, 1, "name", "surname", "first@email.com", "", "", "").
+		AddRow(2, 1, "name2", "surname2", "second@email.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE id IN (.+) AND id > \\$2 ORDER BY id LIMIT 500$").WithArgs(contactListID, 0).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.+) FROM contact_phone_numbers").WithArgs("{1,2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_emails").WithArgs("{1,2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_addresses").WithArgs("{1,2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	streamed := make([]uint32, 0)
+	err = repositories.StreamContactsOfContactList(db, contactListID, func(contact *models.Contact) error {
+		streamed = append(streamed, contact.ID)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Error was not expected while streaming the contacts: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(streamed) != 2 || streamed[0] != 1 || streamed[1] != 2 {
+		t.Errorf("Streamed contacts do not match the expectations")
+	}
+}
+
+func TestListContactsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+
+	sort, err := repositories.ParseSort("surname", repositories.ContactSortColumns)
+	if err != nil {
+		t.Fatalf("Error was not expected while parsing the sort: %s", err)
+	}
+	options := &repositories.ListOptions{Limit: 1, Sort: sort, Filters: map[string]string{"email_domain": "email.com"}}
+
+	mock.ExpectQuery("^SELECT COUNT\\(\\*\\) FROM contacts WHERE user_id = \\$1 AND lower\\(split_part").WithArgs(userID, "email.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}).
+		AddRow(1, userID, "name", "surname", "first@email.com", "", "", "").
+		AddRow(2, userID, "name2", "surname2", "second@email.com", "", "", "")
+	mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE (.+) ORDER BY surname, id LIMIT 2$").WithArgs(userID, "email.com").WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.+) FROM contact_phone_numbers").WithArgs("{1}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_emails").WithArgs("{1}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_addresses").WithArgs("{1}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	page, err := repositories.ListContactsByUserID(db, userID, options)
+	if err != nil {
+		t.Fatalf("Error was not expected while listing the contacts: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	contacts := page.Items.([]*models.Contact)
+	if page.Total != 2 || len(contacts) != 1 || contacts[0].ID != 1 || page.Next == nil {
+		t.Fatalf("Returned page does not match the expectations")
+	}
+
+	after, err := repositories.DecodeCursor(*page.Next, sort)
+	if err != nil {
+		t.Fatalf("Error was not expected while decoding the cursor: %s", err)
+	}
+	if len(after) != 2 || after[0] != "surname" || after[1].(json.Number).String() != "1" {
+		t.Errorf("Decoded cursor does not match the expectations: %v", after)
+	}
+
+	otherSort, _ := repositories.ParseSort("-surname", repositories.ContactSortColumns)
+	if _, err := repositories.DecodeCursor(*page.Next, otherSort); err == nil {
+		t.Errorf("Cursor was expected to be rejected for a different sort order")
+	}
+}
+
+func TestSearchContacts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+	query := "jhon"
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra", "score", "highlight"}).
+		AddRow(2, userID, "John", "Doe", "john@email.com", "", "", "", 0.5, "John Doe john@email.com")
+	mock.ExpectQuery("^SELECT (.+) FROM contacts c, websearch_to_tsquery").WithArgs(userID, query, 20).WillReturnRows(rows)
+	mock.ExpectQuery("^SELECT (.+) FROM contact_phone_numbers").WithArgs("{2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "number"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_emails").WithArgs("{2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "address", "is_primary"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_addresses").WithArgs("{2}").WillReturnRows(sqlmock.NewRows([]string{"id", "contact", "label", "street", "city", "region", "postcode", "country"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_tags").WillReturnRows(sqlmock.NewRows([]string{"contact", "name"}))
+	mock.ExpectQuery("^SELECT (.+) FROM contact_custom_values").WillReturnRows(sqlmock.NewRows([]string{"contact", "name", "type", "value"}))
+
+	results, err := repositories.SearchContacts(db, userID, query, 20)
+	if err != nil {
+		t.Errorf("Error was not expected while searching the contacts: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(results) != 1 || results[0].Contact.ID != 2 || results[0].Score != 0.5 || results[0].Highlight == "" {
+		t.Errorf("Returned search results do not match the expectations")
+	}
+}
+
+func TestCreateContactWithCustomFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var id uint32
+	id = 1
+	var userID uint32
+	userID = 1
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO contacts").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectExec("^INSERT INTO contact_custom_values (.+) FROM custom_fields").WithArgs(id, "1042", userID, "Customer ID").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO contact_custom_values (.+) FROM custom_fields").WithArgs(id, "true", userID, "VIP").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	contact := &models.Contact{
+		UserID:       userID,
+		Name:         "name",
+		Surname:      "surname",
+		CustomFields: map[string]interface{}{"VIP": true, "Customer ID": float64(1042)},
+	}
+	_, err = repositories.CreateContact(db, contact)
+	if err != nil {
+		t.Errorf("Error was not expected while creating the contact: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
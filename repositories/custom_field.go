@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func CreateCustomField(db *sql.DB, field *models.CustomField) (int64, error) {
+	sql := "INSERT INTO custom_fields (user_id, name, type, required, options) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int64
+	err := db.QueryRow(sql, field.UserID, field.Name, field.Type, field.Required, pq.Array(field.Options)).Scan(&id)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new custom field, error: " + err.Error())
+		return 0, err
+	}
+	return id, nil
+}
+
+func GetCustomField(db *sql.DB, id uint32) (*models.CustomField, error) {
+	sql := "SELECT id, user_id, name, type, required, options FROM custom_fields WHERE id = $1"
+	row := db.QueryRow(sql, id)
+	var field models.CustomField
+	err := row.Scan(&field.ID, &field.UserID, &field.Name, &field.Type, &field.Required, (*pq.StringArray)(&field.Options))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a custom field, error: " + err.Error())
+		return nil, err
+	}
+	return &field, nil
+}
+
+func GetCustomFieldByName(db *sql.DB, userID uint32, name string) (*models.CustomField, error) {
+	sql := "SELECT id, user_id, name, type, required, options FROM custom_fields WHERE user_id = $1 AND name = $2"
+	row := db.QueryRow(sql, userID, name)
+	var field models.CustomField
+	err := row.Scan(&field.ID, &field.UserID, &field.Name, &field.Type, &field.Required, (*pq.StringArray)(&field.Options))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a custom field, error: " + err.Error())
+		return nil, err
+	}
+	return &field, nil
+}
+
+func GetCustomFieldsByUserID(db *sql.DB, userID uint32) ([]*models.CustomField, error) {
+	sql := "SELECT id, user_id, name, type, required, options FROM custom_fields WHERE user_id = $1 ORDER BY name"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT custom fields, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := make([]*models.CustomField, 0)
+	for rows.Next() {
+		field := &models.CustomField{}
+		if err := rows.Scan(&field.ID, &field.UserID, &field.Name, &field.Type, &field.Required, (*pq.StringArray)(&field.Options)); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of custom fields, error: " + err.Error())
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func UpdateCustomField(db *sql.DB, field *models.CustomField) error {
+	sql := "UPDATE custom_fields SET name = $2, required = $3, options = $4 WHERE id = $1"
+	_, err := db.Exec(sql, field.ID, field.Name, field.Required, pq.Array(field.Options))
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a custom field, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func DeleteCustomField(db *sql.DB, id uint32) error {
+	sql := "DELETE FROM custom_fields WHERE id = $1"
+	_, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE a custom field, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// customFieldText turns a validated custom field value into the text it's
+// stored as, so that equal values are always stored the same way.
+func customFieldText(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func customFieldValue(fieldType string, text string) interface{} {
+	switch fieldType {
+	case models.CustomFieldNumber:
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	case models.CustomFieldBool:
+		return text == "true"
+	}
+	return text
+}
@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+var ErrExportInProgress = errors.New("An export is already in progress")
+
+// CreateExportJob returns ErrExportInProgress if the user already has an
+// export that hasn't finished. The job is leased to the instance creating it
+// for the lease duration.
+func CreateExportJob(db *sql.DB, userID uint32, lease time.Duration) (*models.ExportJob, error) {
+	sql := "INSERT INTO export_jobs (user_id, lease_expires_at) VALUES ($1, now() + make_interval(secs => $2)) RETURNING id, user_id, status, progress, error, created_at, completed_at, expires_at"
+	var job models.ExportJob
+	err := db.QueryRow(sql, userID, lease.Seconds()).Scan(&job.ID, &job.UserID, &job.Status, &job.Progress, &job.Error, &job.CreatedAt, &job.CompletedAt, &job.ExpiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new export job, error: " + err.Error())
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrExportInProgress
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func GetExportJob(db *sql.DB, id uint32) (*models.ExportJob, error) {
+	sql := "SELECT id, user_id, status, progress, error, created_at, completed_at, expires_at FROM export_jobs WHERE id = $1"
+	row := db.QueryRow(sql, id)
+	var job models.ExportJob
+	err := row.Scan(&job.ID, &job.UserID, &job.Status, &job.Progress, &job.Error, &job.CreatedAt, &job.CompletedAt, &job.ExpiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT an export job, error: " + err.Error())
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateExportJobProgress leaves jobs that have already finished alone, so
+// that a job failed after losing its lease isn't revived.
+func UpdateExportJobProgress(db *sql.DB, id uint32, status string, progress int) error {
+	sql := "UPDATE export_jobs SET status = $2, progress = $3 WHERE id = $1 AND status IN ($4, $5)"
+	_, err := db.Exec(sql, id, status, progress, models.ExportJobPending, models.ExportJobRunning)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the progress of an export job, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func CompleteExportJob(db *sql.DB, id uint32, archive []byte, expiresAt time.Time) error {
+	sql := "UPDATE export_jobs SET status = $2, progress = 100, archive = $3, completed_at = now(), expires_at = $4 WHERE id = $1 AND status IN ($5, $6)"
+	_, err := db.Exec(sql, id, models.ExportJobCompleted, archive, expiresAt, models.ExportJobPending, models.ExportJobRunning)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a completed export job, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func FailExportJob(db *sql.DB, id uint32, message string) error {
+	sql := "UPDATE export_jobs SET status = $2, error = $3, completed_at = now() WHERE id = $1"
+	_, err := db.Exec(sql, id, models.ExportJobFailed, message)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a failed export job, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// RenewExportJobLease extends the lease of a job that is still running.
+func RenewExportJobLease(db *sql.DB, id uint32, lease time.Duration) error {
+	sql := "UPDATE export_jobs SET lease_expires_at = now() + make_interval(secs => $2) WHERE id = $1 AND status IN ($3, $4)"
+	_, err := db.Exec(sql, id, lease.Seconds(), models.ExportJobPending, models.ExportJobRunning)
+	if err != nil {
+		logger.Log.Error("Failed to renew the lease of an export job, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// FailExpiredExportJobs fails the unfinished jobs whose lease has expired,
+// as the instance running them has stopped, so that their users can start
+// new ones. Jobs created before leases were added have none.
+func FailExpiredExportJobs(db *sql.DB) (int64, error) {
+	sql := "UPDATE export_jobs SET status = $1, error = 'Export was interrupted, please start a new one', completed_at = now() " +
+		"WHERE status IN ($2, $3) AND (lease_expires_at IS NULL OR lease_expires_at <= now())"
+	result, err := db.Exec(sql, models.ExportJobFailed, models.ExportJobPending, models.ExportJobRunning)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE expired export jobs, error: " + err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetExportArchive returns sql.ErrNoRows if the job hasn't completed or its
+// archive has expired.
+func GetExportArchive(db *sql.DB, id uint32) ([]byte, error) {
+	sql := "SELECT archive FROM export_jobs WHERE id = $1 AND status = $2 AND expires_at > now()"
+	var archive []byte
+	err := db.QueryRow(sql, id, models.ExportJobCompleted).Scan(&archive)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT an export archive, error: " + err.Error())
+		return nil, err
+	}
+	return archive, nil
+}
+
+// DeleteExpiredExportJobs deletes the jobs whose archives have expired.
+func DeleteExpiredExportJobs(db *sql.DB) (int64, error) {
+	sql := "DELETE FROM export_jobs WHERE expires_at <= now()"
+	result, err := db.Exec(sql)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE expired export jobs, error: " + err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,34 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+)
+
+func TestFailExpiredExportJobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("^UPDATE export_jobs SET status = \\$1(.+) WHERE status IN \\(\\$2, \\$3\\) AND \\(lease_expires_at IS NULL OR lease_expires_at <= now\\(\\)\\)").
+		WithArgs(models.ExportJobFailed, models.ExportJobPending, models.ExportJobRunning).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	failed, err := repositories.FailExpiredExportJobs(db)
+	if err != nil {
+		t.Errorf("Error was not expected while failing the expired export jobs: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if failed != 2 {
+		t.Errorf("Returned %d failed jobs, expected 2", failed)
+	}
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+type SortField struct {
+	Column     string
+	Descending bool
+}
+
+// ListOptions describes a page of a list endpoint. Sort always ends with
+// the id column so that the ordering is stable, and After holds the sort
+// values of the last row of the previous page. Tags only apply to contacts,
+// which have to carry all of them, or any of them if AnyTag is set. So do
+// CustomFields, which map custom field names to the values they must have.
+type ListOptions struct {
+	Limit        int
+	Sort         []SortField
+	After        []interface{}
+	Filters      map[string]string
+	Tags         []string
+	AnyTag       bool
+	CustomFields map[string]interface{}
+}
+
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// ParseSort parses a sort specification like "surname,-id" where a leading
+// minus sign means descending order. Only the allowed columns are accepted.
+func ParseSort(spec string, allowed []string) ([]SortField, error) {
+	fields := make([]SortField, 0)
+	hasID := false
+	if spec != "" {
+		for _, part := range strings.Split(spec, ",") {
+			field := SortField{Column: strings.TrimSpace(part)}
+			if strings.HasPrefix(field.Column, "-") {
+				field.Column = field.Column[1:]
+				field.Descending = true
+			}
+			if !containsColumn(allowed, field.Column) {
+				return nil, errors.New("Can't sort by " + field.Column)
+			}
+			if field.Column == "id" {
+				hasID = true
+			}
+			fields = append(fields, field)
+		}
+	}
+	if !hasID {
+		fields = append(fields, SortField{Column: "id"})
+	}
+	return fields, nil
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func sortSpec(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = field.Column
+		if field.Descending {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// EncodeCursor turns the sort values of a row into an opaque cursor.
+func EncodeCursor(sort []SortField, values []interface{}) string {
+	cursorJSON, _ := json.Marshal(cursor{Sort: sortSpec(sort), Values: values})
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+// DecodeCursor returns the sort values held by the cursor, which has to
+// have been created for the same sort order.
+func DecodeCursor(encoded string, sort []SortField) ([]interface{}, error) {
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("Malformed cursor")
+	}
+	var decoded cursor
+	decoder := json.NewDecoder(strings.NewReader(string(cursorJSON)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, errors.New("Malformed cursor")
+	}
+	if decoded.Sort != sortSpec(sort) || len(decoded.Values) != len(sort) {
+		return nil, errors.New("Cursor doesn't match the sort order")
+	}
+	return decoded.Values, nil
+}
+
+// listQuery builds the WHERE, ORDER BY and LIMIT clauses of a keyset
+// paginated query. Conditions are added with their arguments, which are
+// numbered after the ones already present.
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *listQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *listQuery) where(condition string, args ...interface{}) {
+	for _, value := range args {
+		condition = strings.Replace(condition, "?", q.arg(value), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *listQuery) whereClause() string {
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// keyset adds the condition selecting the rows that come after the cursor,
+// e.g. (a > x) OR (a = x AND b < y) for the order "a,-b".
+func (q *listQuery) keyset(sort []SortField, after []interface{}) {
+	if after == nil {
+		return
+	}
+	alternatives := make([]string, len(sort))
+	for i, field := range sort {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, sort[j].Column+" = "+q.arg(after[j]))
+		}
+		operator := " > "
+		if field.Descending {
+			operator = " < "
+		}
+		terms = append(terms, field.Column+operator+q.arg(after[i]))
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	q.conditions = append(q.conditions, "("+strings.Join(alternatives, " OR ")+")")
+}
+
+func orderClause(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, field := range sort {
+		parts[i] = field.Column
+		if field.Descending {
+			parts[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
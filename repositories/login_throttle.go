@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+// GetLoginBlockedUntil returns until when logging in is blocked for any of
+// the throttle keys, the zero time if it isn't.
+func GetLoginBlockedUntil(db *sql.DB, keys []string) (time.Time, error) {
+	sql := "SELECT max(blocked_until) FROM login_throttles WHERE key = ANY($1) AND blocked_until > now()"
+	var blockedUntil pq.NullTime
+	err := db.QueryRow(sql, pq.Array(keys)).Scan(&blockedUntil)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT login throttles, error: " + err.Error())
+		return time.Time{}, err
+	}
+	return blockedUntil.Time, nil
+}
+
+// RecordLoginFailure counts a failed login attempt for the key and returns
+// the number of failures, which starts over once there have been none for
+// the window.
+func RecordLoginFailure(db *sql.DB, key string, window time.Duration) (int, error) {
+	sql := "INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, now()) " +
+		"ON CONFLICT (key) DO UPDATE SET failures = CASE WHEN login_throttles.last_failure_at < now() - make_interval(secs => $2) THEN 1 ELSE login_throttles.failures + 1 END, last_failure_at = now() " +
+		"RETURNING failures"
+	var failures int
+	err := db.QueryRow(sql, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		logger.Log.Error("Failed to record a login failure, error: " + err.Error())
+		return 0, err
+	}
+	return failures, nil
+}
+
+func BlockLogin(db *sql.DB, key string, until time.Time) error {
+	sql := "UPDATE login_throttles SET blocked_until = $2 WHERE key = $1"
+	_, err := db.Exec(sql, key, until)
+	if err != nil {
+		logger.Log.Error("Failed to block logging in, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func DeleteLoginThrottle(db *sql.DB, key string) error {
+	sql := "DELETE FROM login_throttles WHERE key = $1"
+	_, err := db.Exec(sql, key)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE a login throttle, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetLoginThrottles returns the failures recorded for the throttle keys.
+func GetLoginThrottles(db *sql.DB, keys []string) ([]*models.LoginThrottle, error) {
+	sql := "SELECT key, failures, last_failure_at, blocked_until FROM login_throttles WHERE key = ANY($1) ORDER BY key"
+	rows, err := db.Query(sql, pq.Array(keys))
+	if err != nil {
+		logger.Log.Error("Failed to SELECT login throttles, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := make([]*models.LoginThrottle, 0)
+	for rows.Next() {
+		throttle := &models.LoginThrottle{}
+		if err := rows.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.BlockedUntil); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of login throttles, error: " + err.Error())
+			return nil, err
+		}
+		throttles = append(throttles, throttle)
+	}
+	return throttles, nil
+}
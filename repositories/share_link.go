@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func CreateShareLink(db *sql.DB, link *models.ShareLink) error {
+	sql := "INSERT INTO share_links (user_id, contact_list, contact, token_hash, password_hash, fields, expires_at, max_views) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at"
+	err := db.QueryRow(sql, link.UserID, link.ContactListID, link.ContactID, link.TokenHash, link.PasswordHash, pq.Array(link.Fields), link.ExpiresAt, link.MaxViews).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new share link, error: " + err.Error())
+		return err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	return nil
+}
+
+func GetShareLink(db *sql.DB, id uint32) (*models.ShareLink, error) {
+	sql := "SELECT id, user_id, contact_list, contact, token_hash, password_hash, fields, expires_at, max_views, views, revoked, created_at FROM share_links WHERE id = $1"
+	row := db.QueryRow(sql, id)
+	var link models.ShareLink
+	err := row.Scan(&link.ID, &link.UserID, &link.ContactListID, &link.ContactID, &link.TokenHash, &link.PasswordHash, (*pq.StringArray)(&link.Fields), &link.ExpiresAt, &link.MaxViews, &link.Views, &link.Revoked, &link.CreatedAt)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a share link, error: " + err.Error())
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+// GetShareLinkByTokenHash returns the link whether or not it can still be
+// used, so that denied accesses can be logged too.
+func GetShareLinkByTokenHash(db *sql.DB, tokenHash string) (*models.ShareLink, error) {
+	sql := "SELECT l.id, l.user_id, l.contact_list, l.contact, l.token_hash, l.password_hash, l.fields, l.expires_at, l.max_views, l.views, l.revoked, l.created_at, " +
+		"u.disabled OR u.deletion_scheduled_at IS NOT NULL FROM share_links l JOIN users u ON u.id = l.user_id WHERE l.token_hash = $1"
+	row := db.QueryRow(sql, tokenHash)
+	var link models.ShareLink
+	err := row.Scan(&link.ID, &link.UserID, &link.ContactListID, &link.ContactID, &link.TokenHash, &link.PasswordHash, (*pq.StringArray)(&link.Fields), &link.ExpiresAt, &link.MaxViews, &link.Views, &link.Revoked, &link.CreatedAt, &link.OwnerInactive)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a share link, error: " + err.Error())
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+func GetShareLinksByUserID(db *sql.DB, userID uint32) ([]*models.ShareLink, error) {
+	sql := "SELECT id, user_id, contact_list, contact, token_hash, password_hash, fields, expires_at, max_views, views, revoked, created_at FROM share_links WHERE user_id = $1 ORDER BY id"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT share links, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]*models.ShareLink, 0)
+	for rows.Next() {
+		link := &models.ShareLink{}
+		if err := rows.Scan(&link.ID, &link.UserID, &link.ContactListID, &link.ContactID, &link.TokenHash, &link.PasswordHash, (*pq.StringArray)(&link.Fields), &link.ExpiresAt, &link.MaxViews, &link.Views, &link.Revoked, &link.CreatedAt); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of share links, error: " + err.Error())
+			return nil, err
+		}
+		link.HasPassword = link.PasswordHash != ""
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// UseShareLinkView counts a view of the link, it returns false if the link
+// has been revoked, has expired, or has run out of views in the meantime, or
+// if its owner has been disabled or is being deleted.
+func UseShareLinkView(db *sql.DB, id uint32) (bool, error) {
+	sql := "UPDATE share_links SET views = views + 1 WHERE id = $1 AND NOT revoked AND expires_at > now() AND (max_views = 0 OR views < max_views) " +
+		"AND EXISTS (SELECT 1 FROM users u WHERE u.id = share_links.user_id AND NOT u.disabled AND u.deletion_scheduled_at IS NULL)"
+	result, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the views of a share link, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func RevokeShareLink(db *sql.DB, id uint32) error {
+	sql := "UPDATE share_links SET revoked = true WHERE id = $1"
+	_, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to revoke a share link, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func CreateShareLinkAccess(db *sql.DB, access *models.ShareLinkAccess) error {
+	sql := "INSERT INTO share_link_accesses (share_link, ip, user_agent, result) VALUES ($1, $2, $3, $4)"
+	_, err := db.Exec(sql, access.ShareLinkID, access.IP, access.UserAgent, access.Result)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a share link access, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func GetShareLinkAccesses(db *sql.DB, shareLinkID uint32) ([]*models.ShareLinkAccess, error) {
+	sql := "SELECT id, share_link, accessed_at, ip, user_agent, result FROM share_link_accesses WHERE share_link = $1 ORDER BY accessed_at DESC"
+	rows, err := db.Query(sql, shareLinkID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT share link accesses, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make([]*models.ShareLinkAccess, 0)
+	for rows.Next() {
+		access := &models.ShareLinkAccess{}
+		if err := rows.Scan(&access.ID, &access.ShareLinkID, &access.AccessedAt, &access.IP, &access.UserAgent, &access.Result); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of share link accesses, error: " + err.Error())
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, nil
+}
+
+// GetShareLinkAccessesByUserID returns the accesses of all the share links
+// of the user.
+func GetShareLinkAccessesByUserID(db *sql.DB, userID uint32) ([]*models.ShareLinkAccess, error) {
+	sql := "SELECT a.id, a.share_link, a.accessed_at, a.ip, a.user_agent, a.result FROM share_link_accesses a " +
+		"JOIN share_links l ON l.id = a.share_link WHERE l.user_id = $1 ORDER BY a.accessed_at DESC"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT share link accesses, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := make([]*models.ShareLinkAccess, 0)
+	for rows.Next() {
+		access := &models.ShareLinkAccess{}
+		if err := rows.Scan(&access.ID, &access.ShareLinkID, &access.AccessedAt, &access.IP, &access.UserAgent, &access.Result); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of share link accesses, error: " + err.Error())
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, nil
+}
@@ -0,0 +1,74 @@
+package repositories_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+)
+
+// TestShareLinksOfInactiveOwners checks that links stop working while their
+// owner is disabled or scheduled for deletion. It needs a PostgreSQL
+// database given with ADDRESSBOOK_TEST_DATABASE_URL, whose public schema it
+// wipes.
+func TestShareLinksOfInactiveOwners(t *testing.T) {
+	url := os.Getenv("ADDRESSBOOK_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ADDRESSBOOK_TEST_DATABASE_URL isn't set")
+	}
+	db, err := database.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, sql := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	var contactID uint32
+	err = db.QueryRow("WITH u AS (INSERT INTO users (username, email, password) VALUES ('ada', 'ada@mail.com', 'hash') RETURNING id) " +
+		"INSERT INTO contacts (user_id, name) SELECT id, 'Ada' FROM u RETURNING id").Scan(&contactID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := &models.ShareLink{UserID: 1, ContactID: &contactID, TokenHash: "hash", Fields: []string{"name"}, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repositories.CreateShareLink(db, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		owner          string
+		update         string
+		expectedActive bool
+	}{
+		{"active", "UPDATE users SET disabled = false, deletion_scheduled_at = NULL", true},
+		{"disabled", "UPDATE users SET disabled = true, deletion_scheduled_at = NULL", false},
+		{"scheduled for deletion", "UPDATE users SET disabled = false, deletion_scheduled_at = now() + interval '30 days'", false},
+	} {
+		if _, err := db.Exec(test.update); err != nil {
+			t.Fatal(err)
+		}
+		found, err := repositories.GetShareLinkByTokenHash(db, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.OwnerInactive == test.expectedActive {
+			t.Errorf("Link of an owner %s has OwnerInactive %v", test.owner, found.OwnerInactive)
+		}
+		counted, err := repositories.UseShareLinkView(db, link.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counted != test.expectedActive {
+			t.Errorf("Viewing the link of an owner %s returned %v", test.owner, counted)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func GetTag(db *sql.DB, id uint32) (*models.Tag, error) {
+	sql := "SELECT t.id, t.user_id, t.name, (SELECT COUNT(*) FROM contact_tags WHERE tag = t.id) FROM tags t WHERE t.id = $1"
+	row := db.QueryRow(sql, id)
+	var tag models.Tag
+	err := row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Count)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a tag, error: " + err.Error())
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func GetTagByName(db *sql.DB, userID uint32, name string) (*models.Tag, error) {
+	sql := "SELECT t.id, t.user_id, t.name, (SELECT COUNT(*) FROM contact_tags WHERE tag = t.id) FROM tags t WHERE t.user_id = $1 AND t.name = $2"
+	row := db.QueryRow(sql, userID, name)
+	var tag models.Tag
+	err := row.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Count)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a tag, error: " + err.Error())
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTagsByUserID returns the tags of the user ordered by name, together
+// with the number of contacts carrying each of them.
+func GetTagsByUserID(db *sql.DB, userID uint32) ([]*models.Tag, error) {
+	sql := "SELECT t.id, t.user_id, t.name, COUNT(ct.contact) FROM tags t LEFT JOIN contact_tags ct ON ct.tag = t.id WHERE t.user_id = $1 GROUP BY t.id ORDER BY t.name"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT tags, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]*models.Tag, 0)
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Count); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of tags, error: " + err.Error())
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func UpdateTag(db *sql.DB, id uint32, name string) error {
+	sql := "UPDATE tags SET name = $2 WHERE id = $1"
+	_, err := db.Exec(sql, id, name)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a tag, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func DeleteTag(db *sql.DB, id uint32) error {
+	sql := "DELETE FROM tags WHERE id = $1"
+	_, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE a tag, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// AddTagsToContact tags the contact, creating the tags the user doesn't
+// have yet. Tags the contact already carries are left as they are.
+func AddTagsToContact(db *sql.DB, userID uint32, contactID uint32, names []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range names {
+		sql := "INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name RETURNING id"
+		var tagID uint32
+		err := tx.QueryRow(sql, userID, name).Scan(&tagID)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new tag, error: " + err.Error())
+			return err
+		}
+
+		sql = "INSERT INTO contact_tags (contact, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		_, err = tx.Exec(sql, contactID, tagID)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a new contact tag, error: " + err.Error())
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit contact tags, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// RemoveTagsFromContact untags the contact. The tags themselves are kept,
+// even if no contact carries them anymore.
+func RemoveTagsFromContact(db *sql.DB, userID uint32, contactID uint32, names []string) error {
+	sql := "DELETE FROM contact_tags WHERE contact = $1 AND tag IN (SELECT id FROM tags WHERE user_id = $2 AND name = ANY($3))"
+	_, err := db.Exec(sql, contactID, userID, pq.Array(names))
+	if err != nil {
+		logger.Log.Error("Failed to DELETE contact tags, error: " + err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jafarlihi/addressbook/repositories"
+)
+
+func TestAddTagsToContact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+	var contactID uint32
+	contactID = 2
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO tags (.+) ON CONFLICT").WithArgs(userID, "family").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec("^INSERT INTO contact_tags").WithArgs(contactID, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^INSERT INTO tags (.+) ON CONFLICT").WithArgs(userID, "work").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectExec("^INSERT INTO contact_tags").WithArgs(contactID, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = repositories.AddTagsToContact(db, userID, contactID, []string{"family", "work"})
+	if err != nil {
+		t.Errorf("Error was not expected while tagging the contact: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTagsByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "count"}).
+		AddRow(3, userID, "family", 2).
+		AddRow(4, userID, "work", 0)
+	mock.ExpectQuery("^SELECT (.+) FROM tags t LEFT JOIN contact_tags").WithArgs(userID).WillReturnRows(rows)
+
+	tags, err := repositories.GetTagsByUserID(db, userID)
+	if err != nil {
+		t.Errorf("Error was not expected while fetching the tags: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(tags) != 2 || tags[0].Name != "family" || tags[0].Count != 2 || tags[1].Count != 0 {
+		t.Errorf("Returned tags do not match the expectations")
+	}
+}
+
+func TestListContactsByAllTags(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var userID uint32
+	userID = 1
+
+	options := &repositories.ListOptions{Limit: 10, Sort: []repositories.SortField{{Column: "id"}}, Tags: []string{"family", "work"}}
+
+	mock.ExpectQuery("^SELECT COUNT\\(\\*\\) FROM contacts WHERE user_id = \\$1 AND id IN \\(SELECT ct.contact (.+) HAVING COUNT\\(\\*\\) = \\$3\\)$").
+		WithArgs(userID, "{\"family\",\"work\"}", 2).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("^SELECT (.+) FROM contacts WHERE (.+) ORDER BY id LIMIT 11$").WithArgs(userID, "{\"family\",\"work\"}", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "surname", "email", "notes", "birthday", "vcard_extra"}))
+
+	page, err := repositories.ListContactsByUserID(db, userID, options)
+	if err != nil {
+		t.Errorf("Error was not expected while listing the contacts: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if page.Total != 0 || page.Next != nil {
+		t.Errorf("Returned page does not match the expectations")
+	}
+}
@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
+)
+
+func CreateRefreshToken(db *sql.DB, token *models.RefreshToken) error {
+	sql := "INSERT INTO refresh_tokens (user_id, family, token_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	_, err := db.Exec(sql, token.UserID, token.Family, token.TokenHash, pq.Array(token.Scopes), token.ExpiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new refresh token, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func GetRefreshToken(db *sql.DB, tokenHash string) (*models.RefreshToken, error) {
+	sql := "SELECT id, user_id, family, token_hash, scopes, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = $1"
+	row := db.QueryRow(sql, tokenHash)
+	var token models.RefreshToken
+	err := row.Scan(&token.ID, &token.UserID, &token.Family, &token.TokenHash, (*pq.StringArray)(&token.Scopes), &token.ExpiresAt, &token.Used, &token.Revoked)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a refresh token, error: " + err.Error())
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetRefreshTokensByUserID returns every refresh token issued to the user,
+// one per login and token rotation.
+func GetRefreshTokensByUserID(db *sql.DB, userID uint32) ([]*models.RefreshToken, error) {
+	sql := "SELECT id, user_id, family, token_hash, scopes, expires_at, used, revoked FROM refresh_tokens WHERE user_id = $1 ORDER BY id"
+	rows, err := db.Query(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT refresh tokens, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*models.RefreshToken, 0)
+	for rows.Next() {
+		token := &models.RefreshToken{}
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Family, &token.TokenHash, (*pq.StringArray)(&token.Scopes), &token.ExpiresAt, &token.Used, &token.Revoked); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of refresh tokens, error: " + err.Error())
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// UseRefreshToken marks the refresh token as used, if it's still usable, in
+// a single statement so that a token can't be rotated twice concurrently.
+// It returns sql.ErrNoRows if the token is unknown, used, revoked or expired.
+func UseRefreshToken(db *sql.DB, tokenHash string) (*models.RefreshToken, error) {
+	sql := "UPDATE refresh_tokens SET used = true WHERE token_hash = $1 AND NOT used AND NOT revoked AND expires_at > now() RETURNING id, user_id, family, token_hash, scopes, expires_at, used, revoked"
+	row := db.QueryRow(sql, tokenHash)
+	var token models.RefreshToken
+	err := row.Scan(&token.ID, &token.UserID, &token.Family, &token.TokenHash, (*pq.StringArray)(&token.Scopes), &token.ExpiresAt, &token.Used, &token.Revoked)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a refresh token, error: " + err.Error())
+		return nil, err
+	}
+	return &token, nil
+}
+
+func RevokeRefreshTokenFamily(db *sql.DB, family string) error {
+	sql := "UPDATE refresh_tokens SET revoked = true WHERE family = $1"
+	_, err := db.Exec(sql, family)
+	if err != nil {
+		logger.Log.Error("Failed to revoke a refresh token family, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// RevokeRefreshTokensOfUser logs the user out of all login sessions once
+// their access tokens expire.
+func RevokeRefreshTokensOfUser(db *sql.DB, userID uint32) error {
+	sql := "UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND NOT revoked"
+	_, err := db.Exec(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to revoke the refresh tokens of a user, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func CreateRevokedAccessToken(db *sql.DB, jti string, expiresAt time.Time) error {
+	sql := "INSERT INTO revoked_access_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	_, err := db.Exec(sql, jti, expiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a revoked access token, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetRevokedAccessTokens returns the revoked access tokens that haven't
+// expired yet, mapped from their jti to their expiry, and deletes the rest.
+func GetRevokedAccessTokens(db *sql.DB) (map[string]time.Time, error) {
+	_, err := db.Exec("DELETE FROM revoked_access_tokens WHERE expires_at <= now()")
+	if err != nil {
+		logger.Log.Error("Failed to DELETE expired revoked access tokens, error: " + err.Error())
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT jti, expires_at FROM revoked_access_tokens")
+	if err != nil {
+		logger.Log.Error("Failed to SELECT revoked access tokens, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of revoked access tokens, error: " + err.Error())
+			return nil, err
+		}
+		tokens[jti] = expiresAt
+	}
+	return tokens, nil
+}
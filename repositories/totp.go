@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+)
+
+func GetTOTPCredential(db *sql.DB, userID uint32) (*models.TOTPCredential, error) {
+	sql := "SELECT user_id, secret, enabled, last_used_step FROM totp_credentials WHERE user_id = $1"
+	row := db.QueryRow(sql, userID)
+	var credential models.TOTPCredential
+	err := row.Scan(&credential.UserID, &credential.Secret, &credential.Enabled, &credential.LastUsedStep)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a TOTP credential, error: " + err.Error())
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// SetPendingTOTPCredential stores a new unconfirmed secret for the user,
+// replacing an earlier unconfirmed one but never an enabled one. It returns
+// sql.ErrNoRows if the user already has TOTP enabled.
+func SetPendingTOTPCredential(db *sql.DB, userID uint32, secret string) error {
+	sql := "INSERT INTO totp_credentials (user_id, secret) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_used_step = 0 WHERE NOT totp_credentials.enabled RETURNING user_id"
+	var id uint32
+	err := db.QueryRow(sql, userID, secret).Scan(&id)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a TOTP credential, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code, it returns false if
+// a code of that or a later step has already been used.
+func UseTOTPStep(db *sql.DB, userID uint32, step int64) (bool, error) {
+	sql := "UPDATE totp_credentials SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+	result, err := db.Exec(sql, userID, step)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a TOTP credential, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// EnableTOTPCredential enables the TOTP credential of the user and replaces
+// their recovery codes.
+func EnableTOTPCredential(db *sql.DB, userID uint32, recoveryCodeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	sql := "UPDATE totp_credentials SET enabled = true WHERE user_id = $1"
+	_, err = tx.Exec(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to enable a TOTP credential, error: " + err.Error())
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit the transaction, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func DeleteTOTPCredential(db *sql.DB, userID uint32) error {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	sql := "DELETE FROM totp_credentials WHERE user_id = $1"
+	_, err = tx.Exec(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE a TOTP credential, error: " + err.Error())
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userID, nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit the transaction, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func ReplaceRecoveryCodes(db *sql.DB, userID uint32, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Log.Error("Failed to begin a transaction, error: " + err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, userID, codeHashes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Log.Error("Failed to commit the transaction, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID uint32, codeHashes []string) error {
+	sql := "DELETE FROM recovery_codes WHERE user_id = $1"
+	_, err := tx.Exec(sql, userID)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE recovery codes, error: " + err.Error())
+		return err
+	}
+
+	sql = "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(sql, userID, codeHash)
+		if err != nil {
+			logger.Log.Error("Failed to INSERT a recovery code, error: " + err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks the recovery code as used, it returns false if the
+// user has no such unused code.
+func UseRecoveryCode(db *sql.DB, userID uint32, codeHash string) (bool, error) {
+	sql := "UPDATE recovery_codes SET used = true WHERE user_id = $1 AND code_hash = $2 AND NOT used"
+	result, err := db.Exec(sql, userID, codeHash)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a recovery code, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
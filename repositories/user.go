@@ -2,16 +2,50 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 
 	"github.com/jafarlihi/addressbook/logger"
 	"github.com/jafarlihi/addressbook/models"
+	"github.com/lib/pq"
 )
 
+var (
+	ErrUsernameTaken = errors.New("Another user with this username already exists")
+	ErrEmailTaken    = errors.New("Another user with this email already exists")
+)
+
+// uniqueUserError maps violations of the UNIQUE constraints of users to
+// ErrUsernameTaken and ErrEmailTaken, returning other errors as they are.
+func uniqueUserError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "users_username_key":
+			return ErrUsernameTaken
+		case "users_email_key":
+			return ErrEmailTaken
+		}
+	}
+	return err
+}
+
+func GetUser(db *sql.DB, id uint32) (*models.User, error) {
+	sql := "SELECT id, username, email, password, email_verified, deletion_scheduled_at, disabled FROM users WHERE id = $1"
+	row := db.QueryRow(sql, id)
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.DeletionScheduledAt, &user.Disabled)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT a user, error: " + err.Error())
+		return nil, err
+	}
+	return &user, nil
+}
+
 func GetUserByUsername(db *sql.DB, username string) (*models.User, error) {
-	sql := "SELECT id, username, email, password FROM users WHERE username = $1"
+	sql := "SELECT id, username, email, password, email_verified, deletion_scheduled_at, disabled FROM users WHERE username = $1"
 	row := db.QueryRow(sql, username)
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.DeletionScheduledAt, &user.Disabled)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT a user, error: " + err.Error())
 		return nil, err
@@ -20,10 +54,10 @@ func GetUserByUsername(db *sql.DB, username string) (*models.User, error) {
 }
 
 func GetUserByEmail(db *sql.DB, email string) (*models.User, error) {
-	sql := "SELECT id, username, email, password FROM users WHERE email = $1"
+	sql := "SELECT id, username, email, password, email_verified, deletion_scheduled_at, disabled FROM users WHERE email = $1"
 	row := db.QueryRow(sql, email)
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.DeletionScheduledAt, &user.Disabled)
 	if err != nil {
 		logger.Log.Error("Failed to SELECT a user, error: " + err.Error())
 		return nil, err
@@ -31,13 +65,125 @@ func GetUserByEmail(db *sql.DB, email string) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUsers returns all users ordered by ID.
+func GetUsers(db *sql.DB) ([]*models.User, error) {
+	sql := "SELECT id, username, email, password, email_verified, deletion_scheduled_at, disabled FROM users ORDER BY id"
+	rows, err := db.Query(sql)
+	if err != nil {
+		logger.Log.Error("Failed to SELECT users, error: " + err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.DeletionScheduledAt, &user.Disabled); err != nil {
+			logger.Log.Error("Failed to scan SELECTed row of users, error: " + err.Error())
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 func CreateUser(db *sql.DB, username string, email string, password string) (int64, error) {
 	sql := "INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id"
 	var id int64
 	err := db.QueryRow(sql, username, email, password).Scan(&id)
 	if err != nil {
 		logger.Log.Error("Failed to INSERT a new user, error: " + err.Error())
-		return 0, err
+		return 0, uniqueUserError(err)
 	}
 	return id, nil
 }
+
+func UpdateUserPassword(db *sql.DB, id uint32, password string) error {
+	sql := "UPDATE users SET password = $2 WHERE id = $1"
+	_, err := db.Exec(sql, id, password)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the password of a user, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+func SetUserEmailVerified(db *sql.DB, id uint32) error {
+	sql := "UPDATE users SET email_verified = true WHERE id = $1"
+	_, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the email verification of a user, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// SetUserDisabled disables or enables the user, it returns false if the user
+// already was in that state.
+func SetUserDisabled(db *sql.DB, id uint32, disabled bool) (bool, error) {
+	sql := "UPDATE users SET disabled = $2 WHERE id = $1 AND disabled <> $2"
+	result, err := db.Exec(sql, id, disabled)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the disabled state of a user, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// UpdateUserProfile changes the username and email of the user, returning
+// ErrUsernameTaken or ErrEmailTaken if another user already has them.
+func UpdateUserProfile(db *sql.DB, id uint32, username string, email string, emailVerified bool) error {
+	sql := "UPDATE users SET username = $2, email = $3, email_verified = $4 WHERE id = $1"
+	_, err := db.Exec(sql, id, username, email, emailVerified)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the profile of a user, error: " + err.Error())
+		return uniqueUserError(err)
+	}
+	return nil
+}
+
+// ScheduleUserDeletion marks the user to be deleted at the given time, it
+// returns false if the deletion has already been scheduled.
+func ScheduleUserDeletion(db *sql.DB, id uint32, at time.Time) (bool, error) {
+	sql := "UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1 AND deletion_scheduled_at IS NULL"
+	result, err := db.Exec(sql, id, at)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the deletion schedule of a user, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CancelUserDeletion returns false if no deletion was scheduled.
+func CancelUserDeletion(db *sql.DB, id uint32) (bool, error) {
+	sql := "UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL"
+	result, err := db.Exec(sql, id)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE the deletion schedule of a user, error: " + err.Error())
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteScheduledUsers deletes the users whose grace period has passed,
+// their data goes with them through the ON DELETE CASCADE foreign keys.
+func DeleteScheduledUsers(db *sql.DB) (int64, error) {
+	sql := "DELETE FROM users WHERE deletion_scheduled_at <= now()"
+	result, err := db.Exec(sql)
+	if err != nil {
+		logger.Log.Error("Failed to DELETE the users scheduled for deletion, error: " + err.Error())
+		return 0, err
+	}
+	return result.RowsAffected()
+}
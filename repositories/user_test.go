@@ -5,6 +5,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/lib/pq"
 )
 
 func TestGetUserByUsername(t *testing.T) {
@@ -20,7 +21,7 @@ func TestGetUserByUsername(t *testing.T) {
 	email := "user@email.com"
 	password := "password"
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password"}).AddRow(id, username, email, password)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(id, username, email, password, false, nil, false)
 	mock.ExpectQuery("^SELECT (.+) FROM users WHERE").WithArgs(username).WillReturnRows(rows)
 
 	user, err := repositories.GetUserByUsername(db, username)
@@ -50,7 +51,7 @@ func TestGetUserByEmail(t *testing.T) {
 	email := "user@email.com"
 	password := "password"
 
-	rows := sqlmock.NewRows([]string{"id", "username", "email", "password"}).AddRow(id, username, email, password)
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).AddRow(id, username, email, password, false, nil, false)
 	mock.ExpectQuery("^SELECT (.+) FROM users WHERE").WithArgs(email).WillReturnRows(rows)
 
 	user, err := repositories.GetUserByEmail(db, email)
@@ -96,3 +97,96 @@ func TestCreateUser(t *testing.T) {
 		t.Errorf("Returned ID '%d' does not match the expectations", returnedID)
 	}
 }
+
+func TestCreateUserWithTakenEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("^INSERT INTO users").WithArgs("username", "user@email.com", "password").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_key"})
+
+	_, err = repositories.CreateUser(db, "username", "user@email.com", "password")
+	if err != repositories.ErrEmailTaken {
+		t.Errorf("Expected ErrEmailTaken, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteScheduledUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("^DELETE FROM users WHERE deletion_scheduled_at <= now\\(\\)").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	deleted, err := repositories.DeleteScheduledUsers(db)
+	if err != nil {
+		t.Errorf("Error was not expected while deleting the users: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if deleted != 2 {
+		t.Errorf("Returned count '%d' does not match the expectations", deleted)
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "username", "email", "password", "email_verified", "deletion_scheduled_at", "disabled"}).
+		AddRow(1, "first", "first@mail.com", "hash", true, nil, false).
+		AddRow(2, "second", "second@mail.com", "hash", false, nil, true)
+	mock.ExpectQuery("^SELECT (.+) FROM users ORDER BY id").WillReturnRows(rows)
+
+	users, err := repositories.GetUsers(db)
+	if err != nil {
+		t.Errorf("Error was not expected while fetching the users: %s", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	if len(users) != 2 || users[0].Username != "first" || users[0].Disabled || !users[1].Disabled {
+		t.Errorf("Returned users do not match the expectations: %+v", users)
+	}
+}
+
+func TestSetUserDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("^UPDATE users SET disabled = \\$2 WHERE id = \\$1 AND disabled <> \\$2").WithArgs(1, true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE users SET disabled").WithArgs(1, true).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	changed, err := repositories.SetUserDisabled(db, 1, true)
+	if err != nil || !changed {
+		t.Errorf("Expected the user to be disabled, got %v, %v", changed, err)
+	}
+	changed, err = repositories.SetUserDisabled(db, 1, true)
+	if err != nil || changed {
+		t.Errorf("Expected the already disabled user to be left as is, got %v, %v", changed, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
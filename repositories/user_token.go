@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/models"
+)
+
+func CreateUserToken(db *sql.DB, token *models.UserToken) error {
+	sql := "INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)"
+	_, err := db.Exec(sql, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		logger.Log.Error("Failed to INSERT a new user token, error: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// UseUserToken marks the token as used, if it's still usable, in a single
+// statement so that it can't be used twice concurrently. It returns
+// sql.ErrNoRows if the token is unknown, used, expired or for another purpose.
+func UseUserToken(db *sql.DB, purpose string, tokenHash string) (*models.UserToken, error) {
+	sql := "UPDATE user_tokens SET used = true WHERE token_hash = $1 AND purpose = $2 AND NOT used AND expires_at > now() RETURNING id, user_id, purpose, token_hash, expires_at, used"
+	row := db.QueryRow(sql, tokenHash, purpose)
+	var token models.UserToken
+	err := row.Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.Used)
+	if err != nil {
+		logger.Log.Error("Failed to UPDATE a user token, error: " + err.Error())
+		return nil, err
+	}
+	return &token, nil
+}
+
+// InvalidateUserTokens marks all the tokens of the user with the purpose as
+// used.
+func InvalidateUserTokens(db *sql.DB, userID uint32, purpose string) error {
+	sql := "UPDATE user_tokens SET used = true WHERE user_id = $1 AND purpose = $2 AND NOT used"
+	_, err := db.Exec(sql, userID, purpose)
+	if err != nil {
+		logger.Log.Error("Failed to invalidate user tokens, error: " + err.Error())
+		return err
+	}
+	return nil
+}
@@ -5,51 +5,208 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jafarlihi/addressbook/handlers"
+	"github.com/jafarlihi/addressbook/services"
 )
 
 func ConstructRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.HandleFunc("/.well-known/jwks.json", handlers.GetJWKS).Methods("GET")
 	router.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
 		handlers.WithRequestBody(w, r, handlers.CreateUser)
 	}).Methods("POST")
 	router.HandleFunc("/api/user/token", func(w http.ResponseWriter, r *http.Request) {
 		handlers.WithRequestBody(w, r, handlers.CreateToken)
 	}).Methods("POST")
+	router.HandleFunc("/api/user/token/mfa", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.ExchangeMFAToken)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.RefreshToken)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/logout", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.Logout)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/me", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetProfile, services.ScopeAccount)
+	}).Methods("GET")
+	router.HandleFunc("/api/user/me", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRawRequestBody(w, r, handlers.PatchProfile, services.ScopeAccount)
+	}).Methods("PATCH")
+	router.HandleFunc("/api/user/me", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.DeleteAccount, services.ScopeAccount)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/user/me/restore", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.RestoreAccount, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/password", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.ChangePassword, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.ForgotPassword)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.ResetPassword)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/email/verify", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.VerifyEmail)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/email/verify/resend", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ResendVerificationEmail, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/mfa/totp", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.EnrollTOTP, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/mfa/totp", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.DisableTOTP, services.ScopeAccount)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/user/mfa/totp/qr.png", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetTOTPQRCode, services.ScopeAccount)
+	}).Methods("GET")
+	router.HandleFunc("/api/user/mfa/totp/confirm", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.ConfirmTOTP, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/mfa/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.RegenerateRecoveryCodes, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateAPIKey, services.ScopeAccount)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetAPIKeys, services.ScopeAccount)
+	}).Methods("GET")
+	router.HandleFunc("/api/user/api-keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.DeleteAPIKey, services.ScopeAccount)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/user/export", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.CreateExport, services.ScopeAccount, services.ScopeContactsRead, services.ScopeListsRead)
+	}).Methods("POST")
+	router.HandleFunc("/api/user/export/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetExport, services.ScopeAccount, services.ScopeContactsRead, services.ScopeListsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/user/export/{id}/download", handlers.DownloadExport).Methods("GET")
+	router.HandleFunc("/api/share-links", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetShareLinks, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/share-links/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.RevokeShareLink, services.ScopeContactsWrite)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/share-links/{id}/accesses", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetShareLinkAccesses, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/public/share/{token}", handlers.ViewShareLink).Methods("GET")
+	router.HandleFunc("/public/share/{token}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WithRequestBody(w, r, handlers.ViewShareLinkWithPassword)
+	}).Methods("POST")
 	router.HandleFunc("/api/contact", func(w http.ResponseWriter, r *http.Request) {
-		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContact)
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContact, services.ScopeContactsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact/import", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ImportVCards, services.ScopeContactsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact/import/csv", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ImportCSV, services.ScopeContactsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact/search", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.SearchContacts, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/contact/{id:[0-9]+}.vcf", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ExportContactVCard, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/contact/{id}/share-links", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContactShareLink, services.ScopeContactsWrite)
 	}).Methods("POST")
+	router.HandleFunc("/api/contact/{id}/tags", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.AddContactTags, services.ScopeContactsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact/{id}/tags", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.RemoveContactTags, services.ScopeContactsWrite)
+	}).Methods("DELETE")
 	router.HandleFunc("/api/contact/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.DeleteContact)
+		handlers.Authenticated(w, r, handlers.DeleteContact, services.ScopeContactsWrite)
 	}).Methods("DELETE")
+	router.HandleFunc("/api/contact/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.UpdateContact, services.ScopeContactsWrite)
+	}).Methods("PUT")
+	router.HandleFunc("/api/contact/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRawRequestBody(w, r, handlers.PatchContact, services.ScopeContactsWrite)
+	}).Methods("PATCH")
+	router.HandleFunc("/api/contact", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ExportContactsVCard, services.ScopeContactsRead)
+	}).Methods("GET").HeadersRegexp("Accept", "text/(x-)?vcard")
+	router.HandleFunc("/api/contact", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ExportContacts, services.ScopeContactsRead)
+	}).Methods("GET").HeadersRegexp("Accept", "text/csv|application/(x-)?ndjson")
 	router.HandleFunc("/api/contact", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.GetContacts)
+		handlers.Authenticated(w, r, handlers.GetContacts, services.ScopeContactsRead)
 	}).Methods("GET")
 	router.HandleFunc("/api/contact/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.GetContact)
+		handlers.Authenticated(w, r, handlers.GetContact, services.ScopeContactsRead)
 	}).Methods("GET")
 	router.HandleFunc("/api/contact-list", func(w http.ResponseWriter, r *http.Request) {
-		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContactList)
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContactList, services.ScopeListsWrite)
 	}).Methods("POST")
 	router.HandleFunc("/api/contact-list/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.DeleteContactList)
+		handlers.Authenticated(w, r, handlers.DeleteContactList, services.ScopeListsWrite)
 	}).Methods("DELETE")
+	router.HandleFunc("/api/contact-list/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRawRequestBody(w, r, handlers.PatchContactList, services.ScopeListsWrite)
+	}).Methods("PATCH")
 	router.HandleFunc("/api/contact-list", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.GetContactLists)
+		handlers.Authenticated(w, r, handlers.GetContactLists, services.ScopeListsRead)
 	}).Methods("GET")
 	router.HandleFunc("/api/contact-list/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.GetContactList)
+		handlers.Authenticated(w, r, handlers.GetContactList, services.ScopeListsRead)
 	}).Methods("GET")
 	router.HandleFunc("/api/contact-list/search", func(w http.ResponseWriter, r *http.Request) {
-		handlers.AuthenticatedWithRequestBody(w, r, handlers.SearchContactLists)
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.SearchContactLists, services.ScopeListsRead)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact-list/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.ShareContactList, services.ScopeListsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/contact-list/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetContactListShares, services.ScopeListsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/contact-list/{id}/shares/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.UnshareContactList, services.ScopeListsWrite)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/contact-list/{id}/share-links", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateContactListShareLink, services.ScopeListsWrite, services.ScopeContactsRead)
 	}).Methods("POST")
 	router.HandleFunc("/api/contact-list/{id}/contact", func(w http.ResponseWriter, r *http.Request) {
-		handlers.Authenticated(w, r, handlers.GetContactsOfContactList)
+		handlers.Authenticated(w, r, handlers.ExportContactsOfContactList, services.ScopeListsRead, services.ScopeContactsRead)
+	}).Methods("GET").HeadersRegexp("Accept", "text/csv|application/(x-)?ndjson")
+	router.HandleFunc("/api/contact-list/{id}/contact", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetContactsOfContactList, services.ScopeListsRead, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/contact-list/{id}/contact.vcf", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.ExportContactListVCard, services.ScopeListsRead, services.ScopeContactsRead)
 	}).Methods("GET")
 	router.HandleFunc("/api/contact-list/{id}/contact", func(w http.ResponseWriter, r *http.Request) {
-		handlers.AuthenticatedWithRequestBody(w, r, handlers.AddToContactList)
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.AddToContactList, services.ScopeListsWrite)
 	}).Methods("POST")
 	router.HandleFunc("/api/contact-list/{id}/contact", func(w http.ResponseWriter, r *http.Request) {
-		handlers.AuthenticatedWithRequestBody(w, r, handlers.RemoveFromContactList)
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.RemoveFromContactList, services.ScopeListsWrite)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetTags, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/tags/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRawRequestBody(w, r, handlers.PatchTag, services.ScopeContactsWrite)
+	}).Methods("PATCH")
+	router.HandleFunc("/api/tags/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.DeleteTag, services.ScopeContactsWrite)
+	}).Methods("DELETE")
+	router.HandleFunc("/api/custom-field", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRequestBody(w, r, handlers.CreateCustomField, services.ScopeContactsWrite)
+	}).Methods("POST")
+	router.HandleFunc("/api/custom-field", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.GetCustomFields, services.ScopeContactsRead)
+	}).Methods("GET")
+	router.HandleFunc("/api/custom-field/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuthenticatedWithRawRequestBody(w, r, handlers.PatchCustomField, services.ScopeContactsWrite)
+	}).Methods("PATCH")
+	router.HandleFunc("/api/custom-field/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.Authenticated(w, r, handlers.DeleteCustomField, services.ScopeContactsWrite)
 	}).Methods("DELETE")
 	return router
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	gorillaHandlers "github.com/gorilla/handlers"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/jobs"
+	"github.com/jafarlihi/addressbook/logger"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/router"
+	"github.com/jafarlihi/addressbook/server"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func runServe(args []string) int {
+	flags := newFlagSet("serve")
+	allowPendingMigrations := flags.Bool("allow-pending-migrations", false, "serve even if the database schema has pending migrations")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		return commandUsage("serve")
+	}
+
+	database.InitDatabase()
+
+	pending, err := database.GetPendingMigrations(database.Database)
+	if err != nil {
+		logger.Log.Error("Failed to check the database schema, error: " + err.Error())
+		return 1
+	}
+	if len(pending) > 0 {
+		if !*allowPendingMigrations {
+			logger.Log.Error("The database schema is behind by " + strconv.Itoa(len(pending)) + " migration(s), run \"addressbook migrate up\" or pass -allow-pending-migrations")
+			return 1
+		}
+		logger.Log.Warning("Serving with " + strconv.Itoa(len(pending)) + " pending migration(s)")
+	}
+
+	mailer.InitMailer()
+
+	if err := services.InitSigningKeys(); err != nil {
+		logger.Log.Error("Failed to load the JWT signing keys, error: " + err.Error())
+		return 1
+	}
+
+	if err := loadRevokedAccessTokens(); err != nil {
+		logger.Log.Error("Failed to load the revoked access tokens, error: " + err.Error())
+		return 1
+	}
+
+	go runCleanups()
+	go syncRevokedAccessTokens()
+	go failExpiredExportJobs()
+
+	router := router.ConstructRouter()
+
+	origins := gorillaHandlers.AllowedOrigins([]string{"*"})
+	headers := gorillaHandlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-Share-Password"})
+	methods := gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+
+	httpServer, tlsReloader, err := server.New(gorillaHandlers.CORS(origins, headers, methods)(router))
+	if err != nil {
+		logger.Log.Error(err.Error())
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(httpServer)
+	}()
+	if tlsReloader != nil {
+		logger.Log.Info("Starting HTTPS server listening at " + config.Config.HttpServer.Port)
+	} else {
+		logger.Log.Info("Starting HTTP server listening at " + config.Config.HttpServer.Port)
+	}
+
+	for {
+		select {
+		case err := <-serveErr:
+			logger.Log.Critical(err)
+			return 1
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloadTLS(tlsReloader)
+				continue
+			}
+			return shutdown(httpServer, sig)
+		}
+	}
+}
+
+// reloadTLS loads the TLS certificate and client CAs again, keeping the ones
+// in use if that fails.
+func reloadTLS(tlsReloader *server.TLSReloader) {
+	if tlsReloader == nil {
+		logger.Log.Info("Ignoring SIGHUP, TLS isn't configured")
+		return
+	}
+	if err := tlsReloader.Reload(); err != nil {
+		logger.Log.Error(err.Error() + ", keeping the loaded certificates")
+		return
+	}
+	logger.Log.Info("Reloaded the TLS certificates")
+}
+
+// shutdown stops accepting connections and waits for the requests in flight
+// and the export jobs up to the shutdown timeout, closing the connections
+// still open after it.
+func shutdown(httpServer *http.Server, sig os.Signal) int {
+	timeout := server.ShutdownTimeout()
+	logger.Log.Info("Received " + sig.String() + ", shutting down within " + timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	code := 0
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Log.Error("Failed to drain the connections in time, error: " + err.Error())
+		httpServer.Close()
+		code = 1
+	}
+	if err := jobs.Wait(ctx); err != nil {
+		logger.Log.Error("Export jobs didn't finish in time, they will be failed once their leases expire")
+		code = 1
+	}
+
+	if err := database.Database.Close(); err != nil {
+		logger.Log.Error("Failed to close the database, error: " + err.Error())
+		code = 1
+	}
+	logger.Log.Info("Server stopped")
+	return code
+}
+
+// loadRevokedAccessTokens adds the revocations persisted by any instance to
+// the ones checked by the auth decorators.
+func loadRevokedAccessTokens() error {
+	revokedAccessTokens, err := repositories.GetRevokedAccessTokens(database.Database)
+	if err != nil {
+		return err
+	}
+	services.RevokeAccessTokens(revokedAccessTokens)
+	return nil
+}
+
+// syncRevokedAccessTokens periodically loads the revoked access tokens, so
+// that logging out on one instance is enforced by all of them.
+func syncRevokedAccessTokens() {
+	for {
+		time.Sleep(services.RevokedAccessTokenSyncInterval)
+		loadRevokedAccessTokens()
+	}
+}
+
+// failExpiredExportJobs periodically fails the export jobs left unfinished
+// by instances that have stopped.
+func failExpiredExportJobs() {
+	for {
+		failed, err := repositories.FailExpiredExportJobs(database.Database)
+		if err == nil && failed > 0 {
+			logger.Log.Info("Failed " + strconv.FormatInt(failed, 10) + " interrupted export(s)")
+		}
+		time.Sleep(jobs.ExportJobLeaseRenewInterval)
+	}
+}
+
+// runCleanups periodically deletes the accounts whose deletion grace period
+// has passed and the export archives that have expired.
+func runCleanups() {
+	for {
+		deleted, err := repositories.DeleteScheduledUsers(database.Database)
+		if err == nil && deleted > 0 {
+			logger.Log.Info("Deleted " + strconv.FormatInt(deleted, 10) + " user(s) scheduled for deletion")
+		}
+		deleted, err = repositories.DeleteExpiredExportJobs(database.Database)
+		if err == nil && deleted > 0 {
+			logger.Log.Info("Deleted " + strconv.FormatInt(deleted, 10) + " expired export(s)")
+		}
+		time.Sleep(services.CleanupInterval)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+)
+
+// New returns the HTTP server of the API with the timeouts and size limits
+// of the httpServer config. When TLS is configured its certificates are
+// served from the returned TLSReloader, otherwise that is nil.
+func New(handler http.Handler) (*http.Server, *TLSReloader, error) {
+	serverConfig := config.Config.HttpServer
+	server := &http.Server{
+		Addr:              ":" + serverConfig.Port,
+		Handler:           LimitBody(handler, serverConfig.MaxBodyBytes),
+		ReadTimeout:       configuredDuration(serverConfig.ReadTimeout),
+		ReadHeaderTimeout: configuredDuration(serverConfig.ReadHeaderTimeout),
+		WriteTimeout:      configuredDuration(serverConfig.WriteTimeout),
+		IdleTimeout:       configuredDuration(serverConfig.IdleTimeout),
+		MaxHeaderBytes:    serverConfig.MaxHeaderBytes,
+	}
+
+	tlsConfig := serverConfig.Tls
+	if tlsConfig.CertFile == "" {
+		return server, nil, nil
+	}
+	reloader, err := NewTLSReloader(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ClientCaFile, tlsConfig.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.TLSConfig = reloader.TLSConfig()
+	return server, reloader, nil
+}
+
+// Serve listens on the address of the server, over TLS if it has a TLS
+// config. Like http.Server's methods it returns http.ErrServerClosed once
+// the server is shut down.
+func Serve(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// ShutdownTimeout returns how long shutting down waits for the requests in
+// flight and the running export jobs to finish.
+func ShutdownTimeout() time.Duration {
+	if timeout := configuredDuration(config.Config.HttpServer.ShutdownTimeout); timeout > 0 {
+		return timeout
+	}
+	return 30 * time.Second
+}
+
+// configuredDuration parses a duration the config has been validated to
+// hold, an empty value being zero.
+func configuredDuration(value string) time.Duration {
+	duration, _ := time.ParseDuration(value)
+	return duration
+}
+
+// LimitBody rejects requests whose body is declared larger than maxBytes,
+// and stops reading the bodies of the rest at maxBytes. A limit of zero
+// turns it off.
+func LimitBody(next http.Handler, maxBytes int64) http.Handler {
+	if maxBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			io.WriteString(w, `{"error": "Request body is too large"}`)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
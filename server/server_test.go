@@ -0,0 +1,173 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jafarlihi/addressbook/server"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	privateKey  *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+// newTestCertificate creates a certificate for localhost, signed by the parent
+// or self-signed if there is none.
+func newTestCertificate(t *testing.T, name string, isCA bool, parent *testCertificate) *testCertificate {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, privateKey
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.privateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &privateKey.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	return &testCertificate{
+		certificate: certificate,
+		privateKey:  privateKey,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, content []byte) {
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	handler := server.LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}), 4)
+
+	cases := []struct {
+		body          io.Reader
+		contentLength int64
+		status        int
+	}{
+		{strings.NewReader("1234"), 4, http.StatusOK},
+		{strings.NewReader("12345"), 5, http.StatusRequestEntityTooLarge},
+		{strings.NewReader("12345"), -1, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/api/contact", c.body)
+		req.ContentLength = c.contentLength
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != c.status {
+			t.Errorf("Content length %d returned status %d, expected %d", c.contentLength, rr.Code, c.status)
+		}
+	}
+}
+
+func TestTLSReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := newTestCertificate(t, "first", false, nil)
+	writeFile(t, certFile, first.certPEM)
+	writeFile(t, keyFile, first.keyPEM)
+
+	reloader, err := server.NewTLSReloader(certFile, keyFile, "", "")
+	if err != nil {
+		t.Fatalf("NewTLSReloader returned error %s", err)
+	}
+
+	second := newTestCertificate(t, "second", false, nil)
+	writeFile(t, certFile, second.certPEM)
+	writeFile(t, keyFile, second.keyPEM)
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload returned error %s", err)
+	}
+	certificate, _ := reloader.GetCertificate(nil)
+	if string(certificate.Certificate[0]) != string(second.certificate.Raw) {
+		t.Error("Reload didn't replace the certificate")
+	}
+
+	writeFile(t, keyFile, []byte("not a key"))
+	if err := reloader.Reload(); err == nil {
+		t.Error("Reload with a broken key file didn't fail")
+	}
+	certificate, _ = reloader.GetCertificate(nil)
+	if string(certificate.Certificate[0]) != string(second.certificate.Raw) {
+		t.Error("Failed reload didn't keep the loaded certificate")
+	}
+}
+
+func TestTLSReloaderRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "ca", true, nil)
+	serverCertificate := newTestCertificate(t, "server", false, ca)
+	clientCertificate := newTestCertificate(t, "client", false, ca)
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writeFile(t, certFile, serverCertificate.certPEM)
+	writeFile(t, keyFile, serverCertificate.keyPEM)
+	writeFile(t, caFile, ca.certPEM)
+
+	reloader, err := server.NewTLSReloader(certFile, keyFile, caFile, "")
+	if err != nil {
+		t.Fatalf("NewTLSReloader returned error %s", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = reloader.TLSConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	get := func(certificates []tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: certificates}}}
+		resp, err := client.Get(ts.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(nil); err == nil {
+		t.Error("Request without a client certificate succeeded")
+	}
+	clientKeyPair, err := tls.X509KeyPair(clientCertificate.certPEM, clientCertificate.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get([]tls.Certificate{clientKeyPair}); err != nil {
+		t.Errorf("Request with a client certificate failed, error: %s", err)
+	}
+}
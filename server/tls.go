@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// TLSReloader holds the certificate and client CAs the server uses for TLS,
+// so that Reload can replace them, for renewed certificates, without
+// restarting the server.
+type TLSReloader struct {
+	certFile     string
+	keyFile      string
+	clientCaFile string
+	clientAuth   tls.ClientAuthType
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+// NewTLSReloader loads the certificate and key, and the client CAs if a CA
+// file is given. Client certificates are then required, or only verified if
+// presented when clientAuth is "optional".
+func NewTLSReloader(certFile string, keyFile string, clientCaFile string, clientAuth string) (*TLSReloader, error) {
+	reloader := &TLSReloader{certFile: certFile, keyFile: keyFile, clientCaFile: clientCaFile, clientAuth: tls.NoClientCert}
+	if clientCaFile != "" {
+		reloader.clientAuth = tls.RequireAndVerifyClientCert
+		if clientAuth == "optional" {
+			reloader.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the files again. If any of them fails to load the ones in use
+// are kept.
+func (r *TLSReloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.New("Failed to load the TLS certificate, error: " + err.Error())
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCaFile != "" {
+		content, err := ioutil.ReadFile(r.clientCaFile)
+		if err != nil {
+			return errors.New("Failed to read the client CA file, error: " + err.Error())
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(content) {
+			return errors.New("Client CA file has no PEM encoded certificates")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// GetCertificate returns the certificate in use, it fits tls.Config.
+func (r *TLSReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// TLSConfig returns a config that picks up the certificate and client CAs in
+// use at every handshake.
+func (r *TLSReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     []string{"h2", "http/1.1"},
+				GetCertificate: r.GetCertificate,
+				ClientCAs:      r.clientCAs,
+				ClientAuth:     r.clientAuth,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"time"
+
+	"github.com/jafarlihi/addressbook/mailer"
+)
+
+const (
+	// AccountDeletionGracePeriod is how long a deleted account can be
+	// restored for before it and everything it owns is deleted for good.
+	AccountDeletionGracePeriod = 14 * 24 * time.Hour
+	// CleanupInterval is how often accounts past their grace period and
+	// expired data exports are looked for.
+	CleanupInterval = time.Hour
+)
+
+// AccountDeletionMessage composes the email telling the user when their
+// account is going to be deleted and how to stop it.
+func AccountDeletionMessage(email string, at time.Time) *mailer.Message {
+	return &mailer.Message{
+		To:      email,
+		Subject: "Your addressbook account is going to be deleted",
+		Body: "Your addressbook account and all of its contacts and lists are going to be deleted on " +
+			at.UTC().Format(time.RFC1123) + ".\r\n\r\n" +
+			"If you change your mind, log in and POST to /api/user/me/restore before then.\r\n",
+	}
+}
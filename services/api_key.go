@@ -0,0 +1,34 @@
+package services
+
+import "strings"
+
+const (
+	apiKeyScheme       = "ApiKey"
+	apiKeyTokenPrefix  = "abk_"
+	apiKeyPrefixLength = len(apiKeyTokenPrefix) + 8
+)
+
+// NewAPIKey returns a new API key, the prefix it's listed under, and the hash
+// it's stored under. The key itself is only shown to the user once.
+func NewAPIKey() (string, string, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key := apiKeyTokenPrefix + token
+	return key, key[:apiKeyPrefixLength], HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	return hashToken(key)
+}
+
+// ParseAPIKeyHeader returns the API key of an `Authorization: ApiKey [key]`
+// header, and false if the header uses another scheme.
+func ParseAPIKeyHeader(header string) (string, bool) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], apiKeyScheme) {
+		return "", false
+	}
+	return fields[1], true
+}
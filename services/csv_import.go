@@ -0,0 +1,284 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/models"
+)
+
+// CSVMapping maps CSV headers onto contact fields. Plain fields are "name",
+// "surname", "notes", and "birthday". Phone numbers, emails, and postal
+// addresses are mapped as "<kind>.<slot>.<attribute>", where columns with
+// the same slot end up in the same entry, for example "phone.1.label" and
+// "phone.1.number". If no label column is mapped for a slot and the slot is
+// itself a label, like in "phone.mobile.number", it's used as the label.
+type CSVMapping map[string]string
+
+// ParsedCSVRow is a single data row of an imported CSV file. Row is the
+// 1-based line number of the row in the file, header included.
+type ParsedCSVRow struct {
+	Row     int
+	Contact *models.Contact
+	Err     error
+}
+
+var csvMappingAttributes = map[string][]string{
+	"phone":   {"number", "label"},
+	"email":   {"address", "label"},
+	"address": {"street", "city", "region", "postcode", "country", "label"},
+}
+
+var CSVPresets = map[string]CSVMapping{
+	"google":  googleCSVPreset(),
+	"outlook": outlookCSVPreset(),
+}
+
+func googleCSVPreset() CSVMapping {
+	mapping := CSVMapping{
+		"First Name":  "name",
+		"Given Name":  "name",
+		"Last Name":   "surname",
+		"Family Name": "surname",
+		"Notes":       "notes",
+		"Birthday":    "birthday",
+	}
+	for i := 1; i <= 3; i++ {
+		slot := fmt.Sprint(i)
+		mapping["E-mail "+slot+" - Label"] = "email." + slot + ".label"
+		mapping["E-mail "+slot+" - Type"] = "email." + slot + ".label"
+		mapping["E-mail "+slot+" - Value"] = "email." + slot + ".address"
+		mapping["Phone "+slot+" - Label"] = "phone." + slot + ".label"
+		mapping["Phone "+slot+" - Type"] = "phone." + slot + ".label"
+		mapping["Phone "+slot+" - Value"] = "phone." + slot + ".number"
+		mapping["Address "+slot+" - Label"] = "address." + slot + ".label"
+		mapping["Address "+slot+" - Type"] = "address." + slot + ".label"
+		mapping["Address "+slot+" - Street"] = "address." + slot + ".street"
+		mapping["Address "+slot+" - City"] = "address." + slot + ".city"
+		mapping["Address "+slot+" - Region"] = "address." + slot + ".region"
+		mapping["Address "+slot+" - Postal Code"] = "address." + slot + ".postcode"
+		mapping["Address "+slot+" - Country"] = "address." + slot + ".country"
+	}
+	return mapping
+}
+
+func outlookCSVPreset() CSVMapping {
+	return CSVMapping{
+		"First Name":              "name",
+		"Last Name":               "surname",
+		"Notes":                   "notes",
+		"Birthday":                "birthday",
+		"E-mail Address":          "email.1.address",
+		"E-mail 2 Address":        "email.2.address",
+		"E-mail 3 Address":        "email.3.address",
+		"Mobile Phone":            "phone.mobile.number",
+		"Business Phone":          "phone.work.number",
+		"Home Phone":              "phone.home.number",
+		"Business Street":         "address.work.street",
+		"Business City":           "address.work.city",
+		"Business State":          "address.work.region",
+		"Business Postal Code":    "address.work.postcode",
+		"Business Country/Region": "address.work.country",
+		"Home Street":             "address.home.street",
+		"Home City":               "address.home.city",
+		"Home State":              "address.home.region",
+		"Home Postal Code":        "address.home.postcode",
+		"Home Country/Region":     "address.home.country",
+	}
+}
+
+// Validate checks that every header is mapped onto a known contact field.
+func (mapping CSVMapping) Validate() error {
+	for header, field := range mapping {
+		switch field {
+		case "name", "surname", "notes", "birthday":
+			continue
+		}
+		parts := strings.Split(field, ".")
+		attributes, ok := csvMappingAttributes[parts[0]]
+		if !ok || len(parts) != 3 || parts[1] == "" || !containsString(attributes, parts[2]) {
+			return fmt.Errorf("Column %s is mapped to unknown field %s", header, field)
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCSVContacts reads contacts out of a CSV file with a header row using
+// the given mapping. Columns that aren't in the mapping are ignored.
+func ParseCSVContacts(r io.Reader, mapping CSVMapping) ([]*ParsedCSVRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV file doesn't have a header row")
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns := make(map[int]string)
+	for i, name := range header {
+		if field, ok := mapping[strings.TrimSpace(name)]; ok {
+			columns[i] = field
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("None of the CSV columns are mapped onto contact fields")
+	}
+
+	rows := make([]*ParsedCSVRow, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				rows = append(rows, &ParsedCSVRow{Row: line, Err: err})
+				continue
+			}
+			return nil, err
+		}
+		contact, err := csvRecordToContact(record, columns)
+		rows = append(rows, &ParsedCSVRow{Row: line, Contact: contact, Err: err})
+	}
+	return rows, nil
+}
+
+func csvRecordToContact(record []string, columns map[int]string) (*models.Contact, error) {
+	contact := &models.Contact{
+		PhoneNumbers: make([]*models.PhoneNumber, 0),
+		Emails:       make([]*models.EmailAddress, 0),
+		Addresses:    make([]*models.PostalAddress, 0),
+	}
+	slots := make(map[string]map[string]string)
+	for i, value := range record {
+		field, ok := columns[i]
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			continue
+		}
+		switch field {
+		case "name":
+			contact.Name = value
+		case "surname":
+			contact.Surname = value
+		case "notes":
+			contact.Notes = value
+		case "birthday":
+			birthday, err := normalizeCSVBirthday(value)
+			if err != nil {
+				return nil, err
+			}
+			contact.Birthday = birthday
+		default:
+			parts := strings.Split(field, ".")
+			slot := parts[0] + "." + parts[1]
+			if slots[slot] == nil {
+				slots[slot] = make(map[string]string)
+			}
+			slots[slot][parts[2]] = value
+		}
+	}
+
+	// Slots are sorted so that the entries keep the order of their columns,
+	// which decides the primary email when none is marked.
+	slotNames := make([]string, 0, len(slots))
+	for slot := range slots {
+		slotNames = append(slotNames, slot)
+	}
+	sort.Strings(slotNames)
+	for _, slot := range slotNames {
+		kind := strings.SplitN(slot, ".", 2)[0]
+		values := slots[slot]
+		label, primary := csvLabel(values["label"], strings.SplitN(slot, ".", 2)[1])
+		switch kind {
+		case "phone":
+			for _, number := range splitCSVMultiValue(values["number"]) {
+				phoneLabel := label
+				if phoneLabel != "work" && phoneLabel != "home" {
+					phoneLabel = "mobile"
+				}
+				contact.PhoneNumbers = append(contact.PhoneNumbers, &models.PhoneNumber{Label: phoneLabel, Number: number})
+			}
+		case "email":
+			for _, address := range splitCSVMultiValue(values["address"]) {
+				contact.Emails = append(contact.Emails, &models.EmailAddress{Label: label, Address: strings.ToLower(address), Primary: primary})
+				primary = false
+			}
+		case "address":
+			if values["street"] == "" && values["city"] == "" && values["region"] == "" && values["postcode"] == "" && values["country"] == "" {
+				continue
+			}
+			contact.Addresses = append(contact.Addresses, &models.PostalAddress{
+				Label:    label,
+				Street:   values["street"],
+				City:     values["city"],
+				Region:   values["region"],
+				Postcode: values["postcode"],
+				Country:  values["country"],
+			})
+		}
+	}
+	return contact, nil
+}
+
+// csvLabel turns a label column like Google's "* Work" into a label and a
+// primary flag, falling back to the slot name if it's a known label.
+func csvLabel(value string, slot string) (string, bool) {
+	primary := strings.HasPrefix(value, "* ")
+	value = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(value, "* ")))
+	if value == "" {
+		value = slot
+	}
+	switch value {
+	case "mobile", "cell":
+		return "mobile", primary
+	case "work", "business":
+		return "work", primary
+	case "home":
+		return "home", primary
+	}
+	return "", primary
+}
+
+// splitCSVMultiValue splits values that Google Contacts joins with " ::: ".
+func splitCSVMultiValue(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ":::") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func normalizeCSVBirthday(value string) (string, error) {
+	if value == "0/0/00" {
+		return "", nil
+	}
+	if len(value) == 7 && strings.HasPrefix(value, "--") {
+		return value, nil
+	}
+	for _, layout := range []string{"2006-01-02", "1/2/2006", "01/02/2006", "20060102"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported birthday value: %s", value)
+}
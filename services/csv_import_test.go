@@ -0,0 +1,73 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestParseCSVContactsWithGooglePreset(t *testing.T) {
+	csv := "First Name,Last Name,Birthday,E-mail 1 - Label,E-mail 1 - Value,E-mail 2 - Label,E-mail 2 - Value,Phone 1 - Label,Phone 1 - Value,Address 1 - Label,Address 1 - City\n" +
+		"John,Doe,1980-01-02,Work,john@work.com,* Home,john@home.com,Mobile,+1 555 0100 ::: +1 555 0101,Home,Springfield\n" +
+		"Jane,Roe,not a date,,,,,,,,\n"
+
+	rows, err := services.ParseCSVContacts(strings.NewReader(csv), services.CSVPresets["google"])
+	if err != nil {
+		t.Fatalf("ParseCSVContacts returned error %s", err.Error())
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("ParseCSVContacts returned %d rows, expected 2", len(rows))
+	}
+
+	contact := rows[0].Contact
+	if rows[0].Err != nil || rows[0].Row != 2 || contact.Name != "John" || contact.Surname != "Doe" || contact.Birthday != "1980-01-02" {
+		t.Errorf("First row was not parsed as expected: %+v", contact)
+	}
+
+	if len(contact.Emails) != 2 || contact.Emails[0].Label != "work" || contact.Emails[0].Primary || contact.Emails[1].Label != "home" || !contact.Emails[1].Primary {
+		t.Errorf("Emails of first row were not parsed as expected")
+	}
+
+	if len(contact.PhoneNumbers) != 2 || contact.PhoneNumbers[1].Number != "+1 555 0101" || contact.PhoneNumbers[1].Label != "mobile" {
+		t.Errorf("Phone numbers of first row were not parsed as expected")
+	}
+
+	if len(contact.Addresses) != 1 || contact.Addresses[0].Label != "home" || contact.Addresses[0].City != "Springfield" {
+		t.Errorf("Addresses of first row were not parsed as expected")
+	}
+
+	if rows[1].Err == nil || rows[1].Row != 3 {
+		t.Errorf("Second row with a malformed birthday was expected to fail")
+	}
+}
+
+func TestParseCSVContactsWithOutlookPreset(t *testing.T) {
+	csv := "First Name,Last Name,E-mail Address,Business Phone,Home City,Birthday\n" +
+		"John,Doe,John@Mail.com,555 0100,Springfield,1/2/1980\n"
+
+	rows, err := services.ParseCSVContacts(strings.NewReader(csv), services.CSVPresets["outlook"])
+	if err != nil {
+		t.Fatalf("ParseCSVContacts returned error %s", err.Error())
+	}
+
+	contact := rows[0].Contact
+	if len(rows) != 1 || rows[0].Err != nil || contact.Emails[0].Address != "john@mail.com" || contact.PhoneNumbers[0].Label != "work" || contact.Addresses[0].Label != "home" || contact.Birthday != "1980-01-02" {
+		t.Errorf("Row was not parsed as expected: %+v", contact)
+	}
+}
+
+func TestCSVMappingValidate(t *testing.T) {
+	if err := services.CSVPresets["google"].Validate(); err != nil {
+		t.Errorf("Google preset failed validation: %s", err.Error())
+	}
+
+	if err := services.CSVPresets["outlook"].Validate(); err != nil {
+		t.Errorf("Outlook preset failed validation: %s", err.Error())
+	}
+
+	if err := (services.CSVMapping{"Fax": "phone.1.fax"}).Validate(); err == nil {
+		t.Errorf("Mapping onto an unknown field was expected to fail validation")
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoginFailureWindow is how long failed login attempts are remembered for,
+// the count starts over once there have been none for this long.
+const LoginFailureWindow = time.Hour
+
+// loginThrottlePolicy delays the next attempt exponentially from BaseDelay
+// once there have been BackoffAfter failures, and locks logging in for
+// Lockout once there have been LockoutAfter.
+type loginThrottlePolicy struct {
+	BackoffAfter int
+	LockoutAfter int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Lockout      time.Duration
+}
+
+var (
+	accountThrottlePolicy = loginThrottlePolicy{BackoffAfter: 3, LockoutAfter: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Minute, Lockout: 15 * time.Minute}
+	ipThrottlePolicy      = loginThrottlePolicy{BackoffAfter: 20, LockoutAfter: 100, BaseDelay: time.Second, MaxDelay: 5 * time.Minute, Lockout: 15 * time.Minute}
+)
+
+const (
+	accountThrottlePrefix        = "account:"
+	unknownAccountThrottlePrefix = "login:"
+	mfaThrottlePrefix            = "mfa:"
+	ipThrottlePrefix             = "ip:"
+)
+
+// AccountThrottleKey tracks the wrong passwords of a user, whether they log
+// in with their username or their email.
+func AccountThrottleKey(userID uint32) string {
+	return accountThrottlePrefix + fmt.Sprint(userID)
+}
+
+// UnknownAccountThrottleKey tracks the failures of a username or email no
+// user has, so that lockouts don't reveal who has an account.
+func UnknownAccountThrottleKey(identifier string) string {
+	return unknownAccountThrottlePrefix + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// MFAThrottleKey tracks the wrong second factor codes of a user.
+func MFAThrottleKey(userID uint32) string {
+	return mfaThrottlePrefix + fmt.Sprint(userID)
+}
+
+func IPThrottleKey(ip string) string {
+	return ipThrottlePrefix + ip
+}
+
+// LoginBlockDuration returns how long logging in has to be blocked for the
+// throttle key after the number of failures.
+func LoginBlockDuration(key string, failures int) time.Duration {
+	policy := accountThrottlePolicy
+	if strings.HasPrefix(key, ipThrottlePrefix) {
+		policy = ipThrottlePolicy
+	}
+
+	if failures >= policy.LockoutAfter {
+		return policy.Lockout
+	}
+	if failures < policy.BackoffAfter {
+		return 0
+	}
+	delay := policy.BaseDelay
+	for i := policy.BackoffAfter; i < failures && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
+
+var dummyPasswordHash = struct {
+	sync.Once
+	hash []byte
+}{}
+
+// CompareDummyPassword does the bcrypt work of checking a password for users
+// that don't exist, so that response times don't reveal who does.
+func CompareDummyPassword(password string) {
+	dummyPasswordHash.Do(func() {
+		dummyPasswordHash.hash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash.hash, []byte(password))
+}
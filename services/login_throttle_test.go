@@ -0,0 +1,41 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestLoginBlockDuration(t *testing.T) {
+	accountKey := services.AccountThrottleKey(1)
+	unknownKey := services.UnknownAccountThrottleKey("User")
+	ipKey := services.IPThrottleKey("127.0.0.1")
+
+	expected := []struct {
+		key      string
+		failures int
+		duration time.Duration
+	}{
+		{accountKey, 2, 0},
+		{accountKey, 3, time.Second},
+		{accountKey, 5, 4 * time.Second},
+		{accountKey, 9, 64 * time.Second},
+		{accountKey, 10, 15 * time.Minute},
+		{unknownKey, 3, time.Second},
+		{unknownKey, 10, 15 * time.Minute},
+		{ipKey, 10, 0},
+		{ipKey, 20, time.Second},
+		{ipKey, 40, 5 * time.Minute},
+		{ipKey, 100, 15 * time.Minute},
+	}
+	for _, e := range expected {
+		if duration := services.LoginBlockDuration(e.key, e.failures); duration != e.duration {
+			t.Errorf("LoginBlockDuration(%s, %d) returned %v, expected %v", e.key, e.failures, duration, e.duration)
+		}
+	}
+
+	if unknownKey != services.UnknownAccountThrottleKey(" user ") {
+		t.Error("UnknownAccountThrottleKey isn't case and whitespace insensitive")
+	}
+}
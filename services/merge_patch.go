@@ -0,0 +1,37 @@
+package services
+
+import "encoding/json"
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to the given JSON document.
+// Members set to null in the patch are removed from the document, members
+// left out of the patch are kept as they are.
+func MergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target, patchValue interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatchValue(target, patchValue))
+}
+
+func mergePatchValue(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatchValue(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
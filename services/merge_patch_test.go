@@ -0,0 +1,34 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestMergePatch(t *testing.T) {
+	document := `{"a":"b","c":{"d":"e","f":"g"}}`
+	patch := `{"a":"z","c":{"f":null},"h":"i"}`
+
+	patched, err := services.MergePatch([]byte(document), []byte(patch))
+	if err != nil {
+		t.Errorf("MergePatch returned error %s", err.Error())
+	}
+
+	expected := `{"a":"z","c":{"d":"e"},"h":"i"}`
+	if string(patched) != expected {
+		t.Errorf("MergePatch returned %s, expected %s", patched, expected)
+	}
+}
+
+func TestMergePatchWithNonObjectPatch(t *testing.T) {
+	patched, err := services.MergePatch([]byte(`{"a":"b"}`), []byte(`["c"]`))
+	if err != nil {
+		t.Errorf("MergePatch returned error %s", err.Error())
+	}
+
+	expected := `["c"]`
+	if string(patched) != expected {
+		t.Errorf("MergePatch returned %s, expected %s", patched, expected)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import "github.com/jafarlihi/addressbook/models"
+
+// Roles on a contact-list. Owners can do everything, editors can also add
+// and remove its contacts, and viewers can only read it.
+const (
+	ContactListOwner  = "owner"
+	ContactListEditor = "editor"
+	ContactListViewer = "viewer"
+)
+
+// Permission is what a user wants to do with a contact-list.
+type Permission int
+
+const (
+	// PermissionRead allows fetching the list and its contacts.
+	PermissionRead Permission = iota
+	// PermissionEdit allows adding and removing contacts of the list.
+	PermissionEdit
+	// PermissionManage allows updating, deleting, and sharing the list.
+	PermissionManage
+)
+
+var contactListRolePermissions = map[string]Permission{
+	ContactListViewer: PermissionRead,
+	ContactListEditor: PermissionEdit,
+	ContactListOwner:  PermissionManage,
+}
+
+// ContactListRole returns the role of the user on the contact-list, given the
+// role it has been shared with them with, which is empty if it hasn't been.
+func ContactListRole(contactList *models.ContactList, userID uint32, sharedRole string) string {
+	if contactList.UserID == userID {
+		return ContactListOwner
+	}
+	if IsShareableRole(sharedRole) {
+		return sharedRole
+	}
+	return ""
+}
+
+// HasPermission reports whether the role allows the permission, users
+// without a role have none.
+func HasPermission(role string, permission Permission) bool {
+	granted, ok := contactListRolePermissions[role]
+	return ok && granted >= permission
+}
+
+// IsShareableRole reports whether contact-lists can be shared with the role.
+func IsShareableRole(role string) bool {
+	return role == ContactListViewer || role == ContactListEditor
+}
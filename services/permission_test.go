@@ -0,0 +1,49 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestContactListRole(t *testing.T) {
+	contactList := &models.ContactList{ID: 1, UserID: 1}
+
+	tests := []struct {
+		userID     uint32
+		sharedRole string
+		expected   string
+	}{
+		{1, "", services.ContactListOwner},
+		{2, services.ContactListViewer, services.ContactListViewer},
+		{2, services.ContactListEditor, services.ContactListEditor},
+		{2, services.ContactListOwner, ""},
+		{2, "", ""},
+	}
+	for _, test := range tests {
+		if role := services.ContactListRole(contactList, test.userID, test.sharedRole); role != test.expected {
+			t.Errorf("ContactListRole(%d, %q) returned %q, expected %q", test.userID, test.sharedRole, role, test.expected)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role    string
+		allowed []bool
+	}{
+		{services.ContactListOwner, []bool{true, true, true}},
+		{services.ContactListEditor, []bool{true, true, false}},
+		{services.ContactListViewer, []bool{true, false, false}},
+		{"", []bool{false, false, false}},
+	}
+	permissions := []services.Permission{services.PermissionRead, services.PermissionEdit, services.PermissionManage}
+	for _, test := range tests {
+		for i, permission := range permissions {
+			if allowed := services.HasPermission(test.role, permission); allowed != test.allowed[i] {
+				t.Errorf("HasPermission(%q, %d) returned %v, expected %v", test.role, permission, allowed, test.allowed[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	ScopeContactsRead  = "contacts:read"
+	ScopeContactsWrite = "contacts:write"
+	ScopeListsRead     = "lists:read"
+	ScopeListsWrite    = "lists:write"
+	ScopeAccount       = "account"
+)
+
+// AllScopes are granted to tokens that don't ask for fewer.
+var AllScopes = []string{ScopeContactsRead, ScopeContactsWrite, ScopeListsRead, ScopeListsWrite, ScopeAccount}
+
+// NormalizeScopes checks that the scopes exist and drops duplicates, keeping
+// their order. No scopes at all means all of them.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return append([]string{}, AllScopes...), nil
+	}
+	normalized := make([]string, 0, len(scopes))
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !isScope(scope) {
+			return nil, errors.New("Unknown scope " + scope + ", scopes have to be some of " + strings.Join(AllScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+func isScope(scope string) bool {
+	for _, known := range AllScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingScope returns the first of the required scopes that hasn't been
+// granted, or an empty string if all of them have.
+func MissingScope(granted []string, required []string) string {
+	for _, scope := range required {
+		found := false
+		for _, grantedScope := range granted {
+			if grantedScope == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return scope
+		}
+	}
+	return ""
+}
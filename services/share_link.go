@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/models"
+)
+
+const (
+	DefaultShareLinkLifetime = 7 * 24 * time.Hour
+	MaxShareLinkLifetime     = 90 * 24 * time.Hour
+
+	shareLinkThrottlePrefix = "share:"
+)
+
+// ShareLinkFields are the contact fields share links can expose.
+var ShareLinkFields = []string{"name", "surname", "email", "phoneNumbers", "emails", "addresses", "notes", "birthday", "tags", "customFields"}
+
+// DefaultShareLinkFields are exposed by links that don't pick their fields,
+// notes and custom fields are left out as they tend to be private.
+var DefaultShareLinkFields = []string{"name", "surname", "email", "phoneNumbers", "emails", "addresses", "birthday"}
+
+// NewShareLinkToken returns a new unguessable share link token and the hash
+// it's stored under.
+func NewShareLinkToken() (string, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashShareLinkToken(token), nil
+}
+
+func HashShareLinkToken(token string) string {
+	return hashToken(token)
+}
+
+// ShareLinkThrottleKey tracks the wrong passwords entered for a share link.
+func ShareLinkThrottleKey(tokenHash string) string {
+	return shareLinkThrottlePrefix + tokenHash
+}
+
+// NormalizeShareLinkFields checks that the fields exist and drops
+// duplicates, keeping their order. No fields at all means the default ones.
+func NormalizeShareLinkFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return append([]string{}, DefaultShareLinkFields...), nil
+	}
+	normalized := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if !isShareLinkField(field) {
+			return nil, errors.New("Unknown field " + field + ", fields have to be some of " + strings.Join(ShareLinkFields, ", "))
+		}
+		if !seen[field] {
+			seen[field] = true
+			normalized = append(normalized, field)
+		}
+	}
+	return normalized, nil
+}
+
+func isShareLinkField(field string) bool {
+	for _, known := range ShareLinkFields {
+		if field == known {
+			return true
+		}
+	}
+	return false
+}
+
+func hasShareLinkField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactContact returns a copy of the contact holding only the fields, for
+// exporting it as a vCard.
+func RedactContact(contact *models.Contact, fields []string) *models.Contact {
+	redacted := &models.Contact{}
+	for _, field := range fields {
+		switch field {
+		case "name":
+			redacted.Name = contact.Name
+		case "surname":
+			redacted.Surname = contact.Surname
+		case "email":
+			redacted.Email = contact.Email
+			// vCards are written from the emails, so the primary one has to
+			// be kept there when the others aren't exposed.
+			if contact.Email != "" && !hasShareLinkField(fields, "emails") {
+				redacted.Emails = []*models.EmailAddress{primaryEmailAddress(contact)}
+			}
+		case "phoneNumbers":
+			redacted.PhoneNumbers = contact.PhoneNumbers
+		case "emails":
+			redacted.Emails = contact.Emails
+		case "addresses":
+			redacted.Addresses = contact.Addresses
+		case "notes":
+			redacted.Notes = contact.Notes
+		case "birthday":
+			redacted.Birthday = contact.Birthday
+		case "tags":
+			redacted.Tags = contact.Tags
+		case "customFields":
+			redacted.CustomFields = contact.CustomFields
+		}
+	}
+	return redacted
+}
+
+func primaryEmailAddress(contact *models.Contact) *models.EmailAddress {
+	for _, email := range contact.Emails {
+		if email.Primary && email.Address == contact.Email {
+			return &models.EmailAddress{Label: email.Label, Address: email.Address, Primary: true}
+		}
+	}
+	return &models.EmailAddress{Address: contact.Email, Primary: true}
+}
+
+// The details of public contacts are copied without their IDs.
+type publicPhoneNumber struct {
+	Label  string `json:"label"`
+	Number string `json:"number"`
+}
+
+type publicEmailAddress struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
+type publicPostalAddress struct {
+	Label    string `json:"label"`
+	Street   string `json:"street"`
+	City     string `json:"city"`
+	Region   string `json:"region"`
+	Postcode string `json:"postcode"`
+	Country  string `json:"country"`
+}
+
+// PublicContact returns the fields of the contact keyed by their JSON names,
+// leaving out IDs and everything else that isn't exposed.
+func PublicContact(contact *models.Contact, fields []string) map[string]interface{} {
+	public := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "name":
+			public[field] = contact.Name
+		case "surname":
+			public[field] = contact.Surname
+		case "email":
+			public[field] = contact.Email
+		case "phoneNumbers":
+			phoneNumbers := make([]publicPhoneNumber, 0, len(contact.PhoneNumbers))
+			for _, phoneNumber := range contact.PhoneNumbers {
+				phoneNumbers = append(phoneNumbers, publicPhoneNumber{Label: phoneNumber.Label, Number: phoneNumber.Number})
+			}
+			public[field] = phoneNumbers
+		case "emails":
+			emails := make([]publicEmailAddress, 0, len(contact.Emails))
+			for _, email := range contact.Emails {
+				emails = append(emails, publicEmailAddress{Label: email.Label, Address: email.Address, Primary: email.Primary})
+			}
+			public[field] = emails
+		case "addresses":
+			addresses := make([]publicPostalAddress, 0, len(contact.Addresses))
+			for _, address := range contact.Addresses {
+				addresses = append(addresses, publicPostalAddress{
+					Label:    address.Label,
+					Street:   address.Street,
+					City:     address.City,
+					Region:   address.Region,
+					Postcode: address.Postcode,
+					Country:  address.Country,
+				})
+			}
+			public[field] = addresses
+		case "notes":
+			public[field] = contact.Notes
+		case "birthday":
+			public[field] = contact.Birthday
+		case "tags":
+			public[field] = contact.Tags
+		case "customFields":
+			public[field] = contact.CustomFields
+		}
+	}
+	return public
+}
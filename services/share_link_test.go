@@ -0,0 +1,122 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestNormalizeShareLinkFields(t *testing.T) {
+	fields, err := services.NormalizeShareLinkFields(nil)
+	if err != nil || len(fields) != len(services.DefaultShareLinkFields) {
+		t.Errorf("NormalizeShareLinkFields(nil) returned %v, %v", fields, err)
+	}
+
+	fields, err = services.NormalizeShareLinkFields([]string{"name", "email", "name"})
+	if err != nil || len(fields) != 2 || fields[0] != "name" || fields[1] != "email" {
+		t.Errorf("NormalizeShareLinkFields returned %v, %v", fields, err)
+	}
+
+	if _, err := services.NormalizeShareLinkFields([]string{"id"}); err == nil {
+		t.Errorf("NormalizeShareLinkFields accepted an unknown field")
+	}
+}
+
+func TestPublicContact(t *testing.T) {
+	contact := &models.Contact{ID: 1, UserID: 2, Name: "John", Surname: "Doe", Notes: "private", VCardExtra: "X-SECRET:1\r\n"}
+
+	public := services.PublicContact(contact, []string{"name", "surname"})
+	if len(public) != 2 || public["name"] != "John" || public["surname"] != "Doe" {
+		t.Errorf("PublicContact returned %v", public)
+	}
+
+	redacted := services.RedactContact(contact, []string{"name"})
+	if redacted.Name != "John" || redacted.Surname != "" || redacted.Notes != "" || redacted.ID != 0 || redacted.VCardExtra != "" {
+		t.Errorf("RedactContact returned %+v", redacted)
+	}
+}
+
+func hasIDKey(value interface{}) bool {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			if key == "id" || hasIDKey(nested) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range value {
+			if hasIDKey(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestPublicContactHasNoIDs(t *testing.T) {
+	contact := &models.Contact{
+		ID:           1,
+		Name:         "John",
+		Email:        "john@mail.com",
+		PhoneNumbers: []*models.PhoneNumber{{ID: 2, Label: "mobile", Number: "+15550100"}},
+		Emails:       []*models.EmailAddress{{ID: 3, Label: "work", Address: "john@mail.com", Primary: true}},
+		Addresses:    []*models.PostalAddress{{ID: 4, Label: "home", City: "Baku"}},
+	}
+
+	encoded, err := json.Marshal(services.PublicContact(contact, services.ShareLinkFields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if hasIDKey(decoded) {
+		t.Errorf("PublicContact exposed IDs: %s", encoded)
+	}
+	if !strings.Contains(string(encoded), `"number":"+15550100"`) || !strings.Contains(string(encoded), `"city":"Baku"`) {
+		t.Errorf("PublicContact dropped details: %s", encoded)
+	}
+}
+
+func TestRedactContactKeepsPrimaryEmailInVCard(t *testing.T) {
+	contact := &models.Contact{
+		Name:  "John",
+		Email: "john@mail.com",
+		Emails: []*models.EmailAddress{
+			{ID: 1, Label: "work", Address: "john@mail.com", Primary: true},
+			{ID: 2, Label: "home", Address: "john@home.com"},
+		},
+	}
+
+	for _, e := range []struct {
+		fields   []string
+		expected []string
+		hidden   []string
+	}{
+		{[]string{"name", "email"}, []string{"EMAIL;TYPE=work;PREF=1:john@mail.com"}, []string{"john@home.com"}},
+		{[]string{"name", "emails"}, []string{"john@mail.com", "john@home.com"}, nil},
+		{[]string{"name"}, nil, []string{"EMAIL"}},
+	} {
+		var buffer bytes.Buffer
+		if err := services.WriteVCard(&buffer, services.RedactContact(contact, e.fields), "4.0"); err != nil {
+			t.Fatal(err)
+		}
+		vcard := buffer.String()
+		for _, expected := range e.expected {
+			if !strings.Contains(vcard, expected) {
+				t.Errorf("vCard with fields %v doesn't contain %s: %s", e.fields, expected, vcard)
+			}
+		}
+		for _, hidden := range e.hidden {
+			if strings.Contains(vcard, hidden) {
+				t.Errorf("vCard with fields %v contains %s: %s", e.fields, hidden, vcard)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jafarlihi/addressbook/config"
+)
+
+// SigningMethodEdDSA implements Ed25519 signatures, which jwt-go doesn't
+// ship with.
+type SigningMethodEdDSA struct{}
+
+var EdDSASigningMethod = &SigningMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(EdDSASigningMethod.Alg(), func() jwt.SigningMethod {
+		return EdDSASigningMethod
+	})
+}
+
+func (m *SigningMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	signatureBytes, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), signatureBytes) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+// SigningKey is an asymmetric key access tokens are signed or verified with.
+// PrivateKey is nil for verify-only keys.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// JSONWebKey is the public part of a SigningKey as published in the JWKS.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var signingKeys = struct {
+	sync.RWMutex
+	byID    map[string]*SigningKey
+	ordered []*SigningKey
+	active  *SigningKey
+}{byID: make(map[string]*SigningKey)}
+
+// InitSigningKeys loads the keys listed in the JWT config. When no keys are
+// configured access tokens are signed with the HMAC signing secret instead.
+func InitSigningKeys() error {
+	keys := make([]*SigningKey, 0, len(config.Config.Jwt.Keys))
+	for _, keyConfig := range config.Config.Jwt.Keys {
+		key, err := LoadSigningKey(keyConfig.ID, keyConfig.Algorithm, keyConfig.PrivateKeyFile, keyConfig.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	return SetSigningKeys(keys, config.Config.Jwt.SigningKey)
+}
+
+// SetSigningKeys replaces the keys tokens are verified with. New tokens are
+// signed with the key identified by activeID, the rest only verify tokens
+// issued before the rotation until they are retired from the config.
+func SetSigningKeys(keys []*SigningKey, activeID string) error {
+	byID := make(map[string]*SigningKey)
+	for _, key := range keys {
+		if key.ID == "" {
+			return errors.New("Signing keys need a kid")
+		}
+		if _, exists := byID[key.ID]; exists {
+			return fmt.Errorf("Signing key %s is configured more than once", key.ID)
+		}
+		byID[key.ID] = key
+	}
+
+	var active *SigningKey
+	if activeID != "" {
+		active = byID[activeID]
+		if active == nil {
+			return fmt.Errorf("Signing key %s is not configured", activeID)
+		}
+		if active.PrivateKey == nil {
+			return fmt.Errorf("Signing key %s has no private key", activeID)
+		}
+	} else if len(keys) > 0 {
+		return errors.New("signingKey has to name the key new tokens are signed with")
+	}
+
+	signingKeys.Lock()
+	defer signingKeys.Unlock()
+	signingKeys.byID = byID
+	signingKeys.ordered = keys
+	signingKeys.active = active
+	return nil
+}
+
+func activeSigningKey() *SigningKey {
+	signingKeys.RLock()
+	defer signingKeys.RUnlock()
+	return signingKeys.active
+}
+
+func signingKeyByID(id string) *SigningKey {
+	signingKeys.RLock()
+	defer signingKeys.RUnlock()
+	return signingKeys.byID[id]
+}
+
+func hasSigningKeys() bool {
+	signingKeys.RLock()
+	defer signingKeys.RUnlock()
+	return len(signingKeys.ordered) > 0
+}
+
+// LoadSigningKey reads a PEM encoded key. The public key is derived from the
+// private key unless only the public key file is given.
+func LoadSigningKey(id, algorithm, privateKeyFile, publicKeyFile string) (*SigningKey, error) {
+	key := &SigningKey{ID: id}
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+	case jwt.SigningMethodES256.Alg():
+		key.Method = jwt.SigningMethodES256
+	case EdDSASigningMethod.Alg():
+		key.Method = EdDSASigningMethod
+	default:
+		return nil, fmt.Errorf("Signing key %s has unsupported algorithm %s", id, algorithm)
+	}
+
+	if privateKeyFile != "" {
+		block, err := readPEMFile(privateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the private key of %s: %v", id, err)
+		}
+		privateKey, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the private key of %s: %v", id, err)
+		}
+		key.PrivateKey = privateKey
+		key.PublicKey = privateKey.Public()
+	} else if publicKeyFile != "" {
+		block, err := readPEMFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the public key of %s: %v", id, err)
+		}
+		publicKey, err := parsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the public key of %s: %v", id, err)
+		}
+		key.PublicKey = publicKey
+	} else {
+		return nil, fmt.Errorf("Signing key %s needs a private or public key file", id)
+	}
+
+	if err := checkKeyAlgorithm(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readPEMFile(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return certificate.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func checkKeyAlgorithm(key *SigningKey) error {
+	matches := false
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		matches = key.Method == jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		matches = key.Method == jwt.SigningMethodES256 && publicKey.Curve == elliptic.P256()
+	case ed25519.PublicKey:
+		matches = key.Method == EdDSASigningMethod
+	}
+	if !matches {
+		return fmt.Errorf("Signing key %s doesn't match algorithm %s", key.ID, key.Method.Alg())
+	}
+	return nil
+}
+
+func (key *SigningKey) JSONWebKey() JSONWebKey {
+	webKey := JSONWebKey{ID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		webKey.KeyType = "RSA"
+		webKey.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		webKey.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		webKey.KeyType = "EC"
+		webKey.Curve = publicKey.Curve.Params().Name
+		webKey.X = base64.RawURLEncoding.EncodeToString(paddedBytes(publicKey.X, size))
+		webKey.Y = base64.RawURLEncoding.EncodeToString(paddedBytes(publicKey.Y, size))
+	case ed25519.PublicKey:
+		webKey.KeyType = "OKP"
+		webKey.Curve = "Ed25519"
+		webKey.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+	return webKey
+}
+
+func paddedBytes(value *big.Int, size int) []byte {
+	bytes := value.Bytes()
+	if len(bytes) >= size {
+		return bytes
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(bytes):], bytes)
+	return padded
+}
+
+// GetJSONWebKeySet returns the public keys of all the configured signing
+// keys, including the ones that only verify.
+func GetJSONWebKeySet() JSONWebKeySet {
+	signingKeys.RLock()
+	defer signingKeys.RUnlock()
+
+	keySet := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(signingKeys.ordered))}
+	for _, key := range signingKeys.ordered {
+		keySet.Keys = append(keySet.Keys, key.JSONWebKey())
+	}
+	return keySet
+}
@@ -0,0 +1,151 @@
+package services_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func writePrivateKey(t *testing.T, dir, name string, privateKey interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal("Failed to marshal the private key")
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal("Failed to write the private key")
+	}
+	return path
+}
+
+func loadTestKeys(t *testing.T) []*services.SigningKey {
+	dir, err := ioutil.TempDir("", "signing-keys")
+	if err != nil {
+		t.Fatal("Failed to create a temporary directory")
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	specs := []struct {
+		id, algorithm string
+		privateKey    interface{}
+	}{
+		{"rsa", "RS256", rsaKey},
+		{"ec", "ES256", ecKey},
+		{"ed", "EdDSA", edKey},
+	}
+	keys := make([]*services.SigningKey, 0, len(specs))
+	for _, spec := range specs {
+		key, err := services.LoadSigningKey(spec.id, spec.algorithm, writePrivateKey(t, dir, spec.id+".pem", spec.privateKey), "")
+		if err != nil {
+			t.Fatalf("LoadSigningKey returned error %s", err.Error())
+		}
+		keys = append(keys, key)
+	}
+	t.Cleanup(func() { services.SetSigningKeys(nil, "") })
+	return keys
+}
+
+func TestAccessTokenSignedWithEachAlgorithm(t *testing.T) {
+	keys := loadTestKeys(t)
+	for _, key := range keys {
+		if err := services.SetSigningKeys(keys, key.ID); err != nil {
+			t.Fatalf("SetSigningKeys returned error %s", err.Error())
+		}
+		tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+		if err != nil {
+			t.Fatalf("CreateAccessToken returned error %s", err.Error())
+		}
+		token, _, _ := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+		if token.Header["kid"] != key.ID || token.Method.Alg() != key.Method.Alg() {
+			t.Errorf("Token header %v doesn't match key %s", token.Header, key.ID)
+		}
+		accessToken, err := services.ParseAccessToken("Bearer " + tokenString)
+		if err != nil {
+			t.Fatalf("ParseAccessToken returned error %s for key %s", err.Error(), key.ID)
+		}
+		if accessToken.UserID != 1 {
+			t.Errorf("Returned ID %d does not match expected ID 1", accessToken.UserID)
+		}
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	keys := loadTestKeys(t)
+	config.Config.Jwt.SigningSecret = ""
+
+	services.SetSigningKeys(keys[:1], "rsa")
+	oldToken, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatalf("CreateAccessToken returned error %s", err.Error())
+	}
+
+	services.SetSigningKeys(keys[:2], "ec")
+	if _, err := services.ParseAccessToken("Bearer " + oldToken); err != nil {
+		t.Errorf("Token signed with the previous key was rejected: %s", err.Error())
+	}
+
+	services.SetSigningKeys(keys[1:2], "ec")
+	if _, err := services.ParseAccessToken("Bearer " + oldToken); err == nil {
+		t.Error("Token signed with a retired key was accepted")
+	}
+}
+
+func TestParseAccessTokenRejectsHMACWithoutSecret(t *testing.T) {
+	keys := loadTestKeys(t)
+	services.SetSigningKeys(keys, "rsa")
+	config.Config.Jwt.SigningSecret = ""
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": 1, "jti": "jti", "scope": "contacts:read", "exp": time.Now().Add(time.Minute).Unix()})
+	tokenString, _ := token.SignedString([]byte(""))
+	if _, err := services.ParseAccessToken("Bearer " + tokenString); err == nil {
+		t.Error("HMAC token was accepted without a signing secret")
+	}
+}
+
+func TestGetJSONWebKeySet(t *testing.T) {
+	keys := loadTestKeys(t)
+	services.SetSigningKeys(keys, "rsa")
+
+	keySet := services.GetJSONWebKeySet()
+	if len(keySet.Keys) != 3 {
+		t.Fatalf("Expected 3 keys, got %d", len(keySet.Keys))
+	}
+	expected := []struct{ kty, kid, alg, crv string }{
+		{"RSA", "rsa", "RS256", ""},
+		{"EC", "ec", "ES256", "P-256"},
+		{"OKP", "ed", "EdDSA", "Ed25519"},
+	}
+	for i, key := range keySet.Keys {
+		if key.KeyType != expected[i].kty || key.ID != expected[i].kid || key.Algorithm != expected[i].alg || key.Curve != expected[i].crv {
+			t.Errorf("Unexpected key %+v", key)
+		}
+	}
+	if keySet.Keys[0].N == "" || keySet.Keys[0].E != "AQAB" || len(keySet.Keys[1].X) != 43 || len(keySet.Keys[1].Y) != 43 {
+		t.Errorf("Unexpected key parameters %+v", keySet.Keys[:2])
+	}
+}
+
+func TestSetSigningKeysWithoutPrivateKey(t *testing.T) {
+	keys := loadTestKeys(t)
+	verifyOnly := &services.SigningKey{ID: "public", Method: keys[0].Method, PublicKey: keys[0].PublicKey}
+	if err := services.SetSigningKeys([]*services.SigningKey{verifyOnly}, "public"); err == nil {
+		t.Error("Verify-only key was accepted as the signing key")
+	}
+}
@@ -1,36 +1,316 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jafarlihi/addressbook/config"
 )
 
-func ParseAuthorizationHeader(header string) (uint32, error) {
+const (
+	defaultAccessTokenLifetime  = 15 * time.Minute
+	defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+
+	MFATokenLifetime = 5 * time.Minute
+	mfaTokenType     = "mfa_required"
+
+	ExportDownloadTokenLifetime = 15 * time.Minute
+	exportDownloadTokenType     = "export_download"
+
+	// RevokedAccessTokenSyncInterval is how often the access tokens revoked
+	// by other instances are loaded, so it's how long a logged out token can
+	// still be used on them.
+	RevokedAccessTokenSyncInterval = 5 * time.Second
+)
+
+// AccessToken holds the claims of a parsed access token. Family is the
+// refresh token family the access token was issued for.
+type AccessToken struct {
+	UserID    uint32
+	ID        string
+	Family    string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+var revokedAccessTokens = struct {
+	sync.RWMutex
+	expiry map[string]time.Time
+}{expiry: make(map[string]time.Time)}
+
+func AccessTokenLifetime() time.Duration {
+	return configuredLifetime(config.Config.Jwt.AccessTokenLifetime, defaultAccessTokenLifetime)
+}
+
+func RefreshTokenLifetime() time.Duration {
+	return configuredLifetime(config.Config.Jwt.RefreshTokenLifetime, defaultRefreshTokenLifetime)
+}
+
+func configuredLifetime(value string, fallback time.Duration) time.Duration {
+	if lifetime, err := time.ParseDuration(value); err == nil && lifetime > 0 {
+		return lifetime
+	}
+	return fallback
+}
+
+func randomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// NewTokenFamily returns the ID of a new refresh token family, which is
+// started by every login and shared by all the refresh tokens rotated from it.
+func NewTokenFamily() (string, error) {
+	return randomToken(16)
+}
+
+// NewRefreshToken returns a new opaque refresh token and the hash it's
+// stored under.
+func NewRefreshToken() (string, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAccessToken signs a short-lived access token for the user, granting
+// the given scopes.
+func CreateAccessToken(userID uint32, family string, scopes []string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return signToken(jwt.MapClaims{
+		"userID": userID,
+		"fam":    family,
+		"jti":    jti,
+		"scope":  strings.Join(scopes, " "),
+		"iat":    now.Unix(),
+		"exp":    now.Add(AccessTokenLifetime()).Unix(),
+	})
+}
+
+// CreateMFAToken signs the challenge token a user whose password has been
+// checked exchanges for an access token along with a second factor. It
+// carries the scopes the access token is going to be granted.
+func CreateMFAToken(userID uint32, scopes []string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return signToken(jwt.MapClaims{
+		"userID": userID,
+		"typ":    mfaTokenType,
+		"jti":    jti,
+		"scope":  strings.Join(scopes, " "),
+		"iat":    now.Unix(),
+		"exp":    now.Add(MFATokenLifetime).Unix(),
+	})
+}
+
+// CreateExportDownloadToken signs the token of a download link of an export
+// archive, it expires with the link or the archive, whichever comes first.
+func CreateExportDownloadToken(userID uint32, jobID uint32, archiveExpiresAt time.Time) (string, time.Time, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ExportDownloadTokenLifetime)
+	if archiveExpiresAt.Before(expiresAt) {
+		expiresAt = archiveExpiresAt
+	}
+	token, err := signToken(jwt.MapClaims{
+		"userID": userID,
+		"typ":    exportDownloadTokenType,
+		"job":    jobID,
+		"jti":    jti,
+		"iat":    now.Unix(),
+		"exp":    expiresAt.Unix(),
+	})
+	return token, expiresAt, err
+}
+
+// ParseExportDownloadToken validates a token created by
+// CreateExportDownloadToken, returning the ID of the export job it's for.
+func ParseExportDownloadToken(tokenString string) (uint32, error) {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	jobID, ok := token.claims["job"].(float64)
+	if token.claims["typ"] != exportDownloadTokenType || !ok {
+		return 0, errors.New("Invalid token")
+	}
+	return uint32(jobID), nil
+}
+
+func signToken(claims jwt.MapClaims) (string, error) {
+	if key := activeSigningKey(); key != nil {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.PrivateKey)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.Config.Jwt.SigningSecret))
+}
+
+// verificationKey picks the key a token is verified with by its kid header.
+// Tokens without a kid are HMAC tokens, which are only accepted while a
+// signing secret is configured or no asymmetric keys are.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok {
+		key := signingKeyByID(kid)
+		if key == nil {
+			return nil, fmt.Errorf("Unknown signing key: %v", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	if hasSigningKeys() && config.Config.Jwt.SigningSecret == "" {
+		return nil, errors.New("HMAC tokens aren't accepted")
+	}
+	return []byte(config.Config.Jwt.SigningSecret), nil
+}
+
+// ParseAccessToken validates the bearer token of an Authorization header,
+// rejecting tokens that have expired, lack an expiry, or have been revoked.
+// The verification key is picked by the kid header of the token.
+func ParseAccessToken(header string) (*AccessToken, error) {
 	tokenFields := strings.Fields(header)
 	if len(tokenFields) != 2 {
-		return 0, errors.New("Token is missing")
+		return nil, errors.New("Token is missing")
 	}
-	tokenString := tokenFields[1]
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	token, err := parseToken(tokenFields[1])
+	if err != nil {
+		return nil, err
+	}
+	// Challenge tokens are typed, access tokens aren't, and every access
+	// token carries its scopes.
+	if _, ok := token.claims["typ"]; ok {
+		return nil, errors.New("Invalid token")
+	}
+	if _, ok := token.claims["scope"].(string); !ok {
+		return nil, errors.New("Invalid token")
+	}
+	token.Family, _ = token.claims["fam"].(string)
+
+	if IsAccessTokenRevoked(token.ID) {
+		return nil, errors.New("Token has been revoked")
+	}
+	return &token.AccessToken, nil
+}
+
+// ParseMFAToken validates a challenge token created by CreateMFAToken.
+func ParseMFAToken(tokenString string) (*AccessToken, error) {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if token.claims["typ"] != mfaTokenType {
+		return nil, errors.New("Invalid token")
+	}
+	return &token.AccessToken, nil
+}
+
+type parsedToken struct {
+	AccessToken
+	claims jwt.MapClaims
+}
+
+func parseToken(tokenString string) (*parsedToken, error) {
+	token, err := jwt.Parse(tokenString, verificationKey)
+	if err != nil {
+		if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, errors.New("Token has expired")
 		}
-		return []byte(config.Config.Jwt.SigningSecret), nil
-	})
+		return nil, errors.New("Failed to parse the token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+	userID, userIDOk := claims["userID"].(float64)
+	expiresAt, expiresAtOk := claims["exp"].(float64)
+	jti, jtiOk := claims["jti"].(string)
+	if !userIDOk || !expiresAtOk || !jtiOk {
+		return nil, errors.New("Invalid token")
+	}
+	scope, _ := claims["scope"].(string)
+
+	return &parsedToken{
+		AccessToken: AccessToken{UserID: uint32(userID), ID: jti, Scopes: strings.Fields(scope), ExpiresAt: time.Unix(int64(expiresAt), 0)},
+		claims:      claims,
+	}, nil
+}
+
+func ParseAuthorizationHeader(header string) (uint32, error) {
+	token, err := ParseAccessToken(header)
 	if err != nil {
-		return 0, errors.New("Failed to parse the token")
+		return 0, err
 	}
+	return token.UserID, nil
+}
 
-	var userID float64
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID = claims["userID"].(float64)
-	} else {
-		return 0, errors.New("Invalid token")
+// RevokeAccessToken makes the auth decorators reject the access token until
+// it expires. Revocations are kept in memory and have to be persisted by the
+// caller, the server loads the persisted ones every
+// RevokedAccessTokenSyncInterval to pick up those of other instances.
+func RevokeAccessToken(jti string, expiresAt time.Time) {
+	RevokeAccessTokens(map[string]time.Time{jti: expiresAt})
+}
+
+// RevokeAccessTokens revokes the access tokens mapped from their jti to
+// their expiry, and forgets the revoked tokens that have expired.
+func RevokeAccessTokens(tokens map[string]time.Time) {
+	revokedAccessTokens.Lock()
+	defer revokedAccessTokens.Unlock()
+
+	now := time.Now()
+	for revokedJTI, expiry := range revokedAccessTokens.expiry {
+		if expiry.Before(now) {
+			delete(revokedAccessTokens.expiry, revokedJTI)
+		}
 	}
-	return uint32(userID), nil
+	for jti, expiresAt := range tokens {
+		revokedAccessTokens.expiry[jti] = expiresAt
+	}
+}
+
+func IsAccessTokenRevoked(jti string) bool {
+	revokedAccessTokens.RLock()
+	defer revokedAccessTokens.RUnlock()
+	_, revoked := revokedAccessTokens.expiry[jti]
+	return revoked
 }
@@ -1,7 +1,9 @@
 package services_test
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jafarlihi/addressbook/config"
@@ -17,6 +19,9 @@ func TestParseAuthorizationHeader(t *testing.T) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": id,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(time.Minute).Unix(),
 	})
 	tokenString, err := token.SignedString([]byte(jwtSecret))
 	if err != nil {
@@ -34,3 +39,137 @@ func TestParseAuthorizationHeader(t *testing.T) {
 		t.Errorf("Returned ID %d does not match expected ID %d", returnedID, id)
 	}
 }
+
+func TestParseAuthorizationHeaderWithExpiredToken(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": 1,
+		"jti":    "jti",
+		"scope":  strings.Join(services.AllScopes, " "),
+		"exp":    time.Now().Add(-time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	_, err = services.ParseAuthorizationHeader("Bearer " + tokenString)
+	if err == nil || err.Error() != "Token has expired" {
+		t.Errorf("ParseAuthorizationHeader returned unexpected error %v", err)
+	}
+}
+
+func TestParseAuthorizationHeaderWithoutExpiry(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": 1,
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	_, err = services.ParseAuthorizationHeader("Bearer " + tokenString)
+	if err == nil || err.Error() != "Invalid token" {
+		t.Errorf("ParseAuthorizationHeader returned unexpected error %v", err)
+	}
+}
+
+func TestParseAuthorizationHeaderWithoutScope(t *testing.T) {
+	jwtSecret := "secret"
+	config.Config.Jwt.SigningSecret = jwtSecret
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": 1,
+		"jti":    "jti",
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	_, err = services.ParseAuthorizationHeader("Bearer " + tokenString)
+	if err == nil || err.Error() != "Invalid token" {
+		t.Errorf("ParseAuthorizationHeader returned unexpected error %v", err)
+	}
+}
+
+func TestParseAccessTokenRevoked(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+
+	token, err := services.ParseAccessToken("Bearer " + tokenString)
+	if err != nil {
+		t.Fatalf("ParseAccessToken returned error %s", err.Error())
+	}
+	if token.UserID != 1 || token.Family != "family" || token.ID == "" || time.Until(token.ExpiresAt) > services.AccessTokenLifetime() {
+		t.Errorf("Returned token %+v does not match the expectations", token)
+	}
+
+	services.RevokeAccessToken(token.ID, token.ExpiresAt)
+	_, err = services.ParseAccessToken("Bearer " + tokenString)
+	if err == nil || err.Error() != "Token has been revoked" {
+		t.Errorf("ParseAccessToken returned unexpected error %v", err)
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := services.NormalizeScopes(nil)
+	if err != nil || len(scopes) != len(services.AllScopes) {
+		t.Errorf("NormalizeScopes didn't default to all scopes: %v, %v", scopes, err)
+	}
+
+	scopes, err = services.NormalizeScopes([]string{"lists:read", "lists:read"})
+	if err != nil || len(scopes) != 1 {
+		t.Errorf("NormalizeScopes didn't drop duplicates: %v, %v", scopes, err)
+	}
+
+	if _, err := services.NormalizeScopes([]string{"admin"}); err == nil {
+		t.Error("NormalizeScopes accepted an unknown scope")
+	}
+}
+
+func TestMissingScope(t *testing.T) {
+	granted := []string{services.ScopeListsRead, services.ScopeContactsRead}
+	if missing := services.MissingScope(granted, []string{services.ScopeListsRead, services.ScopeContactsRead}); missing != "" {
+		t.Errorf("MissingScope returned %s for granted scopes", missing)
+	}
+	if missing := services.MissingScope(granted, []string{services.ScopeListsWrite}); missing != services.ScopeListsWrite {
+		t.Errorf("MissingScope returned %s instead of lists:write", missing)
+	}
+}
+
+func TestRevokeAccessTokens(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateAccessToken(1, "family", services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create JWT token")
+	}
+	token, err := services.ParseAccessToken("Bearer " + tokenString)
+	if err != nil {
+		t.Fatalf("ParseAccessToken returned error %s", err.Error())
+	}
+
+	services.RevokeAccessTokens(map[string]time.Time{
+		token.ID:  token.ExpiresAt,
+		"expired": time.Now().Add(-time.Minute),
+	})
+	if !services.IsAccessTokenRevoked(token.ID) {
+		t.Error("Token revoked by another instance wasn't rejected")
+	}
+
+	services.RevokeAccessTokens(nil)
+	if services.IsAccessTokenRevoked("expired") {
+		t.Error("Expired revocation wasn't forgotten")
+	}
+}
@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+// RFC 6238 test secret "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := services.TOTPCode(rfcSecret, services.TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode returned error %s", err.Error())
+		}
+		if code != expected {
+			t.Errorf("TOTPCode at %d returned %s, expected %s", unix, code, expected)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	previous, _ := services.TOTPCode(rfcSecret, services.TOTPStep(now)-1)
+	if step, ok := services.VerifyTOTP(rfcSecret, previous, now); !ok || step != services.TOTPStep(now)-1 {
+		t.Errorf("VerifyTOTP rejected the code of the previous step")
+	}
+
+	stale, _ := services.TOTPCode(rfcSecret, services.TOTPStep(now)-2)
+	if _, ok := services.VerifyTOTP(rfcSecret, stale, now); ok {
+		t.Errorf("VerifyTOTP accepted a stale code")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := services.NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes returned error %s", err.Error())
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(codes))
+	}
+	if services.HashRecoveryCode(" "+codes[0][:4]+codes[0][5:]+" ") != hashes[0] {
+		t.Errorf("HashRecoveryCode doesn't ignore dashes and spaces")
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	config.Config.Jwt.SigningSecret = "secret"
+
+	tokenString, err := services.CreateMFAToken(1, services.AllScopes)
+	if err != nil {
+		t.Fatal("Failed to create MFA token")
+	}
+
+	if _, err := services.ParseAccessToken("Bearer " + tokenString); err == nil {
+		t.Error("MFA token was accepted as an access token")
+	}
+	token, err := services.ParseMFAToken(tokenString)
+	if err != nil || token.UserID != 1 {
+		t.Errorf("ParseMFAToken failed: %v", err)
+	}
+
+	accessToken, _ := services.CreateAccessToken(1, "family", services.AllScopes)
+	if _, err := services.ParseMFAToken(accessToken); err == nil {
+		t.Error("Access token was accepted as an MFA token")
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/config"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/models"
+)
+
+const (
+	PasswordResetTokenLifetime     = time.Hour
+	EmailVerificationTokenLifetime = 48 * time.Hour
+)
+
+// NewUserToken returns a new single-use token to be emailed to the user for
+// the purpose, and the UserToken it's stored as.
+func NewUserToken(userID uint32, purpose string) (string, *models.UserToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	lifetime := EmailVerificationTokenLifetime
+	if purpose == models.UserTokenPasswordReset {
+		lifetime = PasswordResetTokenLifetime
+	}
+	return token, &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashUserToken(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+func HashUserToken(token string) string {
+	return hashToken(token)
+}
+
+// UserTokenMessage composes the email a user token is sent in, linking to the
+// configured URL if there is one.
+func UserTokenMessage(email string, purpose string, token string) *mailer.Message {
+	if purpose == models.UserTokenPasswordReset {
+		return &mailer.Message{
+			To:      email,
+			Subject: "Reset your addressbook password",
+			Body: "Someone, hopefully you, asked to reset the password of your addressbook account.\r\n\r\n" +
+				userTokenInstructions(config.Config.Mail.PasswordResetUrl, "/api/user/password/reset", token) +
+				"\r\nThe token expires in an hour. If you didn't ask for this you can ignore this email.\r\n",
+		}
+	}
+	return &mailer.Message{
+		To:      email,
+		Subject: "Verify your addressbook email address",
+		Body: "Please verify the email address of your addressbook account.\r\n\r\n" +
+			userTokenInstructions(config.Config.Mail.EmailVerificationUrl, "/api/user/email/verify", token) +
+			"\r\nThe token expires in 48 hours.\r\n",
+	}
+}
+
+func userTokenInstructions(url string, endpoint string, token string) string {
+	if url != "" {
+		return "Open " + strings.Replace(url, "{token}", token, -1) + " to continue.\r\n"
+	}
+	return "POST the following token as \"token\" to " + endpoint + " to continue:\r\n\r\n" + token + "\r\n"
+}
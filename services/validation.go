@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jafarlihi/addressbook/models"
+)
+
+var emailRegexp = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+var phoneNumberRegexp = regexp.MustCompile(`^\+?[0-9()\-. ]{3,}$`)
+var birthdayRegexp = regexp.MustCompile(`^([0-9]{4}-|--)[0-9]{2}-[0-9]{2}$`)
+
+var phoneNumberLabels = map[string]bool{"mobile": true, "work": true, "home": true}
+
+const minPasswordLength = 6
+
+func IsEmailValid(email string) bool {
+	return emailRegexp.MatchString(email)
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("Password length can't be smaller than " + strconv.Itoa(minPasswordLength))
+	}
+	return nil
+}
+
+// ValidateNewUser runs the validation users signing up and users created by
+// the CLI have to pass.
+func ValidateNewUser(username string, email string, password string) error {
+	if username == "" || email == "" || password == "" {
+		return errors.New("Username, email, or password field(s) is/are missing")
+	}
+	if !IsEmailValid(email) {
+		return errors.New("Provided email address is malformed")
+	}
+	return ValidatePassword(password)
+}
+
+func IsColorValid(color string) bool {
+	return color == "" || colorRegexp.MatchString(color)
+}
+
+// NormalizeContactEmails keeps the contact's email field and its list of
+// emails in sync. A contact with only the email field set gets it as its
+// single primary email, otherwise the email field is set to the address
+// marked as primary, or to the first one if none is marked.
+func NormalizeContactEmails(contact *models.Contact) error {
+	if len(contact.Emails) == 0 {
+		if contact.Email != "" {
+			contact.Emails = []*models.EmailAddress{{Address: contact.Email, Primary: true}}
+		}
+		return nil
+	}
+
+	var primary *models.EmailAddress
+	for _, email := range contact.Emails {
+		if email == nil {
+			return errors.New("Emails can't contain null entries")
+		}
+		if email.Primary {
+			if primary != nil {
+				return errors.New("Only one email can be marked as primary")
+			}
+			primary = email
+		}
+	}
+	if primary == nil {
+		primary = contact.Emails[0]
+		primary.Primary = true
+	}
+	contact.Email = primary.Address
+	return nil
+}
+
+// ValidateContact runs the validation every new or fully replaced contact
+// has to pass, apart from the custom fields which are checked separately by
+// ValidateCustomFieldValues as they depend on the owner's definitions.
+func ValidateContact(contact *models.Contact) error {
+	err := NormalizeContactEmails(contact)
+	if err != nil {
+		return err
+	}
+	if contact.Name == "" || contact.Surname == "" || contact.Email == "" {
+		return errors.New("Name, surname, and/or email field(s) is/are missing")
+	}
+	return ValidateContactDetails(contact)
+}
+
+func ValidateContactDetails(contact *models.Contact) error {
+	for _, email := range contact.Emails {
+		if !IsEmailValid(email.Address) {
+			return errors.New("Provided email address is malformed")
+		}
+	}
+	for _, phoneNumber := range contact.PhoneNumbers {
+		if phoneNumber == nil || !phoneNumberRegexp.MatchString(phoneNumber.Number) {
+			return errors.New("Provided phone number is malformed")
+		}
+		if !phoneNumberLabels[phoneNumber.Label] {
+			return errors.New("Phone number label has to be one of mobile, work, or home")
+		}
+	}
+	if contact.Birthday != "" && !birthdayRegexp.MatchString(contact.Birthday) {
+		return errors.New("Birthday has to be in YYYY-MM-DD or --MM-DD format")
+	}
+	for _, address := range contact.Addresses {
+		if address == nil || address.Street == "" && address.City == "" && address.Region == "" && address.Postcode == "" && address.Country == "" {
+			return errors.New("Postal addresses can't be empty")
+		}
+	}
+	return nil
+}
+
+// ValidateCustomFieldValues checks the custom field values of the contact
+// against their definitions. Values set to null are dropped.
+func ValidateCustomFieldValues(contact *models.Contact, customFields []*models.CustomField) error {
+	if contact.CustomFields == nil {
+		contact.CustomFields = make(map[string]interface{})
+	}
+	definitions := make(map[string]*models.CustomField, len(customFields))
+	for _, field := range customFields {
+		definitions[field.Name] = field
+	}
+
+	for name, value := range contact.CustomFields {
+		if value == nil {
+			delete(contact.CustomFields, name)
+			continue
+		}
+		field, ok := definitions[name]
+		if !ok {
+			return errors.New("Unknown custom field " + name)
+		}
+		if err := ValidateCustomFieldValue(field, value); err != nil {
+			return err
+		}
+	}
+	for _, field := range customFields {
+		if value, ok := contact.CustomFields[field.Name]; field.Required && (!ok || value == "") {
+			return errors.New("Custom field " + field.Name + " is required")
+		}
+	}
+	return nil
+}
+
+func ValidateCustomFieldValue(field *models.CustomField, value interface{}) error {
+	switch field.Type {
+	case models.CustomFieldNumber:
+		if _, ok := value.(float64); !ok {
+			return errors.New("Custom field " + field.Name + " has to be a number")
+		}
+	case models.CustomFieldBool:
+		if _, ok := value.(bool); !ok {
+			return errors.New("Custom field " + field.Name + " has to be a boolean")
+		}
+	case models.CustomFieldDate:
+		date, ok := value.(string)
+		if _, err := time.Parse("2006-01-02", date); !ok || err != nil {
+			return errors.New("Custom field " + field.Name + " has to be a date in YYYY-MM-DD format")
+		}
+	case models.CustomFieldEnum:
+		option, ok := value.(string)
+		if !ok || !containsString(field.Options, option) {
+			return errors.New("Custom field " + field.Name + " has to be one of " + strings.Join(field.Options, ", "))
+		}
+	default:
+		if _, ok := value.(string); !ok {
+			return errors.New("Custom field " + field.Name + " has to be a string")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestValidateNewUser(t *testing.T) {
+	tests := []struct {
+		username, email, password string
+		expected                  string
+	}{
+		{"user", "valid@mail.com", "password", ""},
+		{"", "valid@mail.com", "password", "Username, email, or password field(s) is/are missing"},
+		{"user", "invalid", "password", "Provided email address is malformed"},
+		{"user", "valid@mail.com", "short", "Password length can't be smaller than 6"},
+	}
+
+	for _, test := range tests {
+		err := services.ValidateNewUser(test.username, test.email, test.password)
+		if test.expected == "" && err != nil {
+			t.Errorf("ValidateNewUser(%q, %q, %q) returned unexpected error %v", test.username, test.email, test.password, err)
+		}
+		if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("ValidateNewUser(%q, %q, %q) = %v, want %v", test.username, test.email, test.password, err, test.expected)
+		}
+	}
+}
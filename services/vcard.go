@@ -0,0 +1,409 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jafarlihi/addressbook/models"
+)
+
+// ParsedVCard is a single card of an imported vCard file. Index is the
+// 1-based position of the card in the file and Err is set if the card
+// couldn't be mapped onto a contact.
+type ParsedVCard struct {
+	Index   int
+	Contact *models.Contact
+	Err     error
+}
+
+type vcardProperty struct {
+	group  string
+	name   string
+	params map[string][]string
+	value  string
+	raw    string
+}
+
+var vcardBirthdayRegexp = regexp.MustCompile(`^([0-9]{4}|--)-?([0-9]{2})-?([0-9]{2})`)
+
+// ParseVCards reads all cards of a vCard 3.0 or 4.0 file.
+func ParseVCards(r io.Reader) ([]*ParsedVCard, error) {
+	lines, err := unfoldVCardLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]*ParsedVCard, 0)
+	var properties []*vcardProperty
+	inCard := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// Malformed lines are dropped, keeping them would make the
+		// exported cards invalid.
+		property, err := parseVCardProperty(line)
+		if err != nil {
+			continue
+		}
+		switch {
+		case property.name == "BEGIN" && strings.EqualFold(property.value, "VCARD"):
+			if inCard {
+				cards = append(cards, &ParsedVCard{Index: len(cards) + 1, Err: errors.New("Card is missing END:VCARD")})
+			}
+			inCard = true
+			properties = nil
+		case property.name == "END" && strings.EqualFold(property.value, "VCARD"):
+			if inCard {
+				contact, err := vcardToContact(properties)
+				cards = append(cards, &ParsedVCard{Index: len(cards) + 1, Contact: contact, Err: err})
+			}
+			inCard = false
+		case inCard:
+			properties = append(properties, property)
+		}
+	}
+	if inCard {
+		cards = append(cards, &ParsedVCard{Index: len(cards) + 1, Err: errors.New("Card is missing END:VCARD")})
+	}
+	return cards, nil
+}
+
+func unfoldVCardLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lines := make([]string, 0)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func parseVCardProperty(line string) (*vcardProperty, error) {
+	colon := -1
+	quoted := false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return nil, fmt.Errorf("Malformed vCard line: %s", line)
+	}
+
+	property := &vcardProperty{params: make(map[string][]string), value: line[colon+1:], raw: line}
+	parts := splitVCardParams(line[:colon])
+	name := parts[0]
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		property.group = strings.ToUpper(name[:dot])
+		name = name[dot+1:]
+	}
+	property.name = strings.ToUpper(name)
+
+	for _, param := range parts[1:] {
+		key, value := "TYPE", param
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key, value = param[:eq], param[eq+1:]
+		}
+		key = strings.ToUpper(key)
+		for _, v := range strings.Split(value, ",") {
+			property.params[key] = append(property.params[key], strings.Trim(v, `"`))
+		}
+	}
+	return property, nil
+}
+
+func splitVCardParams(s string) []string {
+	parts := make([]string, 0)
+	quoted := false
+	start := 0
+	for i, c := range s {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ';' && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func (p *vcardProperty) hasType(types ...string) bool {
+	for _, t := range p.params["TYPE"] {
+		for _, expected := range types {
+			if strings.EqualFold(t, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *vcardProperty) isPreferred() bool {
+	_, pref := p.params["PREF"]
+	return pref || p.hasType("pref")
+}
+
+func (p *vcardProperty) label(known ...string) string {
+	for _, t := range p.params["TYPE"] {
+		for _, label := range known {
+			if strings.EqualFold(t, label) {
+				return label
+			}
+		}
+	}
+	return ""
+}
+
+func vcardToContact(properties []*vcardProperty) (*models.Contact, error) {
+	contact := &models.Contact{
+		PhoneNumbers: make([]*models.PhoneNumber, 0),
+		Emails:       make([]*models.EmailAddress, 0),
+		Addresses:    make([]*models.PostalAddress, 0),
+	}
+	var formattedName string
+	extra := make([]*vcardProperty, 0)
+	mappedGroups := make(map[string]bool)
+	hasPrimaryEmail := false
+
+	for _, property := range properties {
+		switch property.name {
+		case "VERSION", "PRODID":
+		case "FN":
+			formattedName = strings.TrimSpace(unescapeVCardText(property.value))
+		case "N":
+			fields := splitVCardCompound(property.value)
+			contact.Surname = fields[0]
+			if len(fields) > 1 {
+				contact.Name = fields[1]
+			}
+		case "EMAIL":
+			email := &models.EmailAddress{
+				Label:   property.label("work", "home"),
+				Address: strings.ToLower(strings.TrimPrefix(unescapeVCardText(property.value), "mailto:")),
+			}
+			if property.isPreferred() && !hasPrimaryEmail {
+				email.Primary = true
+				hasPrimaryEmail = true
+			}
+			contact.Emails = append(contact.Emails, email)
+		case "TEL":
+			label := "mobile"
+			if property.hasType("work") {
+				label = "work"
+			} else if property.hasType("home") && !property.hasType("cell", "mobile") {
+				label = "home"
+			}
+			contact.PhoneNumbers = append(contact.PhoneNumbers, &models.PhoneNumber{
+				Label:  label,
+				Number: strings.TrimPrefix(unescapeVCardText(property.value), "tel:"),
+			})
+		case "ADR":
+			fields := splitVCardCompound(property.value)
+			for len(fields) < 7 {
+				fields = append(fields, "")
+			}
+			streetParts := make([]string, 0)
+			for _, part := range fields[:3] {
+				if part != "" {
+					streetParts = append(streetParts, part)
+				}
+			}
+			contact.Addresses = append(contact.Addresses, &models.PostalAddress{
+				Label:    property.label("work", "home"),
+				Street:   strings.Join(streetParts, ", "),
+				City:     fields[3],
+				Region:   fields[4],
+				Postcode: fields[5],
+				Country:  fields[6],
+			})
+		case "NOTE":
+			contact.Notes = unescapeVCardText(property.value)
+		case "BDAY":
+			match := vcardBirthdayRegexp.FindStringSubmatch(property.value)
+			if match == nil {
+				return nil, fmt.Errorf("Unsupported BDAY value: %s", property.value)
+			}
+			if match[1] == "--" {
+				contact.Birthday = "--" + match[2] + "-" + match[3]
+			} else {
+				contact.Birthday = match[1] + "-" + match[2] + "-" + match[3]
+			}
+		default:
+			extra = append(extra, property)
+			continue
+		}
+		if property.group != "" {
+			mappedGroups[property.group] = true
+		}
+	}
+
+	if contact.Name == "" && contact.Surname == "" && formattedName != "" {
+		fields := strings.Fields(formattedName)
+		contact.Name = strings.Join(fields[:len(fields)-1], " ")
+		contact.Surname = fields[len(fields)-1]
+		if contact.Name == "" {
+			contact.Name, contact.Surname = contact.Surname, ""
+		}
+	}
+	if contact.Name == "" && contact.Surname == "" {
+		return nil, errors.New("Card has neither N nor FN property")
+	}
+	// Properties grouped with a mapped one, like the X-ABLabel of an
+	// item1.EMAIL, describe a property that is written back without its group.
+	extraLines := make([]string, 0, len(extra))
+	for _, property := range extra {
+		if !mappedGroups[property.group] {
+			extraLines = append(extraLines, property.raw)
+		}
+	}
+	contact.VCardExtra = strings.Join(extraLines, "\r\n")
+	return contact, nil
+}
+
+func splitVCardCompound(value string) []string {
+	fields := make([]string, 0)
+	var field strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			field.WriteByte(value[i])
+			field.WriteByte(value[i+1])
+			i++
+		} else if value[i] == ';' {
+			fields = append(fields, unescapeVCardText(field.String()))
+			field.Reset()
+		} else {
+			field.WriteByte(value[i])
+		}
+	}
+	return append(fields, unescapeVCardText(field.String()))
+}
+
+func unescapeVCardText(value string) string {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n', 'N':
+				result.WriteByte('\n')
+			default:
+				result.WriteByte(value[i])
+			}
+		} else {
+			result.WriteByte(value[i])
+		}
+	}
+	return result.String()
+}
+
+func escapeVCardText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(value)
+}
+
+// WriteVCard writes the contact as a single vCard of the given version,
+// which has to be either "3.0" or "4.0".
+func WriteVCard(w io.Writer, contact *models.Contact, version string) error {
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:" + version,
+		"PRODID:-//addressbook//EN",
+		"FN:" + escapeVCardText(strings.TrimSpace(contact.Name+" "+contact.Surname)),
+		"N:" + escapeVCardText(contact.Surname) + ";" + escapeVCardText(contact.Name) + ";;;",
+	}
+
+	for _, email := range contact.Emails {
+		lines = append(lines, "EMAIL"+vcardTypeParams(version, email.Label, email.Primary, "INTERNET")+":"+email.Address)
+	}
+	for _, phoneNumber := range contact.PhoneNumbers {
+		label := phoneNumber.Label
+		if label == "mobile" {
+			label = "cell"
+		}
+		lines = append(lines, "TEL"+vcardTypeParams(version, label, false, "VOICE")+":"+escapeVCardText(phoneNumber.Number))
+	}
+	for _, address := range contact.Addresses {
+		fields := []string{"", "", address.Street, address.City, address.Region, address.Postcode, address.Country}
+		for i := range fields {
+			fields[i] = escapeVCardText(fields[i])
+		}
+		lines = append(lines, "ADR"+vcardTypeParams(version, address.Label, false, "")+":"+strings.Join(fields, ";"))
+	}
+	if contact.Notes != "" {
+		lines = append(lines, "NOTE:"+escapeVCardText(contact.Notes))
+	}
+	if contact.Birthday != "" {
+		lines = append(lines, "BDAY:"+contact.Birthday)
+	}
+	if contact.VCardExtra != "" {
+		lines = append(lines, strings.Split(contact.VCardExtra, "\r\n")...)
+	}
+	lines = append(lines, "END:VCARD")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldVCardLine(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func vcardTypeParams(version string, label string, preferred bool, version3Type string) string {
+	if version == "4.0" {
+		params := ""
+		if label != "" {
+			params += ";TYPE=" + label
+		}
+		if preferred {
+			params += ";PREF=1"
+		}
+		return params
+	}
+
+	types := make([]string, 0)
+	if version3Type != "" {
+		types = append(types, version3Type)
+	}
+	if label != "" {
+		types = append(types, strings.ToUpper(label))
+	}
+	if preferred {
+		types = append(types, "PREF")
+	}
+	if len(types) == 0 {
+		return ""
+	}
+	return ";TYPE=" + strings.Join(types, ",")
+}
+
+// foldVCardLine folds lines longer than 75 octets without splitting UTF-8
+// sequences, as required by RFC 6350.
+func foldVCardLine(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+	return folded.String()
+}
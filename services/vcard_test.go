@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/services"
+)
+
+func TestParseVCards(t *testing.T) {
+	vcf := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"FN:John Doe\r\n" +
+		"N:Doe;John;;;\r\n" +
+		"EMAIL;TYPE=INTERNET,WORK:john@work.com\r\n" +
+		"EMAIL;TYPE=INTERNET,HOME,PREF:john@home.com\r\n" +
+		"TEL;TYPE=CELL:+1 555 0100\r\n" +
+		"ADR;TYPE=HOME:;;Main Street 1;Springfield;IL;62701;USA\r\n" +
+		"NOTE:Met at the\\nconference\\, 2019\r\n" +
+		"BDAY:19800102\r\n" +
+		"X-CUSTOM;TYPE=a:some value that is long enough to be folded over more than a singl\r\n" +
+		" e line\r\n" +
+		"this line is malformed\r\n" +
+		"item1.EMAIL:john@other.com\r\n" +
+		"item1.X-ABLabel:Other\r\n" +
+		"item2.X-ABRELATEDNAMES:Jane Doe\r\n" +
+		"item2.X-ABLabel:_$!<Spouse>!$_\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"EMAIL:nobody@mail.com\r\n" +
+		"END:VCARD\r\n"
+
+	cards, err := services.ParseVCards(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatalf("ParseVCards returned error %s", err.Error())
+	}
+
+	if len(cards) != 2 {
+		t.Fatalf("ParseVCards returned %d cards, expected 2", len(cards))
+	}
+
+	contact := cards[0].Contact
+	if cards[0].Err != nil || contact.Name != "John" || contact.Surname != "Doe" || contact.Notes != "Met at the\nconference, 2019" || contact.Birthday != "1980-01-02" {
+		t.Errorf("First card was not parsed as expected: %+v", contact)
+	}
+
+	if len(contact.Emails) != 3 || contact.Emails[0].Label != "work" || contact.Emails[0].Primary || !contact.Emails[1].Primary {
+		t.Errorf("Emails of first card were not parsed as expected")
+	}
+
+	if len(contact.PhoneNumbers) != 1 || contact.PhoneNumbers[0].Label != "mobile" || contact.PhoneNumbers[0].Number != "+1 555 0100" {
+		t.Errorf("Phone numbers of first card were not parsed as expected")
+	}
+
+	if len(contact.Addresses) != 1 || contact.Addresses[0].Street != "Main Street 1" || contact.Addresses[0].Postcode != "62701" || contact.Addresses[0].Country != "USA" {
+		t.Errorf("Addresses of first card were not parsed as expected")
+	}
+
+	if contact.VCardExtra != "X-CUSTOM;TYPE=a:some value that is long enough to be folded over more than a single line\r\n"+
+		"item2.X-ABRELATEDNAMES:Jane Doe\r\nitem2.X-ABLabel:_$!<Spouse>!$_" {
+		t.Errorf("Unknown properties of first card were not kept, got %q", contact.VCardExtra)
+	}
+
+	if cards[1].Err == nil || cards[1].Index != 2 {
+		t.Errorf("Second card without a name was expected to fail")
+	}
+}
+
+func TestWriteVCardRoundTrip(t *testing.T) {
+	contact := &models.Contact{
+		Name:         "Jane",
+		Surname:      "Roe; Jr.",
+		Email:        "jane@mail.com",
+		PhoneNumbers: []*models.PhoneNumber{{Label: "work", Number: "555 0101"}},
+		Emails:       []*models.EmailAddress{{Address: "jane@mail.com", Primary: true}},
+		Addresses:    []*models.PostalAddress{{Label: "work", Street: "Office Road 2", City: "Town", Country: "Country"}},
+		Notes:        "Likes tea",
+		Birthday:     "--03-04",
+		VCardExtra:   "X-CUSTOM:value",
+	}
+
+	for _, version := range []string{"3.0", "4.0"} {
+		var buffer bytes.Buffer
+		err := services.WriteVCard(&buffer, contact, version)
+		if err != nil {
+			t.Fatalf("WriteVCard returned error %s", err.Error())
+		}
+
+		cards, err := services.ParseVCards(&buffer)
+		if err != nil || len(cards) != 1 || cards[0].Err != nil {
+			t.Fatalf("Written vCard %s couldn't be parsed back", version)
+		}
+
+		parsed := cards[0].Contact
+		if parsed.Name != contact.Name || parsed.Surname != contact.Surname || parsed.Notes != contact.Notes || parsed.Birthday != contact.Birthday || parsed.VCardExtra != contact.VCardExtra {
+			t.Errorf("vCard %s round-trip changed the contact: %+v", version, parsed)
+		}
+
+		if len(parsed.Emails) != 1 || !parsed.Emails[0].Primary || len(parsed.PhoneNumbers) != 1 || parsed.PhoneNumbers[0].Label != "work" || len(parsed.Addresses) != 1 || parsed.Addresses[0].City != "Town" {
+			t.Errorf("vCard %s round-trip changed the contact details", version)
+		}
+	}
+}
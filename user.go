@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jafarlihi/addressbook/database"
+	"github.com/jafarlihi/addressbook/mailer"
+	"github.com/jafarlihi/addressbook/models"
+	"github.com/jafarlihi/addressbook/repositories"
+	"github.com/jafarlihi/addressbook/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runUser(args []string) int {
+	if len(args) == 0 {
+		return commandUsage("user")
+	}
+
+	switch args[0] {
+	case "create":
+		return createUser(args[1:])
+	case "list":
+		return listUsers(args[1:])
+	case "disable":
+		return setUserDisabled(args[1:], true)
+	case "enable":
+		return setUserDisabled(args[1:], false)
+	case "reset-password":
+		return resetPassword(args[1:])
+	}
+	return commandUsage("user")
+}
+
+// findUser looks the user up by ID, username, or email.
+func findUser(ref string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if id, parseErr := strconv.ParseUint(ref, 10, 32); parseErr == nil {
+		user, err = repositories.GetUser(database.Database, uint32(id))
+	} else if strings.Contains(ref, "@") {
+		user, err = repositories.GetUserByEmail(database.Database, ref)
+	} else {
+		user, err = repositories.GetUserByUsername(database.Database, ref)
+	}
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("User %s does not exist", ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the user, error: %s", err)
+	}
+	return user, nil
+}
+
+// readPassword reads the first line of the standard input, prompting for it
+// if the input is a terminal. The password is echoed, so pipe it in when
+// that matters.
+func readPassword() (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func createUser(args []string) int {
+	flags := newFlagSet("user create")
+	username := flags.String("username", "", "username of the user")
+	email := flags.String("email", "", "email address of the user")
+	verified := flags.Bool("verified", false, "mark the email address as verified instead of sending a verification email")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		return commandUsage("user")
+	}
+
+	database.InitDatabase()
+	password, err := readPassword()
+	if err != nil {
+		return fail("Failed to read the password, error: " + err.Error())
+	}
+
+	err = services.ValidateNewUser(*username, *email, password)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fail("Failed to hash the password")
+	}
+
+	id, err := repositories.CreateUser(database.Database, *username, *email, string(passwordHash))
+	if err != nil {
+		return fail(err.Error())
+	}
+	fmt.Printf("Created user %d\n", id)
+
+	if *verified {
+		err = repositories.SetUserEmailVerified(database.Database, uint32(id))
+		if err != nil {
+			return fail("Failed to mark the email address as verified")
+		}
+		return 0
+	}
+
+	mailer.InitMailer()
+	token, userToken, err := services.NewUserToken(uint32(id), models.UserTokenEmailVerification)
+	if err == nil {
+		err = repositories.CreateUserToken(database.Database, userToken)
+	}
+	if err == nil {
+		err = mailer.Default.Send(services.UserTokenMessage(*email, models.UserTokenEmailVerification, token))
+	}
+	if err != nil {
+		return fail("Failed to send the verification email, error: " + err.Error())
+	}
+	return 0
+}
+
+type listedUser struct {
+	ID                  uint32     `json:"id"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"emailVerified"`
+	Disabled            bool       `json:"disabled"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+}
+
+func listUsers(args []string) int {
+	flags := newFlagSet("user list")
+	asJSON := flags.Bool("json", false, "print the users as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		return commandUsage("user")
+	}
+
+	database.InitDatabase()
+	users, err := repositories.GetUsers(database.Database)
+	if err != nil {
+		return fail("Failed to get the users")
+	}
+
+	if *asJSON {
+		listed := make([]*listedUser, 0, len(users))
+		for _, user := range users {
+			listed = append(listed, &listedUser{user.ID, user.Username, user.Email, user.EmailVerified, user.Disabled, user.DeletionScheduledAt})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(listed); err != nil {
+			return fail("Failed to marshal the users to JSON")
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tVERIFIED\tSTATUS")
+	for _, user := range users {
+		status := "active"
+		if user.Disabled {
+			status = "disabled"
+		}
+		if user.DeletionScheduledAt != nil {
+			status += ", deleted at " + user.DeletionScheduledAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%s\n", user.ID, user.Username, user.Email, user.EmailVerified, status)
+	}
+	w.Flush()
+	return 0
+}
+
+// setUserDisabled disables or enables the user. Disabling revokes the
+// refresh tokens, so the user is logged out once their access tokens expire.
+func setUserDisabled(args []string, disabled bool) int {
+	if len(args) != 1 {
+		return commandUsage("user")
+	}
+
+	database.InitDatabase()
+	user, err := findUser(args[0])
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	changed, err := repositories.SetUserDisabled(database.Database, user.ID, disabled)
+	if err != nil {
+		return fail("Failed to update the user")
+	}
+	if !changed && disabled {
+		return fail("User " + user.Username + " is already disabled")
+	}
+	if !changed {
+		return fail("User " + user.Username + " isn't disabled")
+	}
+
+	if !disabled {
+		fmt.Println("Enabled user " + user.Username)
+		return 0
+	}
+
+	err = repositories.RevokeRefreshTokensOfUser(database.Database, user.ID)
+	if err != nil {
+		return fail("Failed to revoke the refresh tokens")
+	}
+	fmt.Println("Disabled user " + user.Username + ", their access tokens stay valid for up to " + services.AccessTokenLifetime().String())
+	return 0
+}
+
+// resetPassword replaces the password like the password reset of the API
+// does, revoking the refresh tokens and password reset tokens of the user.
+func resetPassword(args []string) int {
+	if len(args) != 1 {
+		return commandUsage("user")
+	}
+
+	database.InitDatabase()
+	user, err := findUser(args[0])
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return fail("Failed to read the password, error: " + err.Error())
+	}
+
+	err = services.ValidatePassword(password)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fail("Failed to hash the password")
+	}
+
+	err = repositories.UpdateUserPassword(database.Database, user.ID, string(passwordHash))
+	if err != nil {
+		return fail("Failed to update the password")
+	}
+
+	err = repositories.RevokeRefreshTokensOfUser(database.Database, user.ID)
+	if err != nil {
+		return fail("Failed to revoke the refresh tokens")
+	}
+
+	err = repositories.InvalidateUserTokens(database.Database, user.ID, models.UserTokenPasswordReset)
+	if err != nil {
+		return fail("Failed to invalidate the password reset tokens")
+	}
+
+	fmt.Println("Reset the password of user " + user.Username)
+	return 0
+}